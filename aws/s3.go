@@ -0,0 +1,71 @@
+package aws
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// S3Endpoint returns the default AWS S3 endpoint for region.
+func S3Endpoint(region string) string {
+	return fmt.Sprintf("https://s3.%s.amazonaws.com", region)
+}
+
+// S3Object identifies an object in an S3-compatible object store.
+type S3Object struct {
+	Endpoint string // For example https://s3.eu-west-1.amazonaws.com
+	Region   string
+	Bucket   string
+	Key      string
+}
+
+// PutObject uploads body as the S3 object obj, with the given content type.
+// It uses path-style addressing (endpoint/bucket/key), which is supported both by AWS
+// and by the S3-compatible object stores (MinIO, Ceph, ...).
+// Parameter transport sends the request; nil means [http.DefaultTransport].
+//
+// See https://docs.aws.amazon.com/AmazonS3/latest/API/API_PutObject.html
+func PutObject(ctx context.Context, transport http.RoundTripper, creds Credentials,
+	obj S3Object, contentType string, body []byte,
+) error {
+	theURL, err := url.Parse(obj.Endpoint)
+	if err != nil {
+		return fmt.Errorf("S3 PutObject: endpoint: %s", err)
+	}
+	segments := append([]string{obj.Bucket}, strings.Split(obj.Key, "/")...)
+	encoded := make([]string, 0, len(segments))
+	for _, seg := range segments {
+		encoded = append(encoded, URIEncode(seg))
+	}
+	theURL.Path = "/" + strings.Join(segments, "/")
+	theURL.RawPath = "/" + strings.Join(encoded, "/")
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, theURL.String(),
+		bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("S3 PutObject: new request: %s", err)
+	}
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("X-Amz-Content-Sha256", hexSHA256(body))
+	Sign(req, body, creds, obj.Region, "s3", time.Now())
+
+	// By default, there is no timeout, so the call could hang forever.
+	client := &http.Client{Timeout: 30 * time.Second, Transport: transport}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("S3 PutObject: send: %s", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		respBody, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("S3 PutObject: status: %s; bucket: %s; key: %s; body: %s",
+			resp.Status, obj.Bucket, obj.Key, strings.TrimSpace(string(respBody)))
+	}
+	return nil
+}
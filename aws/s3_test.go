@@ -0,0 +1,63 @@
+package aws_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Pix4D/cogito/aws"
+	"gotest.tools/v3/assert"
+	"gotest.tools/v3/assert/cmp"
+)
+
+func TestPutObjectSuccess(t *testing.T) {
+	var method, path, auth, contentType string
+	var body []byte
+	ts := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			method = req.Method
+			path = req.URL.EscapedPath()
+			auth = req.Header.Get("Authorization")
+			contentType = req.Header.Get("Content-Type")
+			body, _ = io.ReadAll(req.Body)
+		}))
+	creds := aws.Credentials{AccessKey: "the-access-key", SecretKey: "the-secret-key"}
+	obj := aws.S3Object{
+		Endpoint: ts.URL,
+		Region:   "eu-west-1",
+		Bucket:   "the-bucket",
+		Key:      "the/key with space.json",
+	}
+
+	err := aws.PutObject(context.Background(), nil, creds, obj, "application/json",
+		[]byte(`{"a":1}`))
+
+	assert.NilError(t, err)
+	ts.Close() // Avoid races before the following asserts.
+	assert.Equal(t, method, http.MethodPut)
+	assert.Equal(t, path, "/the-bucket/the/key%20with%20space.json")
+	assert.Equal(t, contentType, "application/json")
+	assert.Equal(t, string(body), `{"a":1}`)
+	assert.Assert(t, cmp.Contains(auth,
+		"Credential=the-access-key/"))
+	assert.Assert(t, cmp.Contains(auth, "/eu-west-1/s3/aws4_request"))
+	assert.Assert(t, !strings.Contains(auth, "the-secret-key"))
+}
+
+func TestPutObjectFailure(t *testing.T) {
+	ts := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			w.WriteHeader(http.StatusForbidden)
+			io.WriteString(w, "<Error><Code>AccessDenied</Code></Error>")
+		}))
+	defer ts.Close()
+	obj := aws.S3Object{Endpoint: ts.URL, Bucket: "the-bucket", Key: "the-key"}
+
+	err := aws.PutObject(context.Background(), nil, aws.Credentials{}, obj, "text/plain", nil)
+
+	assert.Error(t, err, "S3 PutObject: status: 403 Forbidden; bucket: the-bucket; "+
+		"key: the-key; body: <Error><Code>AccessDenied</Code></Error>")
+}
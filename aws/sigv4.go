@@ -0,0 +1,137 @@
+// Package aws implements the minimal subset of the AWS APIs used by Cogito (S3 PutObject,
+// SNS Publish), together with the AWS Signature Version 4 request signing, to avoid
+// depending on the full AWS SDK.
+//
+// See the README for additional information and reference to official documentation.
+package aws
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Credentials are the AWS credentials used to sign a request.
+type Credentials struct {
+	AccessKey string
+	SecretKey string // SENSITIVE
+}
+
+const (
+	sigAlgorithm = "AWS4-HMAC-SHA256"
+	amzDateFmt   = "20060102T150405Z"
+	shortDateFmt = "20060102"
+)
+
+// Sign signs req in place following AWS Signature Version 4, adding the X-Amz-Date and
+// Authorization headers. Parameter body must be the request body (nil if none).
+// Besides Host, the signed headers are Content-Type (if present) and all the X-Amz-*
+// headers, so any X-Amz-* header must be set before calling Sign.
+//
+// See https://docs.aws.amazon.com/general/latest/gr/sigv4_signing.html
+func Sign(req *http.Request, body []byte, creds Credentials, region, service string,
+	now time.Time,
+) {
+	now = now.UTC()
+	amzDate := now.Format(amzDateFmt)
+	req.Header.Set("X-Amz-Date", amzDate)
+
+	// Canonical headers.
+	headers := map[string]string{"host": req.URL.Host}
+	for k, v := range req.Header {
+		lk := strings.ToLower(k)
+		if lk == "content-type" || strings.HasPrefix(lk, "x-amz-") {
+			headers[lk] = strings.TrimSpace(strings.Join(v, ","))
+		}
+	}
+	names := make([]string, 0, len(headers))
+	for k := range headers {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	var canonHeaders strings.Builder
+	for _, k := range names {
+		fmt.Fprintf(&canonHeaders, "%s:%s\n", k, headers[k])
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonPath := req.URL.EscapedPath()
+	if canonPath == "" {
+		canonPath = "/"
+	}
+	canonRequest := strings.Join([]string{
+		req.Method,
+		canonPath,
+		canonicalQuery(req),
+		canonHeaders.String(),
+		signedHeaders,
+		hexSHA256(body),
+	}, "\n")
+
+	scope := strings.Join(
+		[]string{now.Format(shortDateFmt), region, service, "aws4_request"}, "/")
+	stringToSign := strings.Join(
+		[]string{sigAlgorithm, amzDate, scope, hexSHA256([]byte(canonRequest))}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+creds.SecretKey), now.Format(shortDateFmt))
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, service)
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf(
+		"%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		sigAlgorithm, creds.AccessKey, scope, signedHeaders, signature))
+}
+
+// canonicalQuery returns the query of req in the canonical form: sorted by key and
+// URI-encoded.
+func canonicalQuery(req *http.Request) string {
+	query := req.URL.Query()
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var parts []string
+	for _, k := range keys {
+		values := query[k]
+		sort.Strings(values)
+		for _, v := range values {
+			parts = append(parts, URIEncode(k)+"="+URIEncode(v))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// URIEncode encodes s as required by AWS Signature Version 4: every byte except the
+// unreserved characters A-Z, a-z, 0-9, '-', '.', '_' and '~' is percent-encoded.
+func URIEncode(s string) string {
+	var bld strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if ('A' <= c && c <= 'Z') || ('a' <= c && c <= 'z') || ('0' <= c && c <= '9') ||
+			c == '-' || c == '.' || c == '_' || c == '~' {
+			bld.WriteByte(c)
+		} else {
+			fmt.Fprintf(&bld, "%%%02X", c)
+		}
+	}
+	return bld.String()
+}
+
+func hexSHA256(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,35 @@
+package aws_test
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/Pix4D/cogito/aws"
+	"gotest.tools/v3/assert"
+)
+
+// Test vector "get-vanilla" from the AWS Signature Version 4 test suite.
+func TestSignGetVanilla(t *testing.T) {
+	req, err := http.NewRequest(http.MethodGet, "https://example.amazonaws.com/", nil)
+	assert.NilError(t, err)
+	creds := aws.Credentials{
+		AccessKey: "AKIDEXAMPLE",
+		SecretKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY",
+	}
+	now := time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC)
+
+	aws.Sign(req, nil, creds, "us-east-1", "service", now)
+
+	assert.Equal(t, req.Header.Get("X-Amz-Date"), "20150830T123600Z")
+	assert.Equal(t, req.Header.Get("Authorization"),
+		"AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, "+
+			"SignedHeaders=host;x-amz-date, "+
+			"Signature=5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31")
+}
+
+func TestURIEncode(t *testing.T) {
+	have := aws.URIEncode("a-Z_0.9~ /+=é")
+
+	assert.Equal(t, have, "a-Z_0.9~%20%2F%2B%3D%C3%A9")
+}
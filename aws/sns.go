@@ -0,0 +1,76 @@
+package aws
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SNSEndpoint returns the default AWS SNS endpoint for region.
+func SNSEndpoint(region string) string {
+	return fmt.Sprintf("https://sns.%s.amazonaws.com", region)
+}
+
+// SNSTopic identifies an AWS SNS topic.
+type SNSTopic struct {
+	Endpoint string // For example https://sns.eu-west-1.amazonaws.com
+	Region   string
+	ARN      string
+}
+
+// Publish publishes message to topic, with the given message attributes (all of data
+// type String). It uses the SNS Query API (form-encoded POST). As for [PutObject], a
+// nil transport means [http.DefaultTransport].
+//
+// See https://docs.aws.amazon.com/sns/latest/api/API_Publish.html
+func Publish(ctx context.Context, transport http.RoundTripper, creds Credentials,
+	topic SNSTopic, message string, attributes map[string]string,
+) error {
+	form := url.Values{}
+	form.Set("Action", "Publish")
+	form.Set("Version", "2010-03-31")
+	form.Set("TopicArn", topic.ARN)
+	form.Set("Message", message)
+	// Sort the attribute names to obtain a deterministic request.
+	names := make([]string, 0, len(attributes))
+	for k := range attributes {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	for i, name := range names {
+		prefix := "MessageAttributes.entry." + strconv.Itoa(i+1)
+		form.Set(prefix+".Name", name)
+		form.Set(prefix+".Value.DataType", "String")
+		form.Set(prefix+".Value.StringValue", attributes[name])
+	}
+	body := []byte(form.Encode())
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, topic.Endpoint+"/",
+		strings.NewReader(string(body)))
+	if err != nil {
+		return fmt.Errorf("SNS Publish: new request: %s", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded; charset=utf-8")
+	Sign(req, body, creds, topic.Region, "sns", time.Now())
+
+	// By default, there is no timeout, so the call could hang forever.
+	client := &http.Client{Timeout: 30 * time.Second, Transport: transport}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("SNS Publish: send: %s", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		respBody, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("SNS Publish: status: %s; topic: %s; body: %s",
+			resp.Status, topic.ARN, strings.TrimSpace(string(respBody)))
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+package aws_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/Pix4D/cogito/aws"
+	"gotest.tools/v3/assert"
+	"gotest.tools/v3/assert/cmp"
+)
+
+func TestPublishSuccess(t *testing.T) {
+	var method, auth string
+	var form url.Values
+	ts := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			method = req.Method
+			auth = req.Header.Get("Authorization")
+			body, _ := io.ReadAll(req.Body)
+			form, _ = url.ParseQuery(string(body))
+		}))
+	creds := aws.Credentials{AccessKey: "the-access-key", SecretKey: "the-secret-key"}
+	topic := aws.SNSTopic{
+		Endpoint: ts.URL,
+		Region:   "eu-west-1",
+		ARN:      "arn:aws:sns:eu-west-1:123456789012:the-topic",
+	}
+
+	err := aws.Publish(context.Background(), nil, creds, topic, "the-message",
+		map[string]string{"state": "success", "repo": "the-repo"})
+
+	assert.NilError(t, err)
+	ts.Close() // Avoid races before the following asserts.
+	assert.Equal(t, method, http.MethodPost)
+	assert.Equal(t, form.Get("Action"), "Publish")
+	assert.Equal(t, form.Get("TopicArn"), topic.ARN)
+	assert.Equal(t, form.Get("Message"), "the-message")
+	// Attributes are sorted by name.
+	assert.Equal(t, form.Get("MessageAttributes.entry.1.Name"), "repo")
+	assert.Equal(t, form.Get("MessageAttributes.entry.1.Value.StringValue"), "the-repo")
+	assert.Equal(t, form.Get("MessageAttributes.entry.2.Name"), "state")
+	assert.Equal(t, form.Get("MessageAttributes.entry.2.Value.DataType"), "String")
+	assert.Equal(t, form.Get("MessageAttributes.entry.2.Value.StringValue"), "success")
+	assert.Assert(t, cmp.Contains(auth, "/eu-west-1/sns/aws4_request"))
+	assert.Assert(t, !strings.Contains(auth, "the-secret-key"))
+}
+
+func TestPublishFailure(t *testing.T) {
+	ts := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			w.WriteHeader(http.StatusNotFound)
+			io.WriteString(w, "<ErrorResponse><Error><Code>NotFound</Code></Error></ErrorResponse>")
+		}))
+	defer ts.Close()
+	topic := aws.SNSTopic{Endpoint: ts.URL, ARN: "the-arn"}
+
+	err := aws.Publish(context.Background(), nil, aws.Credentials{}, topic, "the-message",
+		nil)
+
+	assert.Error(t, err, "SNS Publish: status: 404 Not Found; topic: the-arn; "+
+		"body: <ErrorResponse><Error><Code>NotFound</Code></Error></ErrorResponse>")
+}
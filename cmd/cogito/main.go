@@ -8,6 +8,7 @@ import (
 	"io"
 	"os"
 	"path"
+	"path/filepath"
 
 	"github.com/Pix4D/cogito/cogito"
 	"github.com/Pix4D/cogito/github"
@@ -15,6 +16,9 @@ import (
 	"github.com/hashicorp/go-hclog"
 )
 
+// selfTest is a variable to allow the tests to simulate a failing self-test.
+var selfTest = cogito.SelfTest
+
 func main() {
 	// The "Concourse resource protocol" expects:
 	// - stdin, stdout and command-line arguments for the protocol itself
@@ -27,6 +31,16 @@ func main() {
 }
 
 func mainErr(in io.Reader, out io.Writer, logOut io.Writer, args []string) error {
+	// The self-test is independent of the command and doesn't read stdin, since it is
+	// meant to be invoked by hand or by a container health check.
+	if len(args) > 1 && args[1] == "--selftest" {
+		if err := selfTest(); err != nil {
+			return err
+		}
+		fmt.Fprintln(out, "cogito: selftest: OK")
+		return nil
+	}
+
 	cmd := path.Base(args[0])
 	validCmds := sets.From("check", "in", "out")
 	if !validCmds.Contains(cmd) {
@@ -37,10 +51,18 @@ func mainErr(in io.Reader, out io.Writer, logOut io.Writer, args []string) error
 	if err != nil {
 		return fmt.Errorf("reading stdin: %s", err)
 	}
-	logLevel, err := peekLogLevel(input)
+	logLevel, logFile, err := peekLogConfig(input, cmd)
 	if err != nil {
 		return err
 	}
+	if logFile != "" {
+		fi, err := openLogFile(logFile)
+		if err != nil {
+			return err
+		}
+		defer fi.Close()
+		logOut = io.MultiWriter(logOut, fi)
+	}
 	log := hclog.New(&hclog.LoggerOptions{
 		Name:        "cogito",
 		Level:       hclog.LevelFromString(logLevel),
@@ -58,7 +80,7 @@ func mainErr(in io.Reader, out io.Writer, logOut io.Writer, args []string) error
 
 	switch cmd {
 	case "check":
-		return cogito.Check(log, input, out, args[1:])
+		return cogito.Check(log, input, out, args[1:], ghAPI)
 	case "in":
 		return cogito.Get(log, input, out, args[1:])
 	case "out":
@@ -69,24 +91,52 @@ func mainErr(in io.Reader, out io.Writer, logOut io.Writer, args []string) error
 	}
 }
 
-// peekLogLevel decodes 'input' as JSON and looks for key source.log_level. If 'input'
-// is not JSON, peekLogLevel will return an error. If 'input' is JSON but does not
-// contain key source.log_level, peekLogLevel returns "info" as default value.
+// peekLogConfig decodes 'input' as JSON and looks for keys source.log_level and
+// source.log_file. If 'input' is not JSON, peekLogConfig will return an error. If
+// 'input' is JSON but does not contain key source.log_level, peekLogConfig returns
+// "info" as default value. The log level specific to 'cmd' (source.log_level_check,
+// source.log_level_in, source.log_level_out), if set, takes precedence.
 //
 // Rationale: depending on the Concourse step we are invoked for, the JSON object we get
 // from stdin is different, but it always contains a struct with name "source", thus we
 // can peek into it to gather the log level as soon as possible.
-func peekLogLevel(input []byte) (string, error) {
+func peekLogConfig(input []byte, cmd string) (string, string, error) {
 	type Peek struct {
 		Source struct {
-			LogLevel string `json:"log_level"`
+			LogLevel      string `json:"log_level"`
+			LogLevelCheck string `json:"log_level_check"`
+			LogLevelIn    string `json:"log_level_in"`
+			LogLevelOut   string `json:"log_level_out"`
+			LogFile       string `json:"log_file"`
 		} `json:"source"`
 	}
 	var peek Peek
 	peek.Source.LogLevel = "info" // default value
 	if err := json.Unmarshal(input, &peek); err != nil {
-		return "", fmt.Errorf("peeking into JSON for log_level: %s", err)
+		return "", "", fmt.Errorf("peeking into JSON for log_level and log_file: %s", err)
+	}
+
+	level := map[string]string{
+		"check": peek.Source.LogLevelCheck,
+		"in":    peek.Source.LogLevelIn,
+		"out":   peek.Source.LogLevelOut,
+	}[cmd]
+	if level == "" {
+		level = peek.Source.LogLevel
 	}
 
-	return peek.Source.LogLevel, nil
+	return level, peek.Source.LogFile, nil
+}
+
+// openLogFile opens path for appending the logs (see source.log_file), creating it and
+// its parent directories if needed.
+func openLogFile(path string) (*os.File, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("log_file: %s", err)
+	}
+	fi, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("log_file: %s", err)
+	}
+	return fi, nil
 }
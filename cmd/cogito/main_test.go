@@ -3,10 +3,14 @@ package main
 import (
 	"bytes"
 	"errors"
+	"fmt"
 	"io"
 	"net/http"
 	"net/url"
+	"os"
+	"os/exec"
 	"path"
+	"path/filepath"
 	"strings"
 	"testing"
 	"testing/iotest"
@@ -19,6 +23,45 @@ import (
 	"gotest.tools/v3/assert/cmp"
 )
 
+func TestRunSelfTestSuccess(t *testing.T) {
+	var out bytes.Buffer
+	var logOut bytes.Buffer
+
+	// Stdin is not read.
+	err := mainErr(iotest.ErrReader(errors.New("test read error")), &out, &logOut,
+		[]string{"out", "--selftest"})
+
+	assert.NilError(t, err, "\nout: %s\nlogOut: %s", out.String(), logOut.String())
+	assert.Equal(t, out.String(), "cogito: selftest: OK\n")
+}
+
+func TestRunSelfTestFailure(t *testing.T) {
+	// The child process: run main, which exits on failure.
+	if os.Getenv("COGITO_TEST_SELFTEST_CHILD") == "1" {
+		selfTest = func() error { return errors.New("selftest: simulated failure") }
+		os.Args = []string{"out", "--selftest"}
+		main()
+		return
+	}
+
+	// The parent process: observe the exit code and the output of the child.
+	cmd := exec.Command(os.Args[0], "-test.run=^TestRunSelfTestFailure$")
+	cmd.Env = append(os.Environ(), "COGITO_TEST_SELFTEST_CHILD=1")
+	var out bytes.Buffer
+	var logOut bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &logOut
+
+	err := cmd.Run()
+
+	var exitErr *exec.ExitError
+	assert.Assert(t, errors.As(err, &exitErr), "err: %v", err)
+	assert.Equal(t, exitErr.ExitCode(), 1)
+	assert.Assert(t, cmp.Contains(logOut.String(),
+		"cogito: error: selftest: simulated failure\n"))
+	assert.Assert(t, !strings.Contains(out.String(), "selftest: OK"), out.String())
+}
+
 func TestRunCheckSuccess(t *testing.T) {
 	in := strings.NewReader(`
 {
@@ -166,7 +209,21 @@ func TestRunFailure(t *testing.T) {
 			name:    "peeking for log_level",
 			args:    []string{"check"},
 			in:      "",
-			wantErr: "peeking into JSON for log_level: unexpected end of JSON input",
+			wantErr: "peeking into JSON for log_level and log_file: unexpected end of JSON input",
+		},
+		{
+			name: "log_file not writable",
+			args: []string{"check"},
+			in: `
+{
+  "source": {
+    "owner": "the-owner",
+    "repo": "the-repo",
+    "access_token": "the-secret",
+    "log_file": "/dev/null/cogito.log"
+  }
+}`,
+			wantErr: "log_file: mkdir /dev/null: not a directory",
 		},
 	}
 
@@ -204,3 +261,79 @@ func TestRunPrintsBuildInformation(t *testing.T) {
 
 	assert.Assert(t, strings.Contains(haveLog, wantLog), haveLog)
 }
+
+func TestRunLogFile(t *testing.T) {
+	logFile := filepath.Join(t.TempDir(), "sub", "cogito.log")
+	in := strings.NewReader(fmt.Sprintf(`
+{
+  "source": {
+    "owner": "the-owner",
+    "repo": "the-repo",
+    "access_token": "the-secret",
+    "log_file": %q
+  }
+}`, logFile))
+	var logBuf bytes.Buffer
+	wantLog := "cogito: This is the Cogito GitHub status resource."
+
+	err := mainErr(in, io.Discard, &logBuf, []string{"check"})
+
+	assert.NilError(t, err)
+	assert.Assert(t, cmp.Contains(logBuf.String(), wantLog))
+	fileLog, err := os.ReadFile(logFile)
+	assert.NilError(t, err)
+	assert.Equal(t, string(fileLog), logBuf.String())
+}
+
+func TestPeekLogConfigPerCommand(t *testing.T) {
+	type testCase struct {
+		name  string
+		input string
+		cmd   string
+		want  string
+	}
+
+	test := func(t *testing.T, tc testCase) {
+		level, _, err := peekLogConfig([]byte(tc.input), tc.cmd)
+
+		assert.NilError(t, err)
+		assert.Equal(t, level, tc.want)
+	}
+
+	const input = `{"source": {"log_level": "warn", "log_level_out": "debug"}}`
+
+	testCases := []testCase{
+		{name: "out-specific level for out", input: input, cmd: "out", want: "debug"},
+		{name: "general level for check", input: input, cmd: "check", want: "warn"},
+		{name: "general level for in", input: input, cmd: "in", want: "warn"},
+		{name: "default", input: `{"source": {}}`, cmd: "out", want: "info"},
+		{
+			name:  "check-specific level without general level",
+			input: `{"source": {"log_level_check": "error"}}`,
+			cmd:   "check",
+			want:  "error",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) { test(t, tc) })
+	}
+}
+
+func TestRunLogLevelOutDoesNotApplyToCheck(t *testing.T) {
+	in := strings.NewReader(`
+{
+  "source": {
+    "owner": "the-owner",
+    "repo": "the-repo",
+    "access_token": "the-secret",
+    "log_level_out": "debug"
+  }
+}`)
+	var logBuf bytes.Buffer
+
+	err := mainErr(in, io.Discard, &logBuf, []string{"check"})
+
+	assert.NilError(t, err)
+	assert.Assert(t, !strings.Contains(logBuf.String(), "[DEBUG]"), logBuf.String())
+}
@@ -0,0 +1,13 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+
+package cogito
+
+import (
+	"os"
+	"syscall"
+)
+
+// lockFile takes an exclusive advisory lock (flock) on fi, released when fi is closed.
+func lockFile(fi *os.File) error {
+	return syscall.Flock(int(fi.Fd()), syscall.LOCK_EX)
+}
@@ -0,0 +1,107 @@
+package cogito
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+)
+
+// FileAuditSink is an implementation of [Sinker] for the Cogito resource.
+// It appends an audit record, as a line of JSON, to a local file. See
+// source.audit_log_file.
+type FileAuditSink struct {
+	Log     hclog.Logger
+	GitRef  string
+	Request PutRequest
+	// Sinks are the names of the other sinks of this put step.
+	Sinks []string
+	// NotSent are the reports of the other sinks that didn't send (skipped or failed),
+	// filled while the sinks run. These sinks are left out of the record.
+	NotSent []SkipReport
+}
+
+// AuditRecord is the JSON object written by [FileAuditSink], one per line.
+type AuditRecord struct {
+	Time    time.Time `json:"time"`
+	Owner   string    `json:"owner"`
+	Repo    string    `json:"repo"`
+	SHA     string    `json:"sha"`
+	Context string    `json:"context"`
+	State   string    `json:"state"`
+	Sinks   []string  `json:"sinks"`
+}
+
+// Send appends the audit record to the file, creating it if needed. The file is locked
+// for the duration of the write, since multiple processes that share the file (for
+// example on a shared volume) can append to it concurrently.
+func (sink FileAuditSink) Send() error {
+	sink.Log.Debug("send: started")
+	defer sink.Log.Debug("send: finished")
+
+	src := sink.Request.Source
+	record := AuditRecord{
+		Time:    time.Now().UTC(),
+		Owner:   src.Owner,
+		Repo:    src.Repo,
+		SHA:     sink.GitRef,
+		Context: ghMakeContext(sink.Request),
+		State:   string(sink.Request.Params.State),
+		Sinks:   sink.sentSinks(),
+	}
+	line, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("FileAuditSink: %s", err)
+	}
+	line = append(line, '\n')
+
+	if err := appendLocked(src.AuditLogFile, line); err != nil {
+		return fmt.Errorf("FileAuditSink: %s", err)
+	}
+
+	sink.Log.Info("audit record written", "state", record.State,
+		"file", src.AuditLogFile)
+	return nil
+}
+
+// sentSinks returns the names of the other sinks that sent, that is, that are not in
+// the NotSent reports. A non-blocking sink (see source.non_blocking_sinks) that is still
+// running counts as sent.
+func (sink FileAuditSink) sentSinks() []string {
+	sent := []string{}
+	for _, name := range sink.Sinks {
+		found := false
+		for _, report := range sink.NotSent {
+			if _, ok := report.Reason(name); ok {
+				found = true
+				break
+			}
+		}
+		if !found {
+			sent = append(sent, name)
+		}
+	}
+	return sent
+}
+
+// appendLocked appends data to file path, creating it if needed, holding an exclusive
+// advisory lock on it (see lockFile). Data is written with a single write call.
+func appendLocked(path string, data []byte) error {
+	fi, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return err
+	}
+	defer fi.Close()
+
+	// The lock is released when the file is closed.
+	if err := lockFile(fi); err != nil {
+		return fmt.Errorf("lock %s: %s", path, err)
+	}
+
+	if _, err := fi.Write(data); err != nil {
+		return err
+	}
+	return fi.Close()
+}
@@ -0,0 +1,69 @@
+package cogito_test
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Pix4D/cogito/cogito"
+	"github.com/hashicorp/go-hclog"
+	"gotest.tools/v3/assert"
+)
+
+func TestSinkFileAuditSendAppends(t *testing.T) {
+	auditFile := filepath.Join(t.TempDir(), "audit.jsonl")
+	request := basePutRequest
+	request.Source.AuditLogFile = auditFile
+	request.Env.BuildJobName = "the-job"
+	assert.NilError(t, request.Source.Validate())
+
+	for _, state := range []cogito.BuildState{cogito.StatePending, cogito.StateSuccess} {
+		request.Params.State = state
+		sink := cogito.FileAuditSink{
+			Log:     hclog.NewNullLogger(),
+			GitRef:  "deadbeef",
+			Request: request,
+			Sinks:   []string{"github", "gchat"},
+		}
+		assert.NilError(t, sink.Send())
+	}
+
+	fi, err := os.Open(auditFile)
+	assert.NilError(t, err)
+	defer fi.Close()
+	var records []cogito.AuditRecord
+	scanner := bufio.NewScanner(fi)
+	for scanner.Scan() {
+		var record cogito.AuditRecord
+		assert.NilError(t, json.Unmarshal(scanner.Bytes(), &record),
+			"line: %s", scanner.Text())
+		records = append(records, record)
+	}
+	assert.NilError(t, scanner.Err())
+	assert.Equal(t, len(records), 2)
+	for i, state := range []string{"pending", "success"} {
+		assert.Equal(t, records[i].State, state)
+		assert.Equal(t, records[i].Owner, "the-owner")
+		assert.Equal(t, records[i].Repo, "the-repo")
+		assert.Equal(t, records[i].SHA, "deadbeef")
+		assert.Equal(t, records[i].Context, "the-job")
+		assert.DeepEqual(t, records[i].Sinks, []string{"github", "gchat"})
+		assert.Assert(t, !records[i].Time.IsZero())
+	}
+}
+
+func TestSinkFileAuditSendFailure(t *testing.T) {
+	request := basePutRequest
+	request.Source.AuditLogFile = filepath.Join(t.TempDir(), "non-existing", "audit.jsonl")
+	sink := cogito.FileAuditSink{
+		Log:     hclog.NewNullLogger(),
+		GitRef:  "deadbeef",
+		Request: request,
+	}
+
+	err := sink.Send()
+
+	assert.ErrorContains(t, err, "FileAuditSink: open ")
+}
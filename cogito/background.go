@@ -0,0 +1,104 @@
+package cogito
+
+import (
+	"sync"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+)
+
+// defaultNonBlockingWindow is the default of source.non_blocking_window.
+const defaultNonBlockingWindow = 5 * time.Second
+
+// backgroundSends tracks the sinks sent in the background (see
+// source.non_blocking_sinks), so that the put step can wait for them, but only for a
+// limited completion window.
+type backgroundSends struct {
+	log        hclog.Logger
+	ignored    SkipReport
+	unfinished SkipReport
+
+	wg      sync.WaitGroup
+	mu      sync.Mutex // Protects results.
+	results []*backgroundResult
+}
+
+type backgroundResult struct {
+	name string
+	done bool
+	err  error
+}
+
+// wrap returns a [Sinker] that sends sink in the background.
+func (bg *backgroundSends) wrap(sink Sinker, name string) Sinker {
+	return backgroundSink{Sinker: sink, name: name, bg: bg}
+}
+
+// waiter returns a [Sinker] that waits for the background sinks, for at most window.
+// It must run after all the other sinks.
+func (bg *backgroundSends) waiter(window time.Duration) Sinker {
+	return backgroundWaiter{bg: bg, window: window}
+}
+
+// backgroundSink is a non-blocking [Sinker]: Send returns immediately.
+type backgroundSink struct {
+	Sinker
+	name string
+	bg   *backgroundSends
+}
+
+func (sink backgroundSink) Send() error {
+	result := &backgroundResult{name: sink.name}
+	sink.bg.mu.Lock()
+	sink.bg.results = append(sink.bg.results, result)
+	sink.bg.mu.Unlock()
+
+	sink.bg.log.Debug("sending in the background", "sink", sink.name)
+	sink.bg.wg.Add(1)
+	go func() {
+		defer sink.bg.wg.Done()
+		err := sink.Sinker.Send()
+		sink.bg.mu.Lock()
+		defer sink.bg.mu.Unlock()
+		result.done = true
+		result.err = err
+	}()
+	return nil
+}
+
+// backgroundWaiter waits for the background sinks. Since they are best-effort, their
+// errors are logged and recorded, but not returned.
+type backgroundWaiter struct {
+	bg     *backgroundSends
+	window time.Duration
+}
+
+func (waiter backgroundWaiter) Send() error {
+	bg := waiter.bg
+	done := make(chan struct{})
+	go func() {
+		bg.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(waiter.window):
+	}
+
+	bg.mu.Lock()
+	defer bg.mu.Unlock()
+	for _, result := range bg.results {
+		switch {
+		case !result.done:
+			bg.log.Warn("not waiting for sink", "sink", result.name,
+				"reason", "not completed within non_blocking_window",
+				"non_blocking_window", waiter.window)
+			bg.unfinished.Add(result.name, "not completed within non_blocking_window")
+		case result.err != nil:
+			bg.log.Error("ignoring sink error", "reason", "non_blocking_sinks",
+				"sink", result.name, "error", result.err)
+			bg.ignored.Add(result.name, result.err.Error())
+		}
+	}
+	return nil
+}
@@ -1,15 +1,20 @@
 package cogito
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
+	"time"
 
+	"github.com/Pix4D/cogito/github"
+	"github.com/Pix4D/cogito/googlechat"
 	"github.com/hashicorp/go-hclog"
 )
 
 // Check implements the "check" step (the "check" executable).
-// For the Cogito resource, this is a no-op.
+// For the Cogito resource, this is a no-op, apart from the optional guardrails on the
+// configuration, like source.expected_default_branch, that use the GitHub API ghAPI.
 //
 // From https://concourse-ci.org/implementing-resource-types.html#resource-check:
 //
@@ -17,7 +22,8 @@ import (
 // It is given the configured source and current version on stdin, and must print the
 // array of new versions, in chronological order (oldest first), to stdout, including
 // the requested version if it is still valid.
-func Check(log hclog.Logger, input []byte, out io.Writer, args []string) error {
+func Check(log hclog.Logger, input []byte, out io.Writer, args []string, ghAPI string,
+) error {
 	log = log.Named("check")
 	log.Debug("started")
 	defer log.Debug("finished")
@@ -26,12 +32,37 @@ func Check(log hclog.Logger, input []byte, out io.Writer, args []string) error {
 	if err != nil {
 		return err
 	}
+	// Only the calls to the GitHub API need the token: don't run the (possibly slow)
+	// token_command otherwise, since Concourse runs the check step periodically.
+	needsToken := request.Source.ExpectedDefaultBranch != "" ||
+		request.Source.CheckReportRateLimit
+	if request.Source.TokenCommand != "" && needsToken {
+		token, err := runTokenCommand(context.Background(), request.Source.TokenCommand,
+			tokenCommandTimeout)
+		if err != nil {
+			return fmt.Errorf("check: %s", err)
+		}
+		request.Source.AccessToken = token
+	}
 	log.Debug("parsed check request",
 		"source", request.Source,
 		"version", request.Version,
 		"environment", request.Env,
 		"args", args)
 
+	opts := github.Options{
+		Timeout: sinkTimeout(request.Source.GitHubTimeout, github.DefaultTimeout),
+	}
+	if err := verifyDefaultBranch(ghAPI, request.Source, opts); err != nil {
+		return fmt.Errorf("check: %s", err)
+	}
+	if request.Source.CheckReportRateLimit {
+		reportRateLimit(log, ghAPI, request.Source.AccessToken, opts)
+	}
+	if request.Source.GChatCheckWebHook {
+		reportWebHookReachability(log, request.Source)
+	}
+
 	// We don't validate the presence of field request.Version because Concourse will
 	// omit it from the _first_ request of the check step.
 
@@ -53,3 +84,54 @@ func Check(log hclog.Logger, input []byte, out io.Writer, args []string) error {
 	log.Debug("success", "output.version", versions)
 	return nil
 }
+
+// reportRateLimit logs the rate limit status of the GitHub API core quota of token.
+// It is informational, so it only logs a warning on error.
+func reportRateLimit(log hclog.Logger, ghAPI, token string, opts github.Options) {
+	rateLimit, err := github.CoreRateLimit(ghAPI, token, opts)
+	if err != nil {
+		log.Warn("check_report_rate_limit: cannot get the rate limit", "error", err)
+		return
+	}
+	log.Info("GitHub API rate limit (core)",
+		"limit", rateLimit.Limit,
+		"remaining", rateLimit.Remaining,
+		"reset", rateLimit.Reset.Format(time.RFC3339))
+}
+
+// reportWebHookReachability logs if the chat webhook is reachable. See
+// source.gchat_check_webhook. It uses [googlechat.Preflight], which doesn't post any
+// message.
+func reportWebHookReachability(log hclog.Logger, src Source) {
+	if src.GChatWebHook == "" {
+		log.Info("gchat_check_webhook: not checking", "reason", "gchat_webhook not set")
+		return
+	}
+	timeout := sinkTimeout(src.GChatTimeout, gChatDefaultTimeout)
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := googlechat.Preflight(ctx, nil, src.GChatWebHook); err != nil {
+		log.Warn("gchat_check_webhook: webhook unreachable", "error", err)
+		return
+	}
+	log.Info("gchat_check_webhook: webhook reachable")
+}
+
+// verifyDefaultBranch returns an error if source.expected_default_branch is set and
+// differs from the default branch of the repo, as reported by the GitHub API.
+func verifyDefaultBranch(ghAPI string, src Source, opts github.Options) error {
+	if src.ExpectedDefaultBranch == "" {
+		return nil
+	}
+	branch, err := github.DefaultBranch(ghAPI, src.AccessToken, src.Owner, src.Repo,
+		opts)
+	if err != nil {
+		return fmt.Errorf("expected_default_branch: %w", err)
+	}
+	if branch != src.ExpectedDefaultBranch {
+		return fmt.Errorf("expected_default_branch: have: %s; want: %s "+
+			"(are source.owner and source.repo pointing to the right repo?)",
+			branch, src.ExpectedDefaultBranch)
+	}
+	return nil
+}
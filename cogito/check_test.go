@@ -2,13 +2,18 @@ package cogito_test
 
 import (
 	"bytes"
+	"fmt"
 	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
 
 	"github.com/Pix4D/cogito/cogito"
 	"github.com/Pix4D/cogito/testhelp"
 	"github.com/hashicorp/go-hclog"
 	"gotest.tools/v3/assert"
+	"gotest.tools/v3/assert/cmp"
 )
 
 func TestCheckSuccess(t *testing.T) {
@@ -23,7 +28,7 @@ func TestCheckSuccess(t *testing.T) {
 		var out bytes.Buffer
 		log := hclog.NewNullLogger()
 
-		err := cogito.Check(log, in, &out, nil)
+		err := cogito.Check(log, in, &out, nil, "dummy-API")
 
 		assert.NilError(t, err)
 		var have []cogito.Version
@@ -75,7 +80,7 @@ func TestCheckFailure(t *testing.T) {
 		in := testhelp.ToJSON(t, cogito.CheckRequest{Source: tc.source})
 		log := hclog.NewNullLogger()
 
-		err := cogito.Check(log, in, tc.writer, nil)
+		err := cogito.Check(log, in, tc.writer, nil, "dummy-API")
 
 		assert.Error(t, err, tc.wantErr)
 	}
@@ -111,7 +116,182 @@ func TestCheckFailure(t *testing.T) {
 func TestCheckInputFailure(t *testing.T) {
 	log := hclog.NewNullLogger()
 
-	err := cogito.Check(log, nil, io.Discard, nil)
+	err := cogito.Check(log, nil, io.Discard, nil, "dummy-API")
 
 	assert.Error(t, err, "check: parsing request: EOF")
 }
+
+func TestCheckExpectedDefaultBranch(t *testing.T) {
+	type testCase struct {
+		name          string
+		defaultBranch string
+		wantErr       string
+	}
+
+	test := func(t *testing.T, tc testCase) {
+		ts := httptest.NewServer(
+			http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				fmt.Fprintf(w, `{"default_branch": "%s"}`, tc.defaultBranch)
+			}))
+		defer ts.Close()
+		source := cogito.Source{
+			Owner:                 "the-owner",
+			Repo:                  "the-repo",
+			AccessToken:           "the-token",
+			ExpectedDefaultBranch: "main",
+		}
+		in := testhelp.ToJSON(t, cogito.CheckRequest{Source: source})
+
+		err := cogito.Check(hclog.NewNullLogger(), in, io.Discard, nil, ts.URL)
+
+		if tc.wantErr == "" {
+			assert.NilError(t, err)
+		} else {
+			assert.Error(t, err, tc.wantErr)
+		}
+	}
+
+	testCases := []testCase{
+		{
+			name:          "matching default branch",
+			defaultBranch: "main",
+		},
+		{
+			name:          "mismatching default branch",
+			defaultBranch: "master",
+			wantErr: "check: expected_default_branch: have: master; want: main " +
+				"(are source.owner and source.repo pointing to the right repo?)",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) { test(t, tc) })
+	}
+}
+
+func TestCheckReportRateLimit(t *testing.T) {
+	ts := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			fmt.Fprint(w,
+				`{"resources": {"core": {"limit": 5000, "remaining": 4321, "reset": 1663236672}}}`)
+		}))
+	defer ts.Close()
+	source := cogito.Source{
+		Owner:                "the-owner",
+		Repo:                 "the-repo",
+		AccessToken:          "the-token",
+		CheckReportRateLimit: true,
+	}
+	in := testhelp.ToJSON(t, cogito.CheckRequest{Source: source})
+	var logBuf bytes.Buffer
+	log := hclog.New(&hclog.LoggerOptions{Output: &logBuf})
+
+	err := cogito.Check(log, in, io.Discard, nil, ts.URL)
+
+	assert.NilError(t, err)
+	have := logBuf.String()
+	assert.Assert(t, cmp.Contains(have, "GitHub API rate limit (core)"))
+	assert.Assert(t, cmp.Contains(have, "remaining=4321"))
+	assert.Assert(t, cmp.Contains(have, "reset=2022-09-15T10:11:12Z"))
+}
+
+func TestCheckTokenCommandOnlyWhenNeeded(t *testing.T) {
+	type testCase struct {
+		name    string
+		source  cogito.Source
+		wantErr string
+	}
+
+	test := func(t *testing.T, tc testCase) {
+		ts := httptest.NewServer(
+			http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				fmt.Fprint(w, `{"resources": {"core": {}}}`)
+			}))
+		defer ts.Close()
+		tc.source.Owner = "the-owner"
+		tc.source.Repo = "the-repo"
+		// A failing token_command shows if it runs.
+		tc.source.TokenCommand = "exit 1"
+		in := testhelp.ToJSON(t, cogito.CheckRequest{Source: tc.source})
+
+		err := cogito.Check(hclog.NewNullLogger(), in, io.Discard, nil, ts.URL)
+
+		if tc.wantErr == "" {
+			assert.NilError(t, err)
+		} else {
+			assert.ErrorContains(t, err, tc.wantErr)
+		}
+	}
+
+	testCases := []testCase{
+		{
+			name:   "no GitHub API call: not run",
+			source: cogito.Source{},
+		},
+		{
+			name:    "check_report_rate_limit: run",
+			source:  cogito.Source{CheckReportRateLimit: true},
+			wantErr: "check: token_command: ",
+		},
+		{
+			name:    "expected_default_branch: run",
+			source:  cogito.Source{ExpectedDefaultBranch: "main"},
+			wantErr: "check: token_command: ",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) { test(t, tc) })
+	}
+}
+
+func TestCheckGChatCheckWebHookReachable(t *testing.T) {
+	var method string
+	ts := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			method = req.Method
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}))
+	source := cogito.Source{
+		Owner:             "the-owner",
+		Repo:              "the-repo",
+		AccessToken:       "the-token",
+		GChatWebHook:      ts.URL + "/v1/spaces/x?key=the-key",
+		GChatCheckWebHook: true,
+	}
+	in := testhelp.ToJSON(t, cogito.CheckRequest{Source: source})
+	var logBuf bytes.Buffer
+	log := hclog.New(&hclog.LoggerOptions{Output: &logBuf})
+
+	err := cogito.Check(log, in, io.Discard, nil, "dummy-API")
+
+	assert.NilError(t, err)
+	ts.Close() // Avoid races before the following asserts.
+	assert.Assert(t, cmp.Contains(logBuf.String(), "gchat_check_webhook: webhook reachable"))
+	// Not a POST, so no message is posted.
+	assert.Equal(t, method, http.MethodHead)
+}
+
+func TestCheckGChatCheckWebHookUnreachable(t *testing.T) {
+	ts := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {}))
+	ts.Close() // Make the webhook unreachable.
+	source := cogito.Source{
+		Owner:             "the-owner",
+		Repo:              "the-repo",
+		AccessToken:       "the-token",
+		GChatWebHook:      ts.URL + "/v1/spaces/x?key=sensitive-key",
+		GChatCheckWebHook: true,
+	}
+	in := testhelp.ToJSON(t, cogito.CheckRequest{Source: source})
+	var logBuf bytes.Buffer
+	log := hclog.New(&hclog.LoggerOptions{Output: &logBuf})
+
+	err := cogito.Check(log, in, io.Discard, nil, "dummy-API")
+
+	// Informational: it doesn't fail the check.
+	assert.NilError(t, err)
+	have := logBuf.String()
+	assert.Assert(t, cmp.Contains(have, "[WARN]  check: gchat_check_webhook: webhook unreachable"))
+	assert.Assert(t, !strings.Contains(have, "sensitive-key"), have)
+}
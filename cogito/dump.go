@@ -0,0 +1,92 @@
+package cogito
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/Pix4D/cogito/googlechat"
+	"github.com/hashicorp/go-hclog"
+)
+
+// dumpTransport is an [http.RoundTripper] that logs at debug level each outgoing
+// request, including its body, before passing it to next. See
+// source.debug_dump_requests.
+//
+// Redaction: the Authorization header is redacted, the URL is redacted with
+// [googlechat.RedactURL], since the Google Chat webhook carries the secrets in the
+// query parameters, and the credential fields of a form body are redacted with
+// [redactFormBody], since for example the Pub/Sub token exchange carries a signed JWT.
+type dumpTransport struct {
+	log  hclog.Logger
+	next http.RoundTripper
+}
+
+func (tr dumpTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		body, err = io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("debug_dump_requests: reading request body: %s", err)
+		}
+		req.Body = io.NopCloser(bytes.NewReader(body))
+	}
+
+	tr.log.Debug("outgoing request",
+		"method", req.Method,
+		"url", googlechat.RedactURL(req.URL),
+		"headers", redactHeaders(req.Header),
+		"body", redactFormBody(req.Header.Get("Content-Type"), body))
+
+	return tr.next.RoundTrip(req)
+}
+
+// sensitiveFormFields are the fields of a form body that carry a credential.
+// DO NOT REASSIGN.
+var sensitiveFormFields = []string{"assertion", "client_assertion", "client_secret",
+	"access_token", "refresh_token", "password"}
+
+// redactFormBody returns body as a string. If contentType is a form, it redacts the
+// values of sensitiveFormFields. A form that cannot be parsed is redacted as a whole.
+func redactFormBody(contentType string, body []byte) string {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil || mediaType != "application/x-www-form-urlencoded" {
+		return string(body)
+	}
+	form, err := url.ParseQuery(string(body))
+	if err != nil {
+		return redact(string(body))
+	}
+	for _, field := range sensitiveFormFields {
+		if form.Has(field) {
+			form.Set(field, redact(form.Get(field)))
+		}
+	}
+	return form.Encode()
+}
+
+// redactHeaders renders headers, one per line and sorted, redacting the sensitive ones.
+func redactHeaders(headers http.Header) string {
+	keys := make([]string, 0, len(headers))
+	for k := range headers {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var bld strings.Builder
+	for _, k := range keys {
+		value := strings.Join(headers[k], ", ")
+		if http.CanonicalHeaderKey(k) == "Authorization" {
+			value = redact(value)
+		}
+		fmt.Fprintf(&bld, "%s: %s\n", k, value)
+	}
+	return bld.String()
+}
@@ -1,9 +1,12 @@
 package cogito
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"io/fs"
+	"net/http"
+	"path"
 	"strings"
 	"time"
 
@@ -17,8 +20,33 @@ type GoogleChatSink struct {
 	InputDir fs.FS
 	GitRef   string
 	Request  PutRequest
+	// PrevState is the previous state, if known. See source.chat_show_transition.
+	PrevState BuildState
+	// TerminalSent is true if this build already posted a terminal state to GitHub.
+	// See source.gchat_once_per_build.
+	TerminalSent bool
+	// PrevGitHubState is the state of the previous GitHub commit status with the same
+	// context, if known. See source.chat_notify_on_change.
+	PrevGitHubState string
+	// Skips, if not nil, records why the message is not sent.
+	Skips SkipReport
+	// SkipNotify is true if the commit message has the trailer of
+	// source.skip_notify_trailer.
+	SkipNotify bool
+	// Branch and Tag are the branch checked out and the tag of GitRef, if any. See
+	// [ChatFooterData].
+	Branch string
+	Tag    string
+	// Transport sends the HTTP requests; nil means [http.DefaultTransport].
+	Transport http.RoundTripper
+	// Ctx is the context of the put step, see source.put_timeout. Nil means
+	// [context.Background].
+	Ctx context.Context
 }
 
+// gChatDefaultTimeout is the default timeout of each request to Google Chat.
+const gChatDefaultTimeout = 10 * time.Second
+
 // Send sends a message to Google Chat if the configuration matches.
 func (sink GoogleChatSink) Send() error {
 	sink.Log.Debug("send: started")
@@ -32,50 +60,172 @@ func (sink GoogleChatSink) Send() error {
 	}
 	if webHook == "" {
 		sink.Log.Info("not sending to chat", "reason", "feature not enabled")
+		sink.Skips.Add(sinkGChat, "gchat_webhook not set")
+		return nil
+	}
+
+	if sink.SkipNotify {
+		sink.Log.Info("not sending to chat", "reason", "skip_notify_trailer",
+			"trailer", sink.Request.Source.SkipNotifyTrailer)
+		sink.Skips.Add(sinkGChat, "skip_notify_trailer: found in commit message")
 		return nil
 	}
 
 	state := sink.Request.Params.State
 	if !shouldSendToChat(sink.Request) {
+		// Help to catch a misconfigured chat_notify_on_states, since the default
+		// is expected not to match some states.
+		source := sink.Request.Source
+		if !isDefaultNotifyStates(source.ChatNotifyOnStates) {
+			if source.ChatErrorIfNever {
+				return fmt.Errorf(
+					"GoogleChatSink: state %s not in chat_notify_on_states %v (chat_error_if_never is set)",
+					state, source.ChatNotifyOnStates)
+			}
+			if source.ChatWarnIfNever {
+				sink.Log.Warn("not sending to chat",
+					"reason", "state not in chat_notify_on_states", "state", state,
+					"chat_notify_on_states", source.ChatNotifyOnStates)
+				sink.Skips.Add(sinkGChat, "state not in chat_notify_on_states")
+				return nil
+			}
+		}
 		sink.Log.Debug("not sending to chat",
 			"reason", "state not in configured states", "state", state)
+		sink.Skips.Add(sinkGChat, "state not in chat_notify_on_states")
 		return nil
 	}
 
-	text, err := prepareChatMessage(sink.InputDir, sink.Request, sink.GitRef)
+	if sink.Request.Source.GChatOncePerBuild {
+		if !state.IsTerminal() {
+			sink.Log.Debug("not sending to chat",
+				"reason", "gchat_once_per_build: state is not terminal", "state", state)
+			sink.Skips.Add(sinkGChat, "gchat_once_per_build: state is not terminal")
+			return nil
+		}
+		if sink.TerminalSent {
+			sink.Log.Info("not sending to chat",
+				"reason", "gchat_once_per_build: already sent for this build",
+				"state", state, "build-id", sink.Request.Env.BuildId)
+			sink.Skips.Add(sinkGChat, "gchat_once_per_build: already sent for this build")
+			return nil
+		}
+	}
+
+	// The previous state is the one of the GitHub commit status with the same context,
+	// read before posting the new one. If unknown, the state is considered changed.
+	if sink.Request.Source.ChatNotifyOnChange {
+		if sink.PrevGitHubState == ghAdaptState(state) {
+			sink.Log.Info("not sending to chat",
+				"reason", "chat_notify_on_change: state unchanged",
+				"context", ghMakeContext(sink.Request), "state", state)
+			sink.Skips.Add(sinkGChat, "chat_notify_on_change: state unchanged")
+			return nil
+		}
+	}
+
+	timeout := sinkTimeout(sink.Request.Source.GChatTimeout, gChatDefaultTimeout)
+	if sink.Request.Source.ChatPreflight {
+		ctx, cancel := context.WithTimeout(orBackground(sink.Ctx), timeout)
+		err := googlechat.Preflight(ctx, sink.Transport, webHook)
+		cancel()
+		if err != nil {
+			return fmt.Errorf("GoogleChatSink: chat_preflight: %s", err)
+		}
+	}
+
+	text, err := prepareChatMessage(sink.InputDir, sink.Request, sink.GitRef,
+		sink.PrevState, sink.Branch, sink.Tag)
 	if err != nil {
 		return fmt.Errorf("GoogleChatSink: %s", err)
 	}
 
+	texts := []string{text}
+	if sink.Request.Source.ChatSplitLongMessages {
+		texts = splitMessage(text, googlechat.MaxTextLen)
+	}
+
 	threadKey := fmt.Sprintf("%s %s", sink.Request.Env.BuildPipelineName, sink.GitRef)
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
-	reply, err := googlechat.TextMessage(ctx, webHook, threadKey, text)
-	if err != nil {
-		return fmt.Errorf("GoogleChatSink: %s", err)
+	for _, text := range texts {
+		ctx, cancel := context.WithTimeout(orBackground(sink.Ctx), timeout)
+		reply, err := googlechat.TextMessage(ctx, sink.Transport, webHook, threadKey, text)
+		cancel()
+		if err != nil {
+			return fmt.Errorf("GoogleChatSink: %s", err)
+		}
+
+		sink.Log.Info("state posted successfully to chat",
+			"state", state, "space", reply.Space.DisplayName,
+			"sender", reply.Sender.DisplayName, "text", text)
 	}
 
-	sink.Log.Info("state posted successfully to chat",
-		"state", state, "space", reply.Space.DisplayName,
-		"sender", reply.Sender.DisplayName, "text", text)
 	return nil
 }
 
 // shouldSendToChat returns true if the state is configured to do so.
 func shouldSendToChat(request PutRequest) bool {
-	if request.Params.ChatMessage != "" || request.Params.ChatMessageFile != "" {
+	if request.Params.ChatMessage != "" || len(request.Params.ChatMessageFile) > 0 ||
+		request.Params.ChatDigestFromDir != "" {
 		return true
 	}
-	for _, x := range request.Source.ChatNotifyOnStates {
-		if request.Params.State == x {
-			return true
+	return stateIn(request.Params.State, request.Source.ChatNotifyOnStates)
+}
+
+// isDefaultNotifyStates returns true if states is the default of
+// source.chat_notify_on_states.
+func isDefaultNotifyStates(states []BuildState) bool {
+	if len(states) != len(defaultNotifyStates) {
+		return false
+	}
+	for i, state := range states {
+		if state != defaultNotifyStates[i] {
+			return false
 		}
 	}
-	return false
+	return true
+}
+
+// splitMessage splits text, if longer than limit characters, into parts of at most limit
+// characters, each prefixed by a marker like "(1/3)". It splits on line boundaries,
+// unless a single line is longer than a part.
+func splitMessage(text string, limit int) []string {
+	if len([]rune(text)) <= limit {
+		return []string{text}
+	}
+
+	// Reserve room for the marker, assuming less than 100 parts.
+	const markerLen = len("(99/99)\n")
+	room := limit - markerLen
+
+	var parts []string
+	var part []rune
+	for _, line := range strings.SplitAfter(text, "\n") {
+		runes := []rune(line)
+		if len(part)+len(runes) > room && len(part) > 0 {
+			parts = append(parts, string(part))
+			part = nil
+		}
+		for len(runes) > room {
+			parts = append(parts, string(runes[:room]))
+			runes = runes[room:]
+		}
+		part = append(part, runes...)
+	}
+	if len(part) > 0 {
+		parts = append(parts, string(part))
+	}
+
+	for i, part := range parts {
+		parts[i] = fmt.Sprintf("(%d/%d)\n%s", i+1, len(parts), part)
+	}
+	return parts
 }
 
 // prepareChatMessage returns a message ready to be sent to the chat sink.
+// Parameter prevState, if not empty, is the previous state, shown in the build summary.
+// Parameters branch and tag are passed to the template of source.chat_footer.
 func prepareChatMessage(inputDir fs.FS, request PutRequest, gitRef string,
+	prevState BuildState, branch, tag string,
 ) (string, error) {
 	params := request.Params
 
@@ -83,25 +233,97 @@ func prepareChatMessage(inputDir fs.FS, request PutRequest, gitRef string,
 	if params.ChatMessage != "" {
 		parts = append(parts, params.ChatMessage)
 	}
-	if params.ChatMessageFile != "" {
-		contents, err := fs.ReadFile(inputDir, params.ChatMessageFile)
+	for _, msgFile := range params.ChatMessageFile {
+		contents, err := fs.ReadFile(inputDir, msgFile)
 		if err != nil {
 			return "", fmt.Errorf("reading chat_message_file: %s", err)
 		}
+		if params.NormalizeLineEndings {
+			contents = bytes.ReplaceAll(contents, []byte("\r\n"), []byte("\n"))
+		}
 		parts = append(parts, string(contents))
 	}
+	if params.ChatDigestFromDir != "" {
+		digest, err := chatDigest(inputDir, params.ChatDigestFromDir)
+		if err != nil {
+			return "", err
+		}
+		parts = append(parts, digest)
+	}
 
 	if len(parts) == 0 || (len(parts) > 0 && params.ChatAppendSummary) {
 		parts = append(
 			parts,
-			gChatBuildSummaryText(gitRef, params.State, request.Source, request.Env))
+			gChatBuildSummaryText(gitRef, prevState, params.State,
+				buildDuration(params, time.Now()), request.Source, request.Env))
+	}
+	if len(params.ArtifactURLs) > 0 {
+		parts = append(parts, chatArtifacts(params.ArtifactURLs))
+	}
+	if footer := request.Source.ChatFooter; footer != "" {
+		text, err := renderTemplate("chat_footer", footer,
+			ChatFooterData{Environment: request.Env, Branch: branch, Tag: tag})
+		if err != nil {
+			return "", fmt.Errorf("chat_footer: %s", err)
+		}
+		if strings.TrimSpace(text) != "" {
+			parts = append(parts, text)
+		}
 	}
 
 	return strings.Join(parts, "\n\n"), nil
 }
 
+// chatArtifacts returns the bulleted list of links of params.artifact_urls.
+func chatArtifacts(urls []string) string {
+	var bld strings.Builder
+	bld.WriteString("*artifacts*")
+	for _, u := range urls {
+		fmt.Fprintf(&bld, "\n• %s", u)
+	}
+	return bld.String()
+}
+
+// chatDigest returns a digest of the states recorded in directory dir of inputDir (see
+// params.chat_digest_from_dir). The convention is one file per recorded state: the file
+// name is what the state refers to (for example the name of a job or of a task) and
+// the contents is the build state. The entries are sorted by name.
+func chatDigest(inputDir fs.FS, dir string) (string, error) {
+	entries, err := fs.ReadDir(inputDir, dir)
+	if err != nil {
+		return "", fmt.Errorf("reading chat_digest_from_dir: %s", err)
+	}
+
+	var bld strings.Builder
+	bld.WriteString("*digest*")
+	count := 0
+	for _, entry := range entries {
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		contents, err := fs.ReadFile(inputDir, path.Join(dir, entry.Name()))
+		if err != nil {
+			return "", fmt.Errorf("reading chat_digest_from_dir: %s", err)
+		}
+		state := BuildState(strings.TrimSpace(string(contents)))
+		if !stateIn(state, allStates) {
+			return "", fmt.Errorf("chat_digest_from_dir: %s: invalid build state: %s",
+				entry.Name(), state)
+		}
+		fmt.Fprintf(&bld, "\n%s %s", decorateState(state), entry.Name())
+		count++
+	}
+	if count == 0 {
+		bld.WriteString(" no recorded states")
+	}
+	return bld.String(), nil
+}
+
 // gChatBuildSummaryText returns a plain text message to be sent to Google Chat.
-func gChatBuildSummaryText(gitRef string, state BuildState, src Source, env Environment,
+// If prevState is not empty, the state is rendered as a transition from prevState.
+// If duration is not empty, it is shown as the build duration.
+func gChatBuildSummaryText(gitRef string, prevState, state BuildState, duration string,
+	src Source, env Environment,
 ) string {
 	now := time.Now().Format("2006-01-02 15:04:05 MST")
 
@@ -115,6 +337,10 @@ func gChatBuildSummaryText(gitRef string, state BuildState, src Source, env Envi
 		src.Owner, src.Repo, gitRef)
 	commit := fmt.Sprintf("<%s|%.10s> (repo: %s/%s)",
 		commitUrl, gitRef, src.Owner, src.Repo)
+	if src.Owner == "" && src.Repo == "" {
+		// Possible if the github sink is not active, see source.sinks.
+		commit = fmt.Sprintf("%.10s", gitRef)
+	}
 
 	// Unfortunately the font is proportional and doesn't support tabs,
 	// so we cannot align in columns.
@@ -122,7 +348,15 @@ func gChatBuildSummaryText(gitRef string, state BuildState, src Source, env Envi
 	fmt.Fprintf(&bld, "%s\n", now)
 	fmt.Fprintf(&bld, "*pipeline* %s\n", env.BuildPipelineName)
 	fmt.Fprintf(&bld, "*job* %s\n", job)
-	fmt.Fprintf(&bld, "*state* %s\n", decorateState(state))
+	if prevState != "" {
+		fmt.Fprintf(&bld, "*state* %s → %s\n", decorateState(prevState),
+			decorateState(state))
+	} else {
+		fmt.Fprintf(&bld, "*state* %s\n", decorateState(state))
+	}
+	if duration != "" {
+		fmt.Fprintf(&bld, "*duration* %s\n", duration)
+	}
 	fmt.Fprintf(&bld, "*commit* %s\n", commit)
 
 	return bld.String()
@@ -141,6 +375,12 @@ func decorateState(state BuildState) string {
 		icon = "🟡"
 	case StateSuccess:
 		icon = "🟢"
+	case StateSkipped:
+		icon = "⚪"
+	case StateQueued:
+		icon = "⏳"
+	case StateNeutral:
+		icon = "🔵"
 	default:
 		icon = "❓"
 	}
@@ -1,9 +1,11 @@
 package cogito
 
 import (
+	"io/fs"
 	"strings"
 	"testing"
 	"testing/fstest"
+	"time"
 
 	"gotest.tools/v3/assert"
 	"gotest.tools/v3/assert/cmp"
@@ -63,6 +65,20 @@ func TestShouldSendToChatCustomConfig(t *testing.T) {
 	}
 }
 
+func TestShouldSendToChatEmptyConfig(t *testing.T) {
+	for _, state := range []BuildState{
+		StateAbort, StateError, StateFailure, StatePending, StateSuccess,
+	} {
+		t.Run(string(state), func(t *testing.T) {
+			request := PutRequest{}
+			request.Source.ChatNotifyOnStates = []BuildState{}
+			request.Params.State = state
+
+			assert.Equal(t, shouldSendToChat(request), false)
+		})
+	}
+}
+
 func TestPrepareChatMessageSuccess(t *testing.T) {
 	type testCase struct {
 		name        string
@@ -92,7 +108,7 @@ func TestPrepareChatMessageSuccess(t *testing.T) {
 	customFile := "from-custom-file"
 
 	test := func(t *testing.T, tc testCase) {
-		have, err := prepareChatMessage(tc.inputDir, tc.makeReq(), baseGitRef)
+		have, err := prepareChatMessage(tc.inputDir, tc.makeReq(), baseGitRef, "", "", "")
 
 		assert.NilError(t, err)
 		for _, elem := range tc.wantPresent {
@@ -108,7 +124,17 @@ func TestPrepareChatMessageSuccess(t *testing.T) {
 			name:        "build summary only",
 			makeReq:     func() PutRequest { return baseRequest },
 			wantPresent: buildSummary,
-			wantAbsent:  []string{customMessage},
+			wantAbsent:  []string{customMessage, "*duration*"},
+		},
+		{
+			name: "started_at adds the build duration",
+			makeReq: func() PutRequest {
+				req := baseRequest
+				req.Params.StartedAt = time.Now().Add(-2*time.Hour - 3*time.Minute).
+					Format(time.RFC3339)
+				return req
+			},
+			wantPresent: append([]string{"*duration* 2h 3m"}, buildSummary...),
 		},
 		{
 			name: "chat_message, all defaults",
@@ -134,7 +160,7 @@ func TestPrepareChatMessageSuccess(t *testing.T) {
 			name: "chat_message_file, all defaults",
 			makeReq: func() PutRequest {
 				req := baseRequest
-				req.Params.ChatMessageFile = "registration/msg.txt"
+				req.Params.ChatMessageFile = FileList{"registration/msg.txt"}
 				return req
 			},
 			inputDir: fstest.MapFS{
@@ -147,7 +173,7 @@ func TestPrepareChatMessageSuccess(t *testing.T) {
 			name: "chat_message_file, params.append false",
 			makeReq: func() PutRequest {
 				req := baseRequest
-				req.Params.ChatMessageFile = "registration/msg.txt"
+				req.Params.ChatMessageFile = FileList{"registration/msg.txt"}
 				req.Params.ChatAppendSummary = false
 				return req
 			},
@@ -162,7 +188,7 @@ func TestPrepareChatMessageSuccess(t *testing.T) {
 			makeReq: func() PutRequest {
 				req := baseRequest
 				req.Params.ChatMessage = customMessage
-				req.Params.ChatMessageFile = "registration/msg.txt"
+				req.Params.ChatMessageFile = FileList{"registration/msg.txt"}
 				return req
 			},
 			inputDir: fstest.MapFS{
@@ -175,7 +201,7 @@ func TestPrepareChatMessageSuccess(t *testing.T) {
 			makeReq: func() PutRequest {
 				req := baseRequest
 				req.Params.ChatMessage = customMessage
-				req.Params.ChatMessageFile = "registration/msg.txt"
+				req.Params.ChatMessageFile = FileList{"registration/msg.txt"}
 				req.Params.ChatAppendSummary = false
 				return req
 			},
@@ -185,6 +211,40 @@ func TestPrepareChatMessageSuccess(t *testing.T) {
 			wantPresent: []string{customMessage, customFile},
 			wantAbsent:  buildSummary,
 		},
+		{
+			name: "chat_message_file, list of files",
+			makeReq: func() PutRequest {
+				req := baseRequest
+				req.Params.ChatMessageFile = FileList{"tests/summary.txt", "coverage/summary.txt"}
+				req.Params.ChatAppendSummary = false
+				return req
+			},
+			inputDir: fstest.MapFS{
+				"tests/summary.txt":    {Data: []byte("42 tests passed")},
+				"coverage/summary.txt": {Data: []byte("coverage: 87%")},
+			},
+			wantPresent: []string{"42 tests passed\n\ncoverage: 87%"},
+			wantAbsent:  buildSummary,
+		},
+		{
+			name: "chat_digest_from_dir lists all the recorded states",
+			makeReq: func() PutRequest {
+				req := baseRequest
+				req.Params.ChatDigestFromDir = "digest"
+				return req
+			},
+			inputDir: fstest.MapFS{
+				"digest/unit-tests":  {Data: []byte("success\n")},
+				"digest/lint":        {Data: []byte("failure")},
+				"digest/deploy":      {Data: []byte("skipped\n")},
+				"digest/.keep":       {Data: []byte("")},
+				"digest/sub/ignored": {Data: []byte("error")},
+			},
+			wantPresent: append([]string{
+				"*digest*\n⚪ skipped deploy\n🔴 failure lint\n🟢 success unit-tests",
+			}, buildSummary...),
+			wantAbsent: []string{"ignored"},
+		},
 	}
 
 	for _, tc := range testCases {
@@ -193,15 +253,67 @@ func TestPrepareChatMessageSuccess(t *testing.T) {
 }
 
 func TestPrepareChatMessageFailure(t *testing.T) {
-	request := PutRequest{Params: PutParams{ChatMessageFile: "foo/msg.txt"}}
+	request := PutRequest{Params: PutParams{ChatMessageFile: FileList{"foo/msg.txt"}}}
 	inputDir := fstest.MapFS{"bar/msg.txt": {Data: []byte("from-custom-file")}}
 
-	_, err := prepareChatMessage(inputDir, request, "deadbeef")
+	_, err := prepareChatMessage(inputDir, request, "deadbeef", "", "", "")
 
 	assert.Error(t, err,
 		"reading chat_message_file: open foo/msg.txt: file does not exist")
 }
 
+func TestPrepareChatMessageListOfFilesFailure(t *testing.T) {
+	request := PutRequest{
+		Params: PutParams{ChatMessageFile: FileList{"tests/summary.txt", "foo/msg.txt"}},
+	}
+	inputDir := fstest.MapFS{"tests/summary.txt": {Data: []byte("42 tests passed")}}
+
+	_, err := prepareChatMessage(inputDir, request, "deadbeef", "", "", "")
+
+	assert.Error(t, err,
+		"reading chat_message_file: open foo/msg.txt: file does not exist")
+}
+
+func TestChatDigestEmpty(t *testing.T) {
+	inputDir := fstest.MapFS{"digest": {Mode: fs.ModeDir}}
+
+	have, err := chatDigest(inputDir, "digest")
+
+	assert.NilError(t, err)
+	assert.Equal(t, have, "*digest* no recorded states")
+}
+
+func TestChatDigestFailure(t *testing.T) {
+	type testCase struct {
+		name     string
+		inputDir fstest.MapFS
+		wantErr  string
+	}
+
+	test := func(t *testing.T, tc testCase) {
+		_, err := chatDigest(tc.inputDir, "digest")
+
+		assert.Error(t, err, tc.wantErr)
+	}
+
+	testCases := []testCase{
+		{
+			name:     "missing directory",
+			inputDir: fstest.MapFS{},
+			wantErr:  "reading chat_digest_from_dir: open digest: file does not exist",
+		},
+		{
+			name:     "invalid build state",
+			inputDir: fstest.MapFS{"digest/lint": {Data: []byte("burnt-pizza")}},
+			wantErr:  "chat_digest_from_dir: lint: invalid build state: burnt-pizza",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) { test(t, tc) })
+	}
+}
+
 func TestGChatBuildSummaryText(t *testing.T) {
 	commit := "deadbeef"
 	state := StatePending
@@ -216,7 +328,7 @@ func TestGChatBuildSummaryText(t *testing.T) {
 		AtcExternalUrl:    "https://cogito.invalid",
 	}
 
-	have := gChatBuildSummaryText(commit, state, src, env)
+	have := gChatBuildSummaryText(commit, "", state, "", src, env)
 
 	assert.Assert(t, cmp.Contains(have, "*pipeline* the-pipeline"))
 	assert.Assert(t, cmp.Regexp(`\*job\* <https:.+\|the-job\/42>`, have))
@@ -226,6 +338,82 @@ func TestGChatBuildSummaryText(t *testing.T) {
 		have))
 }
 
+func TestGChatBuildSummaryTextTransition(t *testing.T) {
+	type testCase struct {
+		name      string
+		prevState BuildState
+		want      string
+	}
+
+	test := func(t *testing.T, tc testCase) {
+		have := gChatBuildSummaryText("deadbeef", tc.prevState, StateSuccess, "",
+			Source{}, Environment{})
+
+		assert.Assert(t, cmp.Contains(have, tc.want))
+	}
+
+	testCases := []testCase{
+		{
+			name:      "previous state present",
+			prevState: StatePending,
+			want:      "*state* 🟡 pending → 🟢 success\n",
+		},
+		{
+			name: "no previous state",
+			want: "*state* 🟢 success\n",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) { test(t, tc) })
+	}
+}
+
+func TestSplitMessage(t *testing.T) {
+	type testCase struct {
+		name string
+		text string
+		want []string
+	}
+
+	// Room for the text of a part: 22 - len("(99/99)\n") = 14.
+	const limit = 22
+
+	test := func(t *testing.T, tc testCase) {
+		have := splitMessage(tc.text, limit)
+
+		assert.DeepEqual(t, have, tc.want)
+	}
+
+	testCases := []testCase{
+		{
+			name: "fits: no marker",
+			text: "line 1\nline 2\n",
+			want: []string{"line 1\nline 2\n"},
+		},
+		{
+			name: "split on line boundaries",
+			text: "line 1\nline 2\nline 3\nline 4\n",
+			want: []string{
+				"(1/2)\nline 1\nline 2\n",
+				"(2/2)\nline 3\nline 4\n",
+			},
+		},
+		{
+			name: "line longer than a part",
+			text: "0123456789abcdefghij\nend",
+			want: []string{
+				"(1/2)\n0123456789abcd",
+				"(2/2)\nefghij\nend",
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) { test(t, tc) })
+	}
+}
+
 func TestStateToIcon(t *testing.T) {
 	type testCase struct {
 		state BuildState
@@ -242,6 +430,9 @@ func TestStateToIcon(t *testing.T) {
 		{state: StateFailure, want: "🔴 failure"},
 		{state: StatePending, want: "🟡 pending"},
 		{state: StateSuccess, want: "🟢 success"},
+		{state: StateSkipped, want: "⚪ skipped"},
+		{state: StateQueued, want: "⏳ queued"},
+		{state: StateNeutral, want: "🔵 neutral"},
 		{state: BuildState("impossible"), want: "❓ impossible"},
 	}
 
@@ -1,11 +1,16 @@
 package cogito_test
 
 import (
+	"bytes"
+	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"strings"
 	"testing"
 	"testing/fstest"
+	"time"
 
 	"github.com/Pix4D/cogito/cogito"
 	"github.com/Pix4D/cogito/googlechat"
@@ -71,6 +76,127 @@ func TestSinkGoogleChatSendSuccess(t *testing.T) {
 	}
 }
 
+func TestSinkGoogleChatOncePerBuild(t *testing.T) {
+	type testCase struct {
+		name         string
+		state        cogito.BuildState
+		terminalSent bool
+		wantSent     bool
+	}
+
+	test := func(t *testing.T, tc testCase) {
+		var message googlechat.BasicMessage
+		var URL *url.URL
+		ts := testhelp.SpyHttpServer(&message, googlechat.MessageReply{}, &URL,
+			http.StatusOK)
+		request := basePutRequest
+		request.Source.GChatWebHook = ts.URL
+		request.Source.GChatOncePerBuild = true
+		request.Source.ChatNotifyOnStates = []cogito.BuildState{
+			cogito.StatePending, cogito.StateSuccess, cogito.StateFailure}
+		request.Params.State = tc.state
+		request.Env.BuildId = "1234"
+		sink := cogito.GoogleChatSink{
+			Log:          hclog.NewNullLogger(),
+			GitRef:       "deadbeef",
+			Request:      request,
+			TerminalSent: tc.terminalSent,
+		}
+
+		err := sink.Send()
+
+		assert.NilError(t, err)
+		ts.Close() // Avoid races before the following asserts.
+		assert.Equal(t, URL != nil, tc.wantSent)
+	}
+
+	testCases := []testCase{
+		{
+			name:     "intermediate pending is suppressed",
+			state:    cogito.StatePending,
+			wantSent: false,
+		},
+		{
+			name:     "first terminal state is sent",
+			state:    cogito.StateSuccess,
+			wantSent: true,
+		},
+		{
+			name:         "terminal state already sent by the build is suppressed",
+			state:        cogito.StateFailure,
+			terminalSent: true,
+			wantSent:     false,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) { test(t, tc) })
+	}
+}
+
+func TestSinkGoogleChatNotifyOnChangeGitHub(t *testing.T) {
+	type testCase struct {
+		name      string
+		prevState string
+		state     cogito.BuildState
+		wantSent  bool
+	}
+
+	test := func(t *testing.T, tc testCase) {
+		var message googlechat.BasicMessage
+		var URL *url.URL
+		ts := testhelp.SpyHttpServer(&message, googlechat.MessageReply{}, &URL,
+			http.StatusOK)
+		request := basePutRequest
+		request.Source.GChatWebHook = ts.URL
+		request.Source.ChatNotifyOnChange = true
+		request.Params.State = tc.state
+		assert.NilError(t, request.Source.Validate())
+		sink := cogito.GoogleChatSink{
+			Log:             hclog.NewNullLogger(),
+			GitRef:          "deadbeef",
+			Request:         request,
+			PrevGitHubState: tc.prevState,
+		}
+
+		err := sink.Send()
+
+		assert.NilError(t, err)
+		ts.Close() // Avoid races before the following asserts.
+		assert.Equal(t, URL != nil, tc.wantSent)
+	}
+
+	testCases := []testCase{
+		{
+			name:      "unchanged state is suppressed",
+			prevState: "failure",
+			state:     cogito.StateFailure,
+			wantSent:  false,
+		},
+		{
+			name:      "abort is unchanged from error",
+			prevState: "error",
+			state:     cogito.StateAbort,
+			wantSent:  false,
+		},
+		{
+			name:      "changed state is sent",
+			prevState: "success",
+			state:     cogito.StateFailure,
+			wantSent:  true,
+		},
+		{
+			name:     "unknown previous state is sent",
+			state:    cogito.StateFailure,
+			wantSent: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) { test(t, tc) })
+	}
+}
+
 func TestSinkGoogleChatDecidesNotToSendSuccess(t *testing.T) {
 	type testCase struct {
 		name    string
@@ -105,6 +231,236 @@ func TestSinkGoogleChatDecidesNotToSendSuccess(t *testing.T) {
 		},
 	}
 
+	t.Run("skip_notify_trailer found in commit message", func(t *testing.T) {
+		sink := cogito.GoogleChatSink{
+			Log: hclog.NewNullLogger(),
+			Request: cogito.PutRequest{
+				Source: cogito.Source{
+					GChatWebHook:      "https://cogito.invalid",
+					SkipNotifyTrailer: "Cogito-Skip-Notify",
+				},
+				Params: cogito.PutParams{State: cogito.StateError}, // sent by default
+			},
+			SkipNotify: true,
+		}
+
+		assert.NilError(t, sink.Send())
+	})
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) { test(t, tc) })
+	}
+}
+
+func TestSinkGoogleChatNormalizeLineEndings(t *testing.T) {
+	type testCase struct {
+		name      string
+		normalize bool
+		wantText  string
+	}
+
+	test := func(t *testing.T, tc testCase) {
+		var message googlechat.BasicMessage
+		var URL *url.URL
+		ts := testhelp.SpyHttpServer(&message, googlechat.MessageReply{}, &URL,
+			http.StatusOK)
+		request := basePutRequest
+		request.Source.GChatWebHook = ts.URL
+		request.Params.ChatMessageFile = cogito.FileList{"msgdir/msg.txt"}
+		request.Params.ChatAppendSummary = false
+		request.Params.NormalizeLineEndings = tc.normalize
+		assert.NilError(t, request.Source.Validate())
+		sink := cogito.GoogleChatSink{
+			Log: hclog.NewNullLogger(),
+			InputDir: fstest.MapFS{
+				"msgdir/msg.txt": {Data: []byte("line 1\r\nline 2\r\n\r\n")},
+			},
+			GitRef:  "deadbeef",
+			Request: request,
+		}
+
+		err := sink.Send()
+
+		assert.NilError(t, err)
+		ts.Close() // Avoid races before the following asserts.
+		assert.Equal(t, message.Text, tc.wantText)
+	}
+
+	testCases := []testCase{
+		{
+			name:      "normalize",
+			normalize: true,
+			wantText:  "line 1\nline 2\n\n",
+		},
+		{
+			name:      "leave as-is",
+			normalize: false,
+			wantText:  "line 1\r\nline 2\r\n\r\n",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) { test(t, tc) })
+	}
+}
+
+func TestSinkGoogleChatArtifactURLs(t *testing.T) {
+	var message googlechat.BasicMessage
+	var URL *url.URL
+	ts := testhelp.SpyHttpServer(&message, googlechat.MessageReply{}, &URL, http.StatusOK)
+	request := basePutRequest
+	request.Source.GChatWebHook = ts.URL
+	request.Params.ChatMessage = "the message"
+	request.Params.ArtifactURLs = []string{
+		"https://example.com/builds/42/app.zip",
+		"https://example.com/builds/42/report.html",
+	}
+	assert.NilError(t, request.Source.Validate())
+	assert.NilError(t, request.Params.Validate())
+	sink := cogito.GoogleChatSink{
+		Log:     hclog.NewNullLogger(),
+		GitRef:  "deadbeef",
+		Request: request,
+	}
+
+	err := sink.Send()
+
+	assert.NilError(t, err)
+	ts.Close() // Avoid races before the following asserts.
+	assert.Equal(t, message.Text, `the message
+
+*artifacts*
+• https://example.com/builds/42/app.zip
+• https://example.com/builds/42/report.html`)
+}
+
+func TestSinkGoogleChatFooter(t *testing.T) {
+	var message googlechat.BasicMessage
+	var URL *url.URL
+	ts := testhelp.SpyHttpServer(&message, googlechat.MessageReply{}, &URL, http.StatusOK)
+	request := basePutRequest
+	request.Source.GChatWebHook = ts.URL
+	request.Source.ChatFooter = "Reported by Cogito • pipeline {{ .BuildPipelineName }}"
+	request.Params.ChatMessage = "the message"
+	request.Env.BuildPipelineName = "the-pipeline"
+	assert.NilError(t, request.Source.Validate())
+	sink := cogito.GoogleChatSink{
+		Log:     hclog.NewNullLogger(),
+		GitRef:  "deadbeef",
+		Request: request,
+	}
+
+	err := sink.Send()
+
+	assert.NilError(t, err)
+	ts.Close() // Avoid races before the following asserts.
+	assert.Equal(t, message.Text, `the message
+
+Reported by Cogito • pipeline the-pipeline`)
+}
+
+func TestSinkGoogleChatSplitLongMessages(t *testing.T) {
+	var texts []string
+	ts := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			var message googlechat.BasicMessage
+			if err := json.NewDecoder(req.Body).Decode(&message); err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			texts = append(texts, message.Text)
+			fmt.Fprintln(w, "{}")
+		}))
+	// Each line takes most of a message, so each part contains only one line.
+	line := strings.Repeat("x", googlechat.MaxTextLen*3/4) + "\n"
+	request := basePutRequest
+	request.Source.GChatWebHook = ts.URL
+	request.Source.ChatSplitLongMessages = true
+	request.Params.ChatMessage = strings.Repeat(line, 3)
+	request.Params.ChatAppendSummary = false
+	assert.NilError(t, request.Source.Validate())
+	sink := cogito.GoogleChatSink{
+		Log:     hclog.NewNullLogger(),
+		GitRef:  "deadbeef",
+		Request: request,
+	}
+
+	err := sink.Send()
+
+	assert.NilError(t, err)
+	ts.Close() // Avoid races before the following asserts.
+	assert.Equal(t, len(texts), 3)
+	for i, text := range texts {
+		assert.Equal(t, text, fmt.Sprintf("(%d/3)\n", i+1)+line)
+	}
+}
+
+func TestSinkGoogleChatIfNever(t *testing.T) {
+	type testCase struct {
+		name         string
+		notifyStates []cogito.BuildState
+		warnIfNever  bool
+		errorIfNever bool
+		wantLog      string
+		wantErr      string
+	}
+
+	test := func(t *testing.T, tc testCase) {
+		var logBuf bytes.Buffer
+		request := basePutRequest
+		request.Source.GChatWebHook = "https://cogito.invalid"
+		request.Source.ChatNotifyOnStates = tc.notifyStates
+		request.Source.ChatWarnIfNever = tc.warnIfNever
+		request.Source.ChatErrorIfNever = tc.errorIfNever
+		request.Params.State = cogito.StatePending
+		assert.NilError(t, request.Source.Validate())
+		sink := cogito.GoogleChatSink{
+			Log:     hclog.New(&hclog.LoggerOptions{Output: &logBuf}),
+			Request: request,
+		}
+
+		err := sink.Send()
+
+		if tc.wantErr != "" {
+			assert.Error(t, err, tc.wantErr)
+		} else {
+			assert.NilError(t, err)
+		}
+		if tc.wantLog != "" {
+			assert.Assert(t, cmp.Contains(logBuf.String(), tc.wantLog))
+		} else {
+			assert.Assert(t, !strings.Contains(logBuf.String(), "[WARN]"),
+				"log: %s", logBuf.String())
+		}
+	}
+
+	testCases := []testCase{
+		{
+			name:        "warn: default states are not checked",
+			warnIfNever: true,
+		},
+		{
+			name:         "warn: state not in states",
+			notifyStates: []cogito.BuildState{cogito.StateFailure},
+			warnIfNever:  true,
+			wantLog:      "[WARN]  not sending to chat: reason=\"state not in chat_notify_on_states\" state=pending",
+		},
+		{
+			name:         "error: default states are not checked",
+			errorIfNever: true,
+		},
+		{
+			name:         "error: state not in states",
+			notifyStates: []cogito.BuildState{cogito.StateFailure},
+			errorIfNever: true,
+			wantErr:      "GoogleChatSink: state pending not in chat_notify_on_states [failure] (chat_error_if_never is set)",
+		},
+		{
+			name:         "neither: state not in states",
+			notifyStates: []cogito.BuildState{cogito.StateFailure},
+		},
+	}
+
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) { test(t, tc) })
 	}
@@ -131,7 +487,7 @@ func TestSinkGoogleChatSendBackendFailure(t *testing.T) {
 
 func TestSinkGoogleChatSendInputFailure(t *testing.T) {
 	request := basePutRequest
-	request.Params.ChatMessageFile = "foo/msg.txt"
+	request.Params.ChatMessageFile = cogito.FileList{"foo/msg.txt"}
 	request.Source.GChatWebHook = "dummy-url"
 	assert.NilError(t, request.Source.Validate())
 	sink := cogito.GoogleChatSink{
@@ -144,3 +500,107 @@ func TestSinkGoogleChatSendInputFailure(t *testing.T) {
 
 	assert.ErrorContains(t, err, "GoogleChatSink: reading chat_message_file: open")
 }
+
+func TestSinkGoogleChatPreflightSuccess(t *testing.T) {
+	var methods []string
+	ts := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			methods = append(methods, req.Method)
+			if req.Method == http.MethodHead {
+				// Not all servers support HEAD.
+				w.WriteHeader(http.StatusMethodNotAllowed)
+				return
+			}
+			fmt.Fprint(w, "{}")
+		}))
+	request := basePutRequest
+	request.Source.GChatWebHook = ts.URL
+	request.Source.ChatPreflight = true
+	assert.NilError(t, request.Source.Validate())
+	sink := cogito.GoogleChatSink{
+		Log:     hclog.NewNullLogger(),
+		GitRef:  "deadbeef",
+		Request: request,
+	}
+
+	err := sink.Send()
+
+	assert.NilError(t, err)
+	ts.Close() // Avoid races before the following asserts.
+	assert.DeepEqual(t, methods, []string{http.MethodHead, http.MethodPost})
+}
+
+func TestSinkGoogleChatPreflightFailure(t *testing.T) {
+	ts := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {}))
+	ts.Close() // Make the webhook unreachable.
+	request := basePutRequest
+	request.Source.GChatWebHook = ts.URL + "/v1/spaces/x?key=sensitive-key"
+	request.Source.ChatPreflight = true
+	// The preflight must short-circuit the send before the message is built, so
+	// reading this non-existing file is never attempted.
+	request.Params.ChatMessageFile = cogito.FileList{"foo/msg.txt"}
+	assert.NilError(t, request.Source.Validate())
+	sink := cogito.GoogleChatSink{
+		Log:      hclog.NewNullLogger(),
+		InputDir: fstest.MapFS{},
+		GitRef:   "deadbeef",
+		Request:  request,
+	}
+
+	err := sink.Send()
+
+	assert.ErrorContains(t, err,
+		"GoogleChatSink: chat_preflight: Preflight: webhook unreachable: ")
+	assert.Assert(t, !strings.Contains(err.Error(), "sensitive"), "err: %s", err)
+}
+
+func TestSinkGoogleChatTimeout(t *testing.T) {
+	type testCase struct {
+		name       string
+		setTimeout func(src *cogito.Source)
+		wantErr    string
+	}
+
+	test := func(t *testing.T, tc testCase) {
+		ts := httptest.NewServer(
+			http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				time.Sleep(300 * time.Millisecond)
+				fmt.Fprint(w, "{}")
+			}))
+		defer ts.Close()
+		request := basePutRequest
+		request.Source.GChatWebHook = ts.URL
+		tc.setTimeout(&request.Source)
+		assert.NilError(t, request.Source.Validate())
+		sink := cogito.GoogleChatSink{
+			Log:     hclog.NewNullLogger(),
+			GitRef:  "deadbeef",
+			Request: request,
+		}
+
+		err := sink.Send()
+
+		if tc.wantErr == "" {
+			assert.NilError(t, err)
+		} else {
+			assert.ErrorContains(t, err, tc.wantErr)
+		}
+	}
+
+	testCases := []testCase{
+		{
+			name:       "gchat_timeout is used",
+			setTimeout: func(src *cogito.Source) { src.GChatTimeout = "50ms" },
+			wantErr:    "context deadline exceeded",
+		},
+		{
+			name:       "default timeout, not the timeout of another sink",
+			setTimeout: func(src *cogito.Source) { src.GitHubTimeout = "50ms" },
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) { test(t, tc) })
+	}
+}
@@ -1,16 +1,55 @@
 package cogito
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"strings"
+	"time"
+
 	"github.com/Pix4D/cogito/github"
 	"github.com/hashicorp/go-hclog"
 )
 
+// ghMaxDescriptionLen is the maximum length of the description accepted by the GitHub
+// Commit status API.
+const ghMaxDescriptionLen = 140
+
+// ghMaxStatePrefixLen is the maximum length of a prefix of
+// source.description_state_prefix, to leave most of the description to the build
+// information.
+const ghMaxStatePrefixLen = 32
+
+// ghMaxContextLen is the maximum length of the context accepted by the GitHub Commit
+// status API. See also source.context_overflow.
+const ghMaxContextLen = 255
+
+// ghResponseFile is the name of the file, in the put inputs, where the GitHub Commit
+// status API responses are saved. See params.save_response.
+const ghResponseFile = "github_response.json"
+
 // GitHubCommitStatusSink is an implementation of [Sinker] for the Cogito resource.
 type GitHubCommitStatusSink struct {
 	Log     hclog.Logger
 	GhAPI   string
 	GitRef  string
 	Request PutRequest
+	// ResponseDir, if set, is the directory where to save the API response, in file
+	// ghResponseFile. See params.save_response.
+	ResponseDir string
+	// Pacer, if not nil, paces the requests. It is shared among all the GitHub sinks of
+	// the put step. See source.github_max_rps.
+	Pacer *github.Pacer
+	// Transport sends the HTTP requests; nil means [http.DefaultTransport].
+	Transport http.RoundTripper
+	// Ctx is the context of the put step, see source.put_timeout. Nil means
+	// [context.Background].
+	Ctx context.Context
 }
 
 // Send sets the build status via the GitHub Commit status API endpoint.
@@ -18,47 +57,272 @@ func (sink GitHubCommitStatusSink) Send() error {
 	sink.Log.Debug("send: started")
 	defer sink.Log.Debug("send: finished")
 
+	gitRef := sink.GitRef
+	if sink.Request.Source.VerifySHA {
+		if err := github.CommitExists(sink.GhAPI, sink.Request.Source.AccessToken,
+			sink.Request.Source.Owner, sink.Request.Source.Repo, gitRef,
+			sink.ghOptions()); err != nil {
+			return err
+		}
+	}
+
 	ghState := ghAdaptState(sink.Request.Params.State)
-	buildURL := concourseBuildURL(sink.Request.Env)
+	// Outside of Concourse there is no build page to link to.
+	var buildURL string
+	if sink.Request.Env.InConcourse() {
+		buildURL = concourseBuildURL(sink.Request.Env)
+	}
 	context := ghMakeContext(sink.Request)
+	if n := len([]rune(context)); n > ghMaxContextLen {
+		return fmt.Errorf("context_overflow: context too long: %d characters (max %d)",
+			n, ghMaxContextLen)
+	}
 
 	commitStatus := github.NewCommitStatus(sink.GhAPI, sink.Request.Source.AccessToken,
-		sink.Request.Source.Owner, sink.Request.Source.Repo, context)
-	description := "Build " + sink.Request.Env.BuildName
+		sink.Request.Source.Owner, sink.Request.Source.Repo, context,
+		sink.ghOptions())
+	description := ghMakeDescription(sink.Request, time.Now())
+	if sink.Request.Source.RequireDescription && ghDescriptionEmpty(sink.Request) {
+		return fmt.Errorf("require_description: empty description: " +
+			"no build name, no params.pending_description (state pending) and " +
+			"no params.success_description (state success)")
+	}
 
 	sink.Log.Debug("posting to GitHub Commit Status API",
 		"state", ghState, "owner", sink.Request.Source.Owner,
-		"repo", sink.Request.Source.Repo, "git-ref", sink.GitRef,
+		"repo", sink.Request.Source.Repo, "git-ref", gitRef,
 		"context", context, "buildURL", buildURL, "description", description)
-	if err := commitStatus.Add(sink.GitRef, ghState, buildURL, description); err != nil {
+	// Parse the response only if needed, to not depend on its format otherwise.
+	var status github.Status
+	var err error
+	if sink.ResponseDir != "" {
+		status, err = commitStatus.AddWithResponse(gitRef, ghState, buildURL, description)
+	} else {
+		err = commitStatus.Add(gitRef, ghState, buildURL, description)
+	}
+	if err != nil {
+		if sink.Request.Source.WarnOnMaxStatuses && errors.Is(err, github.ErrMaxStatuses) {
+			sink.Log.Warn("commit status not posted", "reason", err)
+			return nil
+		}
 		return err
 	}
 	sink.Log.Info("commit status posted successfully",
-		"state", ghState, "git-ref", sink.GitRef[0:9])
+		"state", ghState, "git-ref", gitRef[0:9])
+
+	if sink.Request.Source.VerifyAfterPost {
+		verifyAfterPost(sink.Log, commitStatus, gitRef, context, ghState)
+	}
+
+	if sink.ResponseDir != "" {
+		if err := saveResponse(sink.ResponseDir, status); err != nil {
+			return fmt.Errorf("save_response: %s", err)
+		}
+		sink.Log.Debug("saved response", "id", status.ID, "file", ghResponseFile)
+	}
 
 	return nil
 }
 
+// ghOptions returns the options of all the requests to the GitHub API of the sink.
+func (sink GitHubCommitStatusSink) ghOptions() github.Options {
+	return github.Options{
+		Timeout:   sinkTimeout(sink.Request.Source.GitHubTimeout, github.DefaultTimeout),
+		Pacer:     sink.Pacer,
+		Transport: sink.Transport,
+		Context:   sink.Ctx,
+	}
+}
+
+// saveResponse appends status to the JSON array in file ghResponseFile in dir. The file
+// is an array since there can be multiple GitHub sinks (see params.multi_ref_pattern).
+func saveResponse(dir string, status github.Status) error {
+	var statuses []github.Status
+	data, err := readStateFile(dir, ghResponseFile)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+	case err != nil:
+		return err
+	default:
+		if err := json.Unmarshal(data, &statuses); err != nil {
+			return fmt.Errorf("decoding %s: %s", ghResponseFile, err)
+		}
+	}
+	statuses = append(statuses, status)
+	data, err = json.MarshalIndent(statuses, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeStateFile(dir, ghResponseFile, data)
+}
+
 // The states allowed by cogito are more than the states allowed by the GitHub Commit
 // status API. Adapt accordingly.
 func ghAdaptState(state BuildState) string {
-	if state == StateAbort {
+	switch state {
+	case StateAbort:
 		return string(StateError)
+	case StateSkipped:
+		return string(StateSuccess)
+	case StateQueued:
+		return string(StatePending)
+	case StateNeutral:
+		return string(StateSuccess)
+	default:
+		return string(state)
+	}
+}
+
+// verifyAfterPost reads back the commit status just posted and logs a warning if its
+// state is not the one posted, for example because another tool posted to the same
+// context in the meantime (see source.verify_after_post). It doesn't fail the put step.
+func verifyAfterPost(log hclog.Logger, commitStatus github.CommitStatus,
+	gitRef, context, state string,
+) {
+	status, err := commitStatus.LatestStatus(gitRef)
+	if err != nil {
+		log.Warn("verify_after_post: cannot read back the commit status", "reason", err)
+		return
+	}
+	if status.State != state {
+		log.Warn("verify_after_post: the commit status on GitHub differs from the one "+
+			"posted, check for another tool posting to the same context",
+			"posted-state", state, "github-state", status.State,
+			"context", context, "target_url", status.TargetURL,
+			"git-ref", gitRef[0:9])
+		return
 	}
-	return string(state)
+	log.Debug("verify_after_post: commit status verified", "state", state)
 }
 
 // ghMakeContext returns the "context" parameter of the GitHub Commit Status API, based
-// on the fields of request.
+// on the fields of request. If the context is too long, it is shortened according to
+// source.context_overflow; with mode error it is returned as-is and the GitHub sink
+// fails.
 func ghMakeContext(request PutRequest) string {
+	return ghFitContext(ghFullContext(request), request.Source.ContextOverflow)
+}
+
+// ghFitContext returns context shortened to ghMaxContextLen characters according to
+// mode (see source.context_overflow). Mode hash-suffix replaces the tail with a short
+// hash of the whole context, so that two long contexts sharing the same beginning stay
+// distinct.
+func ghFitContext(context, mode string) string {
+	if len([]rune(context)) <= ghMaxContextLen {
+		return context
+	}
+	switch mode {
+	case overflowTruncateTail:
+		return appendWithinLimit(context, "", ghMaxContextLen)
+	case overflowHashSuffix:
+		sum := sha256.Sum256([]byte(context))
+		return appendWithinLimit(context, "-"+hex.EncodeToString(sum[:])[:8],
+			ghMaxContextLen)
+	default:
+		return context
+	}
+}
+
+// ghFullContext returns the context computed from the fields of request, with no limit
+// on its length.
+func ghFullContext(request PutRequest) string {
+	// A full context (context_template, context_by_branch) has no brand, prefix or job
+	// name.
+	if request.Params.fullContext != "" {
+		return request.Params.fullContext
+	}
 	var context string
+	if request.Source.ContextBrand != "" {
+		context = "[" + request.Source.ContextBrand + "] "
+	}
 	if request.Source.ContextPrefix != "" {
-		context = request.Source.ContextPrefix + "/"
+		context += request.Source.ContextPrefix + "/"
 	}
-	if request.Params.Context != "" {
+	switch {
+	case request.Params.Context != "":
 		context += request.Params.Context
-	} else {
+	case request.Source.DefaultContext != "":
+		context += request.Source.DefaultContext
+	case request.Env.BuildJobName != "":
 		context += request.Env.BuildJobName
+	default:
+		// Not a Concourse job, for example fly execute or manual mode.
+		context += request.Source.ManualContext
 	}
 	return context
 }
+
+// ghMakeDescription returns the "description" parameter of the GitHub Commit Status API,
+// based on the fields of request. Parameter now is used only if the description must be
+// annotated with a timestamp.
+func ghMakeDescription(request PutRequest, now time.Time) string {
+	description := "Build " + request.Env.BuildName
+	if request.Params.State == StatePending && request.Params.PendingDescription != "" {
+		description = appendWithinLimit(request.Params.PendingDescription, "",
+			ghMaxDescriptionLen)
+	}
+	if request.Params.State == StateSuccess && request.Params.SuccessDescription != "" {
+		description = appendWithinLimit(request.Params.SuccessDescription, "",
+			ghMaxDescriptionLen)
+	}
+	if request.Params.State == StateSkipped {
+		// GitHub doesn't know state skipped, which is posted as success.
+		description += " (skipped)"
+	}
+	if request.Params.State == StateQueued {
+		// GitHub doesn't know state queued, which is posted as pending.
+		description += " (queued)"
+	}
+	if request.Params.State == StateNeutral {
+		// GitHub doesn't know state neutral, which is posted as success, so that it
+		// doesn't block the required checks.
+		description += " (neutral)"
+	}
+	if duration := buildDuration(request.Params, now); duration != "" {
+		description = appendWithinLimit(description, " in "+duration, ghMaxDescriptionLen)
+	}
+	if pipeline := request.Env.BuildPipelineName; request.Source.DescriptionAppendPipeline &&
+		pipeline != "" {
+		// Keep room for the start of the description, in case the name is long.
+		suffix := appendWithinLimit(" ["+pipeline, "]", ghMaxDescriptionLen/2)
+		description = appendWithinLimit(description, suffix, ghMaxDescriptionLen)
+	}
+	if request.Params.AnnotateTimestamp {
+		description = appendWithinLimit(description, " @ "+now.UTC().Format(time.RFC3339),
+			ghMaxDescriptionLen)
+	}
+	if prefix := request.Source.DescriptionStatePrefix[request.Params.State]; prefix != "" {
+		prefix += " "
+		description = prefix + appendWithinLimit(description, "",
+			ghMaxDescriptionLen-len([]rune(prefix)))
+	}
+	return description
+}
+
+// ghDescriptionEmpty returns true if the description computed by [ghMakeDescription]
+// carries no information, that is, it has neither a build name nor a state-specific
+// description. This happens for example in manual mode.
+func ghDescriptionEmpty(request PutRequest) bool {
+	if request.Params.State == StatePending &&
+		strings.TrimSpace(request.Params.PendingDescription) != "" {
+		return false
+	}
+	if request.Params.State == StateSuccess &&
+		strings.TrimSpace(request.Params.SuccessDescription) != "" {
+		return false
+	}
+	return strings.TrimSpace(request.Env.BuildName) == ""
+}
+
+// appendWithinLimit returns text with suffix appended, truncating text (not suffix) if
+// needed so that the result is at most limit characters.
+func appendWithinLimit(text, suffix string, limit int) string {
+	room := limit - len([]rune(suffix))
+	if room < 0 {
+		room = 0
+	}
+	if runes := []rune(text); len(runes) > room {
+		text = string(runes[:room])
+	}
+	return text + suffix
+}
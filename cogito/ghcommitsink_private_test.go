@@ -1,7 +1,9 @@
 package cogito
 
 import (
+	"strings"
 	"testing"
+	"time"
 
 	"gotest.tools/v3/assert"
 )
@@ -27,6 +29,13 @@ func TestGhMakeContext(t *testing.T) {
 			},
 			wantContext: "the-job",
 		},
+		{
+			name: "no job name: manual_context",
+			request: PutRequest{
+				Source: Source{ManualContext: "the-manual-context"},
+			},
+			wantContext: "the-manual-context",
+		},
 		{
 			name: "context_prefix",
 			request: PutRequest{
@@ -43,6 +52,48 @@ func TestGhMakeContext(t *testing.T) {
 			},
 			wantContext: "the-context",
 		},
+		{
+			name: "default_context overrides job name",
+			request: PutRequest{
+				Source: Source{DefaultContext: "the-default"},
+				Env:    Environment{BuildJobName: "the-job"},
+			},
+			wantContext: "the-default",
+		},
+		{
+			name: "explicit context overrides default_context",
+			request: PutRequest{
+				Source: Source{DefaultContext: "the-default"},
+				Params: PutParams{Context: "the-context"},
+				Env:    Environment{BuildJobName: "the-job"},
+			},
+			wantContext: "the-context",
+		},
+		{
+			name: "prefix and default_context",
+			request: PutRequest{
+				Source: Source{ContextPrefix: "the-prefix", DefaultContext: "the-default"},
+				Env:    Environment{BuildJobName: "the-job"},
+			},
+			wantContext: "the-prefix/the-default",
+		},
+		{
+			name: "context_brand",
+			request: PutRequest{
+				Source: Source{ContextBrand: "cogito"},
+				Env:    Environment{BuildJobName: "the-job"},
+			},
+			wantContext: "[cogito] the-job",
+		},
+		{
+			name: "context_brand, prefix and override",
+			request: PutRequest{
+				Source: Source{ContextBrand: "cogito", ContextPrefix: "the-prefix"},
+				Params: PutParams{Context: "the-context"},
+				Env:    Environment{BuildJobName: "the-job"},
+			},
+			wantContext: "[cogito] the-prefix/the-context",
+		},
 		{
 			name: "prefix and override",
 			request: PutRequest{
@@ -59,6 +110,54 @@ func TestGhMakeContext(t *testing.T) {
 	}
 }
 
+func TestGhFitContext(t *testing.T) {
+	type testCase struct {
+		name    string
+		context string
+		mode    string
+		want    string
+	}
+
+	test := func(t *testing.T, tc testCase) {
+		have := ghFitContext(tc.context, tc.mode)
+
+		assert.Equal(t, have, tc.want)
+	}
+
+	long := strings.Repeat("a", ghMaxContextLen) + "-the-tail"
+
+	testCases := []testCase{
+		{
+			name:    "within limit: unchanged",
+			context: "the-context",
+			mode:    overflowHashSuffix,
+			want:    "the-context",
+		},
+		{
+			name:    "error: unchanged, the sink fails",
+			context: strings.Repeat("a", ghMaxContextLen-1) + "bc",
+			mode:    overflowError,
+			want:    strings.Repeat("a", ghMaxContextLen-1) + "bc",
+		},
+		{
+			name:    "truncate-tail",
+			context: long,
+			mode:    overflowTruncateTail,
+			want:    strings.Repeat("a", ghMaxContextLen),
+		},
+		{
+			name:    "hash-suffix",
+			context: long,
+			mode:    overflowHashSuffix,
+			want:    strings.Repeat("a", ghMaxContextLen-9) + "-edcf3aa4",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) { test(t, tc) })
+	}
+}
+
 func TestGhAdaptState(t *testing.T) {
 	type testCase struct {
 		name  string
@@ -83,6 +182,246 @@ func TestGhAdaptState(t *testing.T) {
 			state: StateAbort,
 			want:  StateError,
 		},
+		{
+			name:  "skipped converted to success",
+			state: StateSkipped,
+			want:  StateSuccess,
+		},
+		{
+			name:  "queued converted to pending",
+			state: StateQueued,
+			want:  StatePending,
+		},
+		{
+			name:  "neutral converted to success",
+			state: StateNeutral,
+			want:  StateSuccess,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) { test(t, tc) })
+	}
+}
+
+func TestGhMakeDescription(t *testing.T) {
+	type testCase struct {
+		name    string
+		request PutRequest
+		want    string
+	}
+
+	now := time.Date(2022, 9, 15, 10, 11, 12, 0, time.UTC)
+
+	test := func(t *testing.T, tc testCase) {
+		have := ghMakeDescription(tc.request, now)
+
+		assert.Equal(t, have, tc.want)
+	}
+
+	testCases := []testCase{
+		{
+			name: "default",
+			request: PutRequest{
+				Env: Environment{BuildName: "42"},
+			},
+			want: "Build 42",
+		},
+		{
+			name: "annotate_timestamp appends an ISO-8601 timestamp",
+			request: PutRequest{
+				Params: PutParams{AnnotateTimestamp: true},
+				Env:    Environment{BuildName: "42"},
+			},
+			want: "Build 42 @ 2022-09-15T10:11:12Z",
+		},
+		{
+			name: "description_append_pipeline appends the pipeline name",
+			request: PutRequest{
+				Source: Source{DescriptionAppendPipeline: true},
+				Env:    Environment{BuildName: "42", BuildPipelineName: "the-pipeline"},
+			},
+			want: "Build 42 [the-pipeline]",
+		},
+		{
+			name: "description_append_pipeline in manual mode has no pipeline",
+			request: PutRequest{
+				Source: Source{DescriptionAppendPipeline: true},
+				Env:    Environment{BuildName: "42"},
+			},
+			want: "Build 42",
+		},
+		{
+			name: "description_append_pipeline truncates a long pipeline name",
+			request: PutRequest{
+				Source: Source{DescriptionAppendPipeline: true},
+				Env: Environment{
+					BuildName:         "42",
+					BuildPipelineName: strings.Repeat("p", 200),
+				},
+			},
+			want: "Build 42 [" + strings.Repeat("p", 67) + "]",
+		},
+		{
+			name: "skipped adds a note",
+			request: PutRequest{
+				Params: PutParams{State: StateSkipped},
+				Env:    Environment{BuildName: "42"},
+			},
+			want: "Build 42 (skipped)",
+		},
+		{
+			name: "queued adds a note",
+			request: PutRequest{
+				Params: PutParams{State: StateQueued},
+				Env:    Environment{BuildName: "42"},
+			},
+			want: "Build 42 (queued)",
+		},
+		{
+			name: "neutral adds a note",
+			request: PutRequest{
+				Params: PutParams{State: StateNeutral},
+				Env:    Environment{BuildName: "42"},
+			},
+			want: "Build 42 (neutral)",
+		},
+		{
+			name: "started_at adds the build duration",
+			request: PutRequest{
+				Params: PutParams{StartedAt: "2022-09-15T10:09:07Z"},
+				Env:    Environment{BuildName: "42"},
+			},
+			want: "Build 42 in 2m 5s",
+		},
+		{
+			name: "pending_description is used for state pending",
+			request: PutRequest{
+				Params: PutParams{
+					State:              StatePending,
+					PendingDescription: "waiting for tests",
+				},
+				Env: Environment{BuildName: "42"},
+			},
+			want: "waiting for tests",
+		},
+		{
+			name: "pending_description is ignored for the other states",
+			request: PutRequest{
+				Params: PutParams{
+					State:              StateSuccess,
+					PendingDescription: "waiting for tests",
+				},
+				Env: Environment{BuildName: "42"},
+			},
+			want: "Build 42",
+		},
+		{
+			name: "success_description is used for state success",
+			request: PutRequest{
+				Params: PutParams{
+					State:              StateSuccess,
+					SuccessDescription: "all tests passed",
+				},
+				Env: Environment{BuildName: "42"},
+			},
+			want: "all tests passed",
+		},
+		{
+			name: "success_description is ignored for the other states",
+			request: PutRequest{
+				Params: PutParams{
+					State:              StateFailure,
+					SuccessDescription: "all tests passed",
+				},
+				Env: Environment{BuildName: "42"},
+			},
+			want: "Build 42",
+		},
+		{
+			name: "success_description is truncated to the limit",
+			request: PutRequest{
+				Params: PutParams{
+					State:              StateSuccess,
+					SuccessDescription: strings.Repeat("x", 200),
+				},
+			},
+			want: strings.Repeat("x", 140),
+		},
+		{
+			name: "description_state_prefix is prepended for the matching state",
+			request: PutRequest{
+				Source: Source{DescriptionStatePrefix: map[BuildState]string{
+					StateSuccess: "✅", StateFailure: "❌"}},
+				Params: PutParams{State: StateSuccess},
+				Env:    Environment{BuildName: "42"},
+			},
+			want: "✅ Build 42",
+		},
+		{
+			name: "description_state_prefix is ignored for the other states",
+			request: PutRequest{
+				Source: Source{DescriptionStatePrefix: map[BuildState]string{
+					StateFailure: "❌"}},
+				Params: PutParams{State: StateSuccess},
+				Env:    Environment{BuildName: "42"},
+			},
+			want: "Build 42",
+		},
+		{
+			name: "description_state_prefix keeps the description within the limit",
+			request: PutRequest{
+				Source: Source{DescriptionStatePrefix: map[BuildState]string{
+					StateSuccess: "✅"}},
+				Params: PutParams{State: StateSuccess},
+				Env:    Environment{BuildName: strings.Repeat("x", 200)},
+			},
+			want: "✅ Build " + strings.Repeat("x", 132),
+		},
+		{
+			name: "pending_description is truncated to the limit",
+			request: PutRequest{
+				Params: PutParams{
+					State:              StatePending,
+					PendingDescription: strings.Repeat("x", 200),
+				},
+			},
+			want: strings.Repeat("x", 140),
+		},
+		{
+			name: "annotate_timestamp keeps the description within the limit",
+			request: PutRequest{
+				Params: PutParams{AnnotateTimestamp: true},
+				Env:    Environment{BuildName: strings.Repeat("x", 200)},
+			},
+			want: "Build " + strings.Repeat("x", 111) + " @ 2022-09-15T10:11:12Z",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) { test(t, tc) })
+	}
+}
+
+func TestAppendWithinLimit(t *testing.T) {
+	type testCase struct {
+		name   string
+		text   string
+		suffix string
+		want   string
+	}
+
+	test := func(t *testing.T, tc testCase) {
+		have := appendWithinLimit(tc.text, tc.suffix, 10)
+
+		assert.Equal(t, have, tc.want)
+	}
+
+	testCases := []testCase{
+		{name: "fits", text: "abc", suffix: "-12", want: "abc-12"},
+		{name: "text truncated", text: "abcdefghij", suffix: "-12", want: "abcdefg-12"},
+		{name: "multi-byte runes", text: "ààààààààà", suffix: "-12", want: "ààààààà-12"},
+		{name: "suffix too long", text: "abc", suffix: "-123456789", want: "-123456789"},
 	}
 
 	for _, tc := range testCases {
@@ -1,11 +1,17 @@
 package cogito_test
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"os"
 	"path"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/Pix4D/cogito/cogito"
 	"github.com/Pix4D/cogito/github"
@@ -41,6 +47,306 @@ func TestSinkGitHubCommitStatusSendSuccess(t *testing.T) {
 	assert.Equal(t, ghReq.Context, wantContext)
 }
 
+func TestSinkGitHubCommitStatusSendRequireDescription(t *testing.T) {
+	type testCase struct {
+		name    string
+		request cogito.PutRequest
+		wantErr string
+	}
+
+	test := func(t *testing.T, tc testCase) {
+		var ghReq github.AddRequest
+		var URL *url.URL
+		ts := testhelp.SpyHttpServer(&ghReq, nil, &URL, http.StatusCreated)
+		defer ts.Close()
+		tc.request.Source.RequireDescription = true
+		sink := cogito.GitHubCommitStatusSink{
+			Log:     hclog.NewNullLogger(),
+			GhAPI:   ts.URL,
+			GitRef:  "deadbeefdeadbeef",
+			Request: tc.request,
+		}
+
+		err := sink.Send()
+
+		if tc.wantErr == "" {
+			assert.NilError(t, err)
+			return
+		}
+		assert.Error(t, err, tc.wantErr)
+		assert.Assert(t, URL == nil, "unexpected request to GitHub")
+	}
+
+	testCases := []testCase{
+		{
+			name: "empty description fails",
+			request: cogito.PutRequest{
+				Params: cogito.PutParams{State: cogito.StateSuccess},
+				Env:    cogito.Environment{BuildJobName: "the-job"},
+			},
+			wantErr: "require_description: empty description: " +
+				"no build name, no params.pending_description (state pending) and " +
+				"no params.success_description (state success)",
+		},
+		{
+			name: "build name",
+			request: cogito.PutRequest{
+				Params: cogito.PutParams{State: cogito.StateSuccess},
+				Env:    cogito.Environment{BuildJobName: "the-job", BuildName: "42"},
+			},
+		},
+		{
+			name: "pending description",
+			request: cogito.PutRequest{
+				Params: cogito.PutParams{
+					State:              cogito.StatePending,
+					PendingDescription: "waiting for the runner",
+				},
+				Env: cogito.Environment{BuildJobName: "the-job"},
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) { test(t, tc) })
+	}
+}
+
+func TestSinkGitHubCommitStatusSendContextOverflow(t *testing.T) {
+	type testCase struct {
+		name        string
+		mode        string
+		wantContext string
+		wantErr     string
+	}
+
+	test := func(t *testing.T, tc testCase) {
+		var ghReq github.AddRequest
+		var URL *url.URL
+		ts := testhelp.SpyHttpServer(&ghReq, nil, &URL, http.StatusCreated)
+		defer ts.Close()
+		sink := cogito.GitHubCommitStatusSink{
+			Log:    hclog.NewNullLogger(),
+			GhAPI:  ts.URL,
+			GitRef: "deadbeefdeadbeef",
+			Request: cogito.PutRequest{
+				Source: cogito.Source{ContextOverflow: tc.mode},
+				Params: cogito.PutParams{
+					State:   cogito.StateSuccess,
+					Context: strings.Repeat("x", 300),
+				},
+			},
+		}
+
+		err := sink.Send()
+
+		if tc.wantErr != "" {
+			assert.Error(t, err, tc.wantErr)
+			assert.Assert(t, URL == nil, "unexpected request to GitHub")
+			return
+		}
+		assert.NilError(t, err)
+		assert.Equal(t, ghReq.Context, tc.wantContext)
+	}
+
+	testCases := []testCase{
+		{
+			name:    "error",
+			mode:    "error",
+			wantErr: "context_overflow: context too long: 300 characters (max 255)",
+		},
+		{
+			name:        "truncate-tail",
+			mode:        "truncate-tail",
+			wantContext: strings.Repeat("x", 255),
+		},
+		{
+			name:        "hash-suffix",
+			mode:        "hash-suffix",
+			wantContext: strings.Repeat("x", 246) + "-0d4e2ca9",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) { test(t, tc) })
+	}
+}
+
+func TestSinkGitHubCommitStatusSendVerifyAfterPost(t *testing.T) {
+	type testCase struct {
+		name        string
+		githubState string
+		wantLog     string
+	}
+
+	test := func(t *testing.T, tc testCase) {
+		ts := httptest.NewServer(
+			http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				if req.Method == http.MethodPost {
+					w.WriteHeader(http.StatusCreated)
+					return
+				}
+				fmt.Fprintf(w, `{"statuses": [{"state": %q, "context": "the-context"}]}`,
+					tc.githubState)
+			}))
+		defer ts.Close()
+		var logBuf strings.Builder
+		sink := cogito.GitHubCommitStatusSink{
+			Log:    hclog.New(&hclog.LoggerOptions{Output: &logBuf}),
+			GhAPI:  ts.URL,
+			GitRef: "deadbeefdeadbeef",
+			Request: cogito.PutRequest{
+				Source: cogito.Source{VerifyAfterPost: true},
+				Params: cogito.PutParams{State: cogito.StateSuccess, Context: "the-context"},
+			},
+		}
+
+		err := sink.Send()
+
+		assert.NilError(t, err)
+		if tc.wantLog == "" {
+			assert.Assert(t, !strings.Contains(logBuf.String(), "[WARN]"), logBuf.String())
+			return
+		}
+		assert.Assert(t, strings.Contains(logBuf.String(), tc.wantLog), logBuf.String())
+	}
+
+	testCases := []testCase{
+		{
+			name:        "read-back matches",
+			githubState: "success",
+		},
+		{
+			name:        "read-back differs",
+			githubState: "failure",
+			wantLog: "[WARN]  verify_after_post: the commit status on GitHub differs " +
+				"from the one posted, check for another tool posting to the same context: " +
+				"posted-state=success github-state=failure context=the-context",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) { test(t, tc) })
+	}
+}
+
+func TestSinkGitHubCommitStatusSendContextTemplate(t *testing.T) {
+	t.Setenv("BUILD_JOB_NAME", "the-job")
+	var ghReq github.AddRequest
+	var URL *url.URL
+	ts := testhelp.SpyHttpServer(&ghReq, nil, &URL, http.StatusCreated)
+	defer ts.Close()
+	in := basePutRequest
+	// Ignored, since context_template gives full control.
+	in.Source.ContextPrefix = "the-prefix"
+	in.Params.ContextTemplate = "{{ .Env.BuildJobName }} ({{ .Vars.os }})"
+	in.Params.ContextVars = map[string]string{"os": "linux"}
+	request, err := cogito.NewPutRequest(testhelp.ToJSON(t, in))
+	assert.NilError(t, err)
+	sink := cogito.GitHubCommitStatusSink{
+		Log:     hclog.NewNullLogger(),
+		GhAPI:   ts.URL,
+		GitRef:  "deadbeefdeadbeef",
+		Request: request,
+	}
+
+	err = sink.Send()
+
+	assert.NilError(t, err)
+	assert.Equal(t, ghReq.Context, "the-job (linux)")
+}
+
+func TestSinkGitHubCommitStatusSendSaveResponse(t *testing.T) {
+	var ghReq github.AddRequest
+	var URL *url.URL
+	reply := map[string]any{
+		"id": 42, "url": "https://api.example.com/statuses/42", "state": "pending",
+		"context": "the-job", "created_at": "2022-09-15T10:11:12Z",
+	}
+	ts := testhelp.SpyHttpServer(&ghReq, reply, &URL, http.StatusCreated)
+	defer ts.Close()
+	responseDir := t.TempDir()
+	sink := cogito.GitHubCommitStatusSink{
+		Log:    hclog.NewNullLogger(),
+		GhAPI:  ts.URL,
+		GitRef: "deadbeefdeadbeef",
+		Request: cogito.PutRequest{
+			Params: cogito.PutParams{State: cogito.StatePending},
+			Env:    cogito.Environment{BuildJobName: "the-job"},
+		},
+		ResponseDir: responseDir,
+	}
+
+	// Twice, as with multiple GitHub sinks: the responses are accumulated.
+	assert.NilError(t, sink.Send())
+	assert.NilError(t, sink.Send())
+
+	data, err := os.ReadFile(filepath.Join(responseDir, "github_response.json"))
+	assert.NilError(t, err)
+	var statuses []github.Status
+	testhelp.FromJSON(t, data, &statuses)
+	assert.Equal(t, len(statuses), 2)
+	assert.Equal(t, statuses[0].ID, int64(42))
+	assert.Equal(t, statuses[0].URL, "https://api.example.com/statuses/42")
+	assert.Equal(t, statuses[0].CreatedAt, "2022-09-15T10:11:12Z")
+}
+
+func TestSinkGitHubCommitStatusSendManualMode(t *testing.T) {
+	type testCase struct {
+		name          string
+		env           cogito.Environment
+		wantContext   string
+		wantTargetURL string
+	}
+
+	test := func(t *testing.T, tc testCase) {
+		var ghReq github.AddRequest
+		var URL *url.URL
+		ts := testhelp.SpyHttpServer(&ghReq, nil, &URL, http.StatusCreated)
+		request := basePutRequest
+		request.Env = tc.env
+		assert.NilError(t, request.Source.Validate())
+		sink := cogito.GitHubCommitStatusSink{
+			Log:     hclog.NewNullLogger(),
+			GhAPI:   ts.URL,
+			GitRef:  "deadbeefdeadbeef",
+			Request: request,
+		}
+
+		err := sink.Send()
+
+		assert.NilError(t, err)
+		ts.Close() // Avoid races before the following asserts.
+		assert.Equal(t, ghReq.Context, tc.wantContext)
+		assert.Equal(t, ghReq.TargetURL, tc.wantTargetURL)
+	}
+
+	testCases := []testCase{
+		{
+			name:          "Concourse env vars absent",
+			env:           cogito.Environment{},
+			wantContext:   "manual",
+			wantTargetURL: "",
+		},
+		{
+			name: "Concourse env vars present",
+			env: cogito.Environment{
+				AtcExternalUrl:    "https://ci.example.com",
+				BuildTeamName:     "the-team",
+				BuildPipelineName: "the-pipeline",
+				BuildJobName:      "the-job",
+				BuildName:         "42",
+			},
+			wantContext:   "the-job",
+			wantTargetURL: "https://ci.example.com/teams/the-team/pipelines/the-pipeline/jobs/the-job/builds/42",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) { test(t, tc) })
+	}
+}
+
 func TestSinkGitHubCommitStatusSendFailure(t *testing.T) {
 	ts := httptest.NewServer(
 		http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
@@ -61,3 +367,161 @@ func TestSinkGitHubCommitStatusSendFailure(t *testing.T) {
 	assert.ErrorContains(t, err,
 		`failed to add state "pending" for commit deadbee: 418 I'm a teapot`)
 }
+
+func TestSinkGitHubCommitStatusSendMaxStatuses(t *testing.T) {
+	type testCase struct {
+		name              string
+		warnOnMaxStatuses bool
+		wantErr           string
+	}
+
+	test := func(t *testing.T, tc testCase) {
+		ts := httptest.NewServer(
+			http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				w.WriteHeader(http.StatusUnprocessableEntity)
+				fmt.Fprintln(w, `{"message":"Validation Failed","errors":[{"resource":"Status",`+
+					`"code":"custom","message":"This SHA and context has reached the maximum number of statuses."}]}`)
+			}))
+		defer ts.Close()
+		request := basePutRequest
+		request.Source.WarnOnMaxStatuses = tc.warnOnMaxStatuses
+		sink := cogito.GitHubCommitStatusSink{
+			Log:     hclog.NewNullLogger(),
+			GhAPI:   ts.URL,
+			GitRef:  "deadbeefdeadbeef",
+			Request: request,
+		}
+
+		err := sink.Send()
+
+		if tc.wantErr == "" {
+			assert.NilError(t, err)
+			return
+		}
+		assert.ErrorContains(t, err, tc.wantErr)
+		assert.Assert(t, errors.Is(err, github.ErrMaxStatuses))
+	}
+
+	testCases := []testCase{
+		{
+			name:    "hard failure by default",
+			wantErr: "Hint: GitHub allows at most 1000 statuses per commit and context.",
+		},
+		{
+			name:              "soft warning if configured",
+			warnOnMaxStatuses: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) { test(t, tc) })
+	}
+}
+
+func TestSinkGitHubCommitStatusSendVerifySHA(t *testing.T) {
+	type testCase struct {
+		name       string
+		commitCode int
+		wantPosted bool
+		wantErr    string
+	}
+
+	test := func(t *testing.T, tc testCase) {
+		var posted bool
+		ts := httptest.NewServer(
+			http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				if req.Method == http.MethodGet {
+					w.WriteHeader(tc.commitCode)
+					return
+				}
+				posted = true
+				w.WriteHeader(http.StatusCreated)
+			}))
+		request := basePutRequest
+		request.Source.VerifySHA = true
+		sink := cogito.GitHubCommitStatusSink{
+			Log:     hclog.NewNullLogger(),
+			GhAPI:   ts.URL,
+			GitRef:  "deadbeefdeadbeef",
+			Request: request,
+		}
+
+		err := sink.Send()
+
+		if tc.wantErr != "" {
+			assert.ErrorContains(t, err, tc.wantErr)
+		} else {
+			assert.NilError(t, err)
+		}
+		ts.Close() // Avoid races before the following asserts.
+		assert.Equal(t, posted, tc.wantPosted)
+	}
+
+	testCases := []testCase{
+		{
+			name:       "commit found",
+			commitCode: http.StatusOK,
+			wantPosted: true,
+		},
+		{
+			name:       "commit not found",
+			commitCode: http.StatusUnprocessableEntity,
+			wantPosted: false,
+			wantErr:    "commit SHA deadbeefdeadbeef not found in repo https://github.com/the-owner/the-repo",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) { test(t, tc) })
+	}
+}
+
+func TestSinkGitHubCommitStatusTimeout(t *testing.T) {
+	type testCase struct {
+		name    string
+		source  cogito.Source
+		wantErr string
+	}
+
+	test := func(t *testing.T, tc testCase) {
+		ts := httptest.NewServer(
+			http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				time.Sleep(300 * time.Millisecond)
+				w.WriteHeader(http.StatusCreated)
+			}))
+		defer ts.Close()
+		sink := cogito.GitHubCommitStatusSink{
+			Log:    hclog.NewNullLogger(),
+			GhAPI:  ts.URL,
+			GitRef: "deadbeefdeadbeef",
+			Request: cogito.PutRequest{
+				Source: tc.source,
+				Params: cogito.PutParams{State: cogito.StatePending},
+			},
+		}
+
+		err := sink.Send()
+
+		if tc.wantErr == "" {
+			assert.NilError(t, err)
+		} else {
+			assert.ErrorContains(t, err, tc.wantErr)
+		}
+	}
+
+	testCases := []testCase{
+		{
+			name:    "github_timeout is used",
+			source:  cogito.Source{GitHubTimeout: "50ms"},
+			wantErr: "Client.Timeout exceeded",
+		},
+		{
+			name:   "default timeout, not the timeout of another sink",
+			source: cogito.Source{GChatTimeout: "50ms"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) { test(t, tc) })
+	}
+}
@@ -7,8 +7,16 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"net/url"
 	"os"
+	"path"
+	"regexp"
 	"strings"
+	"sync"
+	"time"
+
+	"github.com/Pix4D/cogito/gcp"
+	"github.com/Pix4D/cogito/sets"
 )
 
 // DummyVersion is the version always returned by the Cogito resource.
@@ -109,9 +117,22 @@ func NewPutRequest(input []byte) (PutRequest, error) {
 	if err := request.Source.Validate(); err != nil {
 		return PutRequest{}, fmt.Errorf("put: %s", err)
 	}
+	if err := request.Params.Validate(); err != nil {
+		return PutRequest{}, fmt.Errorf("put: %s", err)
+	}
 
 	request.Env.Fill()
 
+	// The context template is rendered here and not in the validation, since it
+	// depends on Env.
+	if request.Params.ContextTemplate != "" {
+		context, err := renderContextTemplate(request.Params, request.Env)
+		if err != nil {
+			return PutRequest{}, fmt.Errorf("put: params: context_template: %s", err)
+		}
+		request.Params.fullContext = context
+	}
+
 	return request, nil
 }
 
@@ -121,18 +142,33 @@ func (req *PutRequest) UnmarshalJSON(data []byte) error {
 	//
 	// Parse Source. The method [Source.UnmarshalJSON] will set the needed defaults.
 	//
-	var aux1 request
+	// Only Source, since Params might contain an unknown state, see below.
+	var aux1 struct {
+		Source Source `json:"source"`
+	}
 	if err := json.Unmarshal(data, &aux1); err != nil {
 		return err
 	}
 	req.Source = aux1.Source
 
+	// Unless source.on_unknown_state is "fail", an unknown state is coerced to
+	// StateError before parsing Params, since BuildState rejects it.
+	var unknownState string
+	if mode := req.Source.OnUnknownState; mode == onUnknownError || mode == onUnknownSkip {
+		var err error
+		data, unknownState, err = coerceUnknownState(data)
+		if err != nil {
+			return err
+		}
+	}
+
 	//
 	// Parse Params with default values set from Source.
 	//
 	aux2 := request{
 		Params: PutParams{
-			ChatAppendSummary: req.Source.ChatAppendSummary, // default value
+			ChatAppendSummary:    req.Source.ChatAppendSummary, // default value
+			NormalizeLineEndings: true,                         // default value
 		},
 	}
 	// Since we also want to enforce the parser to fail if it encounters unknown fields,
@@ -144,17 +180,72 @@ func (req *PutRequest) UnmarshalJSON(data []byte) error {
 		return err
 	}
 	req.Params = aux2.Params
+	req.Params.unknownState = unknownState
 
 	return nil
 }
 
+// Values of source.on_unknown_state.
+const (
+	onUnknownFail  = "fail"
+	onUnknownError = "error"
+	onUnknownSkip  = "skip"
+)
+
+// Values of source.context_overflow.
+const (
+	overflowError        = "error"
+	overflowTruncateTail = "truncate-tail"
+	overflowHashSuffix   = "hash-suffix"
+)
+
+// coerceUnknownState returns data, the JSON put request, with params.state replaced by
+// StateError if it is not a valid [BuildState]. It also returns the replaced state, or
+// the empty string if the state is valid.
+func coerceUnknownState(data []byte) ([]byte, string, error) {
+	var request map[string]json.RawMessage
+	if err := json.Unmarshal(data, &request); err != nil {
+		return nil, "", err
+	}
+	var params map[string]json.RawMessage
+	if raw, found := request["params"]; found {
+		if err := json.Unmarshal(raw, &params); err != nil {
+			return nil, "", err
+		}
+	}
+	raw, found := params["state"]
+	if !found {
+		return data, "", nil
+	}
+	var state BuildState
+	if err := json.Unmarshal(raw, &state); err == nil {
+		return data, "", nil
+	}
+	var str string
+	if err := json.Unmarshal(raw, &str); err != nil {
+		return nil, "", fmt.Errorf("invalid build state: %s", raw)
+	}
+
+	params["state"], _ = json.Marshal(StateError)
+	patched, err := json.Marshal(params)
+	if err != nil {
+		return nil, "", err
+	}
+	request["params"] = patched
+	data, err = json.Marshal(request)
+	if err != nil {
+		return nil, "", err
+	}
+	return data, str, nil
+}
+
 // DO NOT REASSIGN.
 var defaultNotifyStates = []BuildState{StateAbort, StateError, StateFailure}
 
 // Source is the "source:" block in a pipeline "resources:" block for the Cogito resource.
 type Source struct {
 	//
-	// Mandatory
+	// Mandatory (unless the github sink is not active, see source.sinks)
 	//
 	Owner       string `json:"owner"`
 	Repo        string `json:"repo"`
@@ -162,27 +253,184 @@ type Source struct {
 	//
 	// Optional
 	//
-	GChatWebHook       string       `json:"gchat_webhook"` // SENSITIVE
-	LogLevel           string       `json:"log_level"`
-	LogUrl             string       `json:"log_url"` // DEPRECATED
-	ContextPrefix      string       `json:"context_prefix"`
-	ChatAppendSummary  bool         `json:"chat_append_summary"`
-	ChatNotifyOnStates []BuildState `json:"chat_notify_on_states"`
+	GChatWebHook          string       `json:"gchat_webhook"` // SENSITIVE
+	LogLevel              string       `json:"log_level"`
+	LogUrl                string       `json:"log_url"` // DEPRECATED
+	ContextPrefix         string       `json:"context_prefix"`
+	DefaultContext        string       `json:"default_context"`
+	ContextBrand          string       `json:"context_brand"`
+	ManualContext         string       `json:"manual_context"`
+	ChatAppendSummary     bool         `json:"chat_append_summary"`
+	ChatNotifyOnStates    []BuildState `json:"chat_notify_on_states"`
+	ChatWarnIfNever       bool         `json:"chat_warn_if_never"`
+	ChatErrorIfNever      bool         `json:"chat_error_if_never"`
+	GChatOncePerBuild     bool         `json:"gchat_once_per_build"`
+	ChatShowTransition    bool         `json:"chat_show_transition"`
+	ChatSplitLongMessages bool         `json:"chat_split_long_messages"`
+	WarnOnMaxStatuses     bool         `json:"warn_on_max_statuses"`
+	VerifySHA             bool         `json:"verify_sha"`
+	VerifyAfterPost       bool         `json:"verify_after_post"`
+	DryRun                DryRun       `json:"dry_run"`
+	DebugDumpRequests     bool         `json:"debug_dump_requests"`
+	ExpectedDefaultBranch string       `json:"expected_default_branch"`
+	S3Endpoint            string       `json:"s3_endpoint"`
+	S3Region              string       `json:"s3_region"`
+	S3Bucket              string       `json:"s3_bucket"`
+	S3Prefix              string       `json:"s3_prefix"`
+	S3AccessKey           string       `json:"s3_access_key"` // SENSITIVE
+	S3SecretKey           string       `json:"s3_secret_key"` // SENSITIVE
+	SNSTopicARN           string       `json:"sns_topic_arn"`
+	SNSEndpoint           string       `json:"sns_endpoint"`
+	AWSRegion             string       `json:"aws_region"`
+	SNSAccessKey          string       `json:"sns_access_key"` // SENSITIVE
+	SNSSecretKey          string       `json:"sns_secret_key"` // SENSITIVE
+	// DescriptionStatePrefix maps a build state to a prefix (for example an emoji) of
+	// the GitHub commit status description.
+	DescriptionStatePrefix map[BuildState]string `json:"description_state_prefix"`
+	CheckReportRateLimit   bool                  `json:"check_report_rate_limit"`
+	GChatWebHookFile       string                `json:"gchat_webhook_file"`
+	ChatPreflight          bool                  `json:"chat_preflight"`
+	GitHubTimeout          string                `json:"github_timeout"`
+	GChatTimeout           string                `json:"gchat_timeout"`
+	ReportSkippedSinks     bool                  `json:"report_skipped_sinks"`
+	Sinks                  []string              `json:"sinks"`
+	AuditLogFile           string                `json:"audit_log_file"`
+	LogFile                string                `json:"log_file"` // Used by main.
+	CanonicalizeRepo       bool                  `json:"canonicalize_repo"`
+	SkipNotifyTrailer      string                `json:"skip_notify_trailer"`
+	FailOnShallow          bool                  `json:"fail_on_shallow"`
+	LogLevelCheck          string                `json:"log_level_check"` // Used by main.
+	LogLevelIn             string                `json:"log_level_in"`    // Used by main.
+	LogLevelOut            string                `json:"log_level_out"`   // Used by main.
+	PubSubProject          string                `json:"pubsub_project"`
+	PubSubTopic            string                `json:"pubsub_topic"`
+	PubSubEndpoint         string                `json:"pubsub_endpoint"`
+	// PubSubServiceAccount is the JSON key of the Google Cloud service account.
+	PubSubServiceAccount string `json:"pubsub_service_account"` // SENSITIVE
+	// IgnoreSinkErrors, if true, logs the sink errors instead of failing the put step.
+	IgnoreSinkErrors bool `json:"ignore_sink_errors"`
+	// StrictGitHub, if true, excludes the github sink from IgnoreSinkErrors.
+	StrictGitHub bool `json:"strict_github"`
+	// NonBlockingSinks are sent in the background, see also NonBlockingWindow.
+	NonBlockingSinks  []string `json:"non_blocking_sinks"`
+	NonBlockingWindow string   `json:"non_blocking_window"`
+	// DescriptionAppendPipeline, if true, appends the pipeline name to the GitHub commit
+	// status description.
+	DescriptionAppendPipeline bool `json:"description_append_pipeline"`
+	DisableKeepAlives         bool `json:"disable_keep_alives"`
+	GChatCheckWebHook         bool `json:"gchat_check_webhook"`
+	// ChatNotifyOnChange, if true, sends a chat message only if the state differs from
+	// the previous one for the same context.
+	ChatNotifyOnChange bool `json:"chat_notify_on_change"`
+	// ChatFooter, if set, is a template, rendered with [ChatFooterData], appended to
+	// every chat message.
+	ChatFooter string `json:"chat_footer"`
+	// RequireDescription, if true, fails the put step if the GitHub commit status
+	// description is empty.
+	RequireDescription bool `json:"require_description"`
+	// RedactionMarker, if set, replaces the default marker of the redacted fields.
+	RedactionMarker string `json:"redaction_marker"`
+	// ReportFirstTerminalOnly, if true, sends only the first terminal state of a build.
+	ReportFirstTerminalOnly bool `json:"report_first_terminal_only"`
+	// ContextByBranch maps a glob of the branch name to the full GitHub commit status
+	// context to use when the branch of the git repo matches.
+	ContextByBranch map[string]string `json:"context_by_branch"`
+	// OnUnknownState is what to do with an unknown params.state: fail the put step
+	// (default), coerce it to StateError, or skip the put step.
+	OnUnknownState string `json:"on_unknown_state"`
+	// GitHubMaxRPS, if positive, is the maximum number of requests per second to the
+	// GitHub Commit status API.
+	GitHubMaxRPS float64 `json:"github_max_rps"`
+	// WarnOnContextCollision, if true, warns if the latest status with the same context
+	// was posted by another tool.
+	WarnOnContextCollision bool `json:"warn_on_context_collision"`
+	// PutTimeout, if set, bounds the duration of the whole put step.
+	PutTimeout string `json:"put_timeout"`
+	// ContextOverflow is what to do with a GitHub commit status context longer than
+	// the API limit: fail (default), truncate its tail or replace its tail with a hash.
+	ContextOverflow string `json:"context_overflow"`
+	// TokenCommand, if set, is a shell command printing on stdout the access token. It
+	// replaces access_token, for short-lived tokens minted by an external helper.
+	TokenCommand string `json:"token_command"`
 }
 
 // String renders Source, redacting the sensitive fields.
 func (src Source) String() string {
 	var bld strings.Builder
 
-	fmt.Fprintf(&bld, "owner:                 %s\n", src.Owner)
-	fmt.Fprintf(&bld, "repo:                  %s\n", src.Repo)
-	fmt.Fprintf(&bld, "access_token:          %s\n", redact(src.AccessToken))
-	fmt.Fprintf(&bld, "gchat_webhook:         %s\n", redact(src.GChatWebHook))
-	fmt.Fprintf(&bld, "log_level:             %s\n", src.LogLevel)
-	fmt.Fprintf(&bld, "context_prefix:        %s\n", src.ContextPrefix)
-	fmt.Fprintf(&bld, "chat_append_summary:   %t\n", src.ChatAppendSummary)
+	fmt.Fprintf(&bld, "owner:                       %s\n", src.Owner)
+	fmt.Fprintf(&bld, "repo:                        %s\n", src.Repo)
+	fmt.Fprintf(&bld, "access_token:                %s\n", src.redact(src.AccessToken))
+	fmt.Fprintf(&bld, "token_command:               %s\n", src.TokenCommand)
+	fmt.Fprintf(&bld, "gchat_webhook:               %s\n", src.redact(src.GChatWebHook))
+	fmt.Fprintf(&bld, "gchat_webhook_file:          %s\n", src.GChatWebHookFile)
+	fmt.Fprintf(&bld, "log_level:                   %s\n", src.LogLevel)
+	fmt.Fprintf(&bld, "log_level_check:             %s\n", src.LogLevelCheck)
+	fmt.Fprintf(&bld, "log_level_in:                %s\n", src.LogLevelIn)
+	fmt.Fprintf(&bld, "log_level_out:               %s\n", src.LogLevelOut)
+	fmt.Fprintf(&bld, "log_file:                    %s\n", src.LogFile)
+	fmt.Fprintf(&bld, "redaction_marker:            %s\n", src.RedactionMarker)
+	fmt.Fprintf(&bld, "context_prefix:              %s\n", src.ContextPrefix)
+	fmt.Fprintf(&bld, "default_context:             %s\n", src.DefaultContext)
+	fmt.Fprintf(&bld, "context_brand:               %s\n", src.ContextBrand)
+	fmt.Fprintf(&bld, "manual_context:              %s\n", src.ManualContext)
+	fmt.Fprintf(&bld, "context_by_branch:           %v\n", src.ContextByBranch)
+	fmt.Fprintf(&bld, "on_unknown_state:            %s\n", src.OnUnknownState)
+	fmt.Fprintf(&bld, "context_overflow:            %s\n", src.ContextOverflow)
+	fmt.Fprintf(&bld, "chat_append_summary:         %t\n", src.ChatAppendSummary)
+	fmt.Fprintf(&bld, "chat_notify_on_states:       %s\n", src.ChatNotifyOnStates)
+	fmt.Fprintf(&bld, "chat_warn_if_never:          %t\n", src.ChatWarnIfNever)
+	fmt.Fprintf(&bld, "chat_error_if_never:         %t\n", src.ChatErrorIfNever)
+	fmt.Fprintf(&bld, "gchat_once_per_build:        %t\n", src.GChatOncePerBuild)
+	fmt.Fprintf(&bld, "chat_notify_on_change:       %t\n", src.ChatNotifyOnChange)
+	fmt.Fprintf(&bld, "chat_footer:                 %s\n", src.ChatFooter)
+	fmt.Fprintf(&bld, "chat_show_transition:        %t\n", src.ChatShowTransition)
+	fmt.Fprintf(&bld, "chat_split_long_messages:    %t\n", src.ChatSplitLongMessages)
+	fmt.Fprintf(&bld, "chat_preflight:              %t\n", src.ChatPreflight)
+	fmt.Fprintf(&bld, "gchat_check_webhook:         %t\n", src.GChatCheckWebHook)
+	fmt.Fprintf(&bld, "skip_notify_trailer:         %s\n", src.SkipNotifyTrailer)
+	fmt.Fprintf(&bld, "warn_on_max_statuses:        %t\n", src.WarnOnMaxStatuses)
+	fmt.Fprintf(&bld, "warn_on_context_collision:   %t\n", src.WarnOnContextCollision)
+	fmt.Fprintf(&bld, "github_timeout:              %s\n", src.GitHubTimeout)
+	fmt.Fprintf(&bld, "github_max_rps:              %v\n", src.GitHubMaxRPS)
+	fmt.Fprintf(&bld, "gchat_timeout:               %s\n", src.GChatTimeout)
+	fmt.Fprintf(&bld, "put_timeout:                 %s\n", src.PutTimeout)
+	fmt.Fprintf(&bld, "verify_sha:                  %t\n", src.VerifySHA)
+	fmt.Fprintf(&bld, "verify_after_post:           %t\n", src.VerifyAfterPost)
+	fmt.Fprintf(&bld, "fail_on_shallow:             %t\n", src.FailOnShallow)
+	fmt.Fprintf(&bld, "report_first_terminal_only:  %t\n", src.ReportFirstTerminalOnly)
+	fmt.Fprintf(&bld, "dry_run:                     %s\n", src.DryRun)
+	fmt.Fprintf(&bld, "debug_dump_requests:         %t\n", src.DebugDumpRequests)
+	fmt.Fprintf(&bld, "disable_keep_alives:         %t\n", src.DisableKeepAlives)
+	fmt.Fprintf(&bld, "report_skipped_sinks:        %t\n", src.ReportSkippedSinks)
+	fmt.Fprintf(&bld, "ignore_sink_errors:          %t\n", src.IgnoreSinkErrors)
+	fmt.Fprintf(&bld, "strict_github:               %t\n", src.StrictGitHub)
+	fmt.Fprintf(&bld, "non_blocking_sinks:          %s\n", src.NonBlockingSinks)
+	fmt.Fprintf(&bld, "non_blocking_window:         %s\n", src.NonBlockingWindow)
+	fmt.Fprintf(&bld, "sinks:                       %s\n", src.Sinks)
+	fmt.Fprintf(&bld, "audit_log_file:              %s\n", src.AuditLogFile)
+	fmt.Fprintf(&bld, "expected_default_branch:     %s\n", src.ExpectedDefaultBranch)
+	fmt.Fprintf(&bld, "canonicalize_repo:           %t\n", src.CanonicalizeRepo)
+	fmt.Fprintf(&bld, "description_state_prefix:    %v\n", src.DescriptionStatePrefix)
+	fmt.Fprintf(&bld, "description_append_pipeline: %t\n", src.DescriptionAppendPipeline)
+	fmt.Fprintf(&bld, "require_description:         %t\n", src.RequireDescription)
+	fmt.Fprintf(&bld, "check_report_rate_limit:     %t\n", src.CheckReportRateLimit)
+	fmt.Fprintf(&bld, "s3_endpoint:                 %s\n", src.S3Endpoint)
+	fmt.Fprintf(&bld, "s3_region:                   %s\n", src.S3Region)
+	fmt.Fprintf(&bld, "s3_bucket:                   %s\n", src.S3Bucket)
+	fmt.Fprintf(&bld, "s3_prefix:                   %s\n", src.S3Prefix)
+	fmt.Fprintf(&bld, "s3_access_key:               %s\n", src.redact(src.S3AccessKey))
+	fmt.Fprintf(&bld, "s3_secret_key:               %s\n", src.redact(src.S3SecretKey))
+	fmt.Fprintf(&bld, "sns_topic_arn:               %s\n", src.SNSTopicARN)
+	fmt.Fprintf(&bld, "sns_endpoint:                %s\n", src.SNSEndpoint)
+	fmt.Fprintf(&bld, "aws_region:                  %s\n", src.AWSRegion)
+	fmt.Fprintf(&bld, "sns_access_key:              %s\n", src.redact(src.SNSAccessKey))
+	fmt.Fprintf(&bld, "sns_secret_key:              %s\n", src.redact(src.SNSSecretKey))
+	fmt.Fprintf(&bld, "pubsub_project:              %s\n", src.PubSubProject)
+	fmt.Fprintf(&bld, "pubsub_topic:                %s\n", src.PubSubTopic)
+	fmt.Fprintf(&bld, "pubsub_endpoint:             %s\n", src.PubSubEndpoint)
 	// Last one: no newline.
-	fmt.Fprintf(&bld, "chat_notify_on_states: %s", src.ChatNotifyOnStates)
+	fmt.Fprintf(&bld, "pubsub_service_account:      %s", src.redact(src.PubSubServiceAccount))
 
 	return bld.String()
 }
@@ -211,27 +459,136 @@ func (src *Source) UnmarshalJSON(data []byte) error {
 
 // Validate verifies the Source configuration and applies defaults.
 func (src *Source) Validate() error {
+	if src.TokenCommand != "" && src.AccessToken != "" {
+		return fmt.Errorf("source: access_token and token_command are mutually exclusive")
+	}
+	// The access token can also be injected via the environment, for secret managers
+	// that work that way. The source configuration takes precedence.
+	if src.AccessToken == "" && src.TokenCommand == "" {
+		src.AccessToken = os.Getenv("COGITO_ACCESS_TOKEN")
+	}
+	// Same for the redaction marker, to match the log scrubbers of the installation.
+	if src.RedactionMarker == "" {
+		src.RedactionMarker = os.Getenv("COGITO_REDACTION_MARKER")
+	}
+	setRedactionMarker(src.RedactionMarker)
+
 	//
-	// Validate mandatory fields.
+	// Validate mandatory fields, which depend on the sinks that will run.
 	//
-	var mandatory []string
-	if src.Owner == "" {
-		mandatory = append(mandatory, "owner")
+	if src.Sinks != nil && len(src.Sinks) == 0 {
+		return fmt.Errorf("source: sinks: empty (want one or more of: %s)",
+			strings.Join(sinkNames, ", "))
 	}
-	if src.Repo == "" {
-		mandatory = append(mandatory, "repo")
+	for _, name := range src.Sinks {
+		if !sets.From(sinkNames...).Contains(name) {
+			return fmt.Errorf("source: sinks: invalid sink: %s (want one of: %s)",
+				name, strings.Join(sinkNames, ", "))
+		}
 	}
-	if src.AccessToken == "" {
-		mandatory = append(mandatory, "access_token")
-	}
-	if len(mandatory) > 0 {
-		return fmt.Errorf("source: missing keys: %s", strings.Join(mandatory, ", "))
+	keys := src.requiredKeyValues()
+	for _, sink := range src.activeSinks() {
+		var missing []string
+		for _, key := range sinkRequiredKeys[sink.name] {
+			if keys[key] == "" {
+				missing = append(missing, key)
+			}
+		}
+		if len(missing) > 0 {
+			reason := ""
+			if sink.reason != "" {
+				reason = sink.reason + ": "
+			}
+			return fmt.Errorf("source: %smissing keys: %s", reason,
+				strings.Join(missing, ", "))
+		}
 	}
 
 	//
 	// Validate optional fields.
 	//
-	// In this case, nothing to validate.
+	for _, timeout := range []struct{ key, value string }{
+		{"github_timeout", src.GitHubTimeout},
+		{"gchat_timeout", src.GChatTimeout},
+		{"non_blocking_window", src.NonBlockingWindow},
+		{"put_timeout", src.PutTimeout},
+	} {
+		if timeout.value == "" {
+			continue
+		}
+		d, err := time.ParseDuration(timeout.value)
+		if err != nil {
+			return fmt.Errorf("source: invalid %s: %s", timeout.key, err)
+		}
+		if d <= 0 {
+			return fmt.Errorf("source: invalid %s: %s (want: positive)", timeout.key,
+				timeout.value)
+		}
+	}
+	for _, name := range src.NonBlockingSinks {
+		if !sets.From(sinkNames...).Contains(name) {
+			return fmt.Errorf("source: non_blocking_sinks: invalid sink: %s (want one of: %s)",
+				name, strings.Join(sinkNames, ", "))
+		}
+	}
+	for glob, context := range src.ContextByBranch {
+		if _, err := path.Match(glob, ""); err != nil {
+			return fmt.Errorf("source: context_by_branch: invalid glob: %s: %s", glob, err)
+		}
+		if context == "" {
+			return fmt.Errorf("source: context_by_branch: empty context for glob: %s", glob)
+		}
+	}
+	if src.GitHubMaxRPS < 0 {
+		return fmt.Errorf("source: invalid github_max_rps: %v (want: positive)",
+			src.GitHubMaxRPS)
+	}
+	switch src.OnUnknownState {
+	case "", onUnknownFail, onUnknownError, onUnknownSkip:
+	default:
+		return fmt.Errorf("source: invalid on_unknown_state: %s (want one of: %s, %s, %s)",
+			src.OnUnknownState, onUnknownFail, onUnknownError, onUnknownSkip)
+	}
+	switch src.ContextOverflow {
+	case "", overflowError, overflowTruncateTail, overflowHashSuffix:
+	default:
+		return fmt.Errorf("source: invalid context_overflow: %s (want one of: %s, %s, %s)",
+			src.ContextOverflow, overflowError, overflowTruncateTail, overflowHashSuffix)
+	}
+	if src.GChatWebHook != "" && src.GChatWebHookFile != "" {
+		return fmt.Errorf("source: gchat_webhook and gchat_webhook_file are mutually exclusive")
+	}
+	// They read back the GitHub commit statuses.
+	if src.ReportFirstTerminalOnly && !src.sinkActive(sinkGitHub) {
+		return fmt.Errorf("source: report_first_terminal_only requires the github sink")
+	}
+	if src.GChatOncePerBuild && !src.sinkActive(sinkGitHub) {
+		return fmt.Errorf("source: gchat_once_per_build requires the github sink")
+	}
+	if src.ChatNotifyOnChange && !src.sinkActive(sinkGitHub) {
+		return fmt.Errorf("source: chat_notify_on_change requires the github sink")
+	}
+	// Fail at configuration time rather than at the first message.
+	if src.sinkActive(sinkPubSub) {
+		if _, err := gcp.ParseServiceAccount([]byte(src.PubSubServiceAccount)); err != nil {
+			return fmt.Errorf("source: invalid pubsub_service_account: %s", err)
+		}
+	}
+	// Compile only: the template can be rendered only once Env is filled.
+	if _, err := newTemplate("chat_footer").Parse(src.ChatFooter); err != nil {
+		return fmt.Errorf("source: invalid chat_footer: %s", err)
+	}
+	for state, prefix := range src.DescriptionStatePrefix {
+		if !stateIn(state, allStates) {
+			return fmt.Errorf("source: description_state_prefix: invalid build state: %s",
+				state)
+		}
+		if n := len([]rune(prefix)); n > ghMaxStatePrefixLen {
+			return fmt.Errorf(
+				"source: description_state_prefix: %s: prefix too long: %d characters (max %d)",
+				state, n, ghMaxStatePrefixLen)
+		}
+	}
 
 	//
 	// Apply defaults.
@@ -239,21 +596,64 @@ func (src *Source) Validate() error {
 	if src.LogLevel == "" {
 		src.LogLevel = "info"
 	}
-	if len(src.ChatNotifyOnStates) == 0 {
+	// We must distinguish between absent (nil: use the default) and explicitly empty
+	// (non-nil: never notify). The JSON decoder leaves the slice nil if the key is
+	// absent or null, and makes it empty and non-nil if the key is [].
+	if src.ChatNotifyOnStates == nil {
 		src.ChatNotifyOnStates = defaultNotifyStates
 	}
+	if src.ManualContext == "" {
+		src.ManualContext = "manual"
+	}
+	if src.OnUnknownState == "" {
+		src.OnUnknownState = onUnknownFail
+	}
+	if src.ContextOverflow == "" {
+		src.ContextOverflow = overflowError
+	}
 
 	return nil
 }
 
+// defaultRedactionMarker replaces the redacted fields, see also source.redaction_marker.
+const defaultRedactionMarker = "***REDACTED***"
+
+var (
+	// redactionMu protects redactionMarker.
+	redactionMu     sync.Mutex
+	redactionMarker = defaultRedactionMarker
+)
+
+// setRedactionMarker sets the marker used by [redact]. If marker is empty, it restores
+// the default marker.
+func setRedactionMarker(marker string) {
+	redactionMu.Lock()
+	defer redactionMu.Unlock()
+	if marker == "" {
+		marker = defaultRedactionMarker
+	}
+	redactionMarker = marker
+}
+
 // redact returns a redacted version of s. If s is empty, it returns the empty string.
 func redact(s string) string {
 	if s != "" {
-		s = "***REDACTED***"
+		redactionMu.Lock()
+		defer redactionMu.Unlock()
+		s = redactionMarker
 	}
 	return s
 }
 
+// redact is like the package-level redact, but it honors src.RedactionMarker also if
+// src has not been validated.
+func (src Source) redact(s string) string {
+	if s != "" && src.RedactionMarker != "" {
+		return src.RedactionMarker
+	}
+	return redact(s)
+}
+
 // Version is a JSON object part of the Concourse resource protocol. The only requirement
 // is that the fields must be of type string, but the keys can be anything.
 // For Cogito, we have one key, "ref".
@@ -288,6 +688,157 @@ type Metadata struct {
 // declare it at all.
 // type GetParams struct{}
 
+// Names of the sinks, as used in the configuration.
+const (
+	sinkGitHub = "github"
+	sinkGChat  = "gchat"
+	sinkS3     = "s3"
+	sinkSNS    = "sns"
+	sinkAudit  = "audit"
+	sinkPubSub = "pubsub"
+)
+
+// DO NOT REASSIGN.
+var sinkNames = []string{sinkGitHub, sinkGChat, sinkS3, sinkSNS, sinkPubSub, sinkAudit}
+
+// sinkRequiredKeys are the source keys required by each sink. Source.Validate enforces
+// them only for the sinks that will run (see [Source.activeSinks]).
+// The keys must be known to [Source.requiredKeyValues].
+// DO NOT REASSIGN.
+var sinkRequiredKeys = map[string][]string{
+	sinkGitHub: {"owner", "repo", "access_token"},
+	sinkGChat:  nil, // The webhook can also be in params.gchat_webhook.
+	sinkS3: {"owner", "repo", "s3_bucket", "s3_region", "s3_access_key",
+		"s3_secret_key"},
+	sinkSNS: {"owner", "repo", "sns_topic_arn", "aws_region", "sns_access_key",
+		"sns_secret_key"},
+	sinkPubSub: {"owner", "repo", "pubsub_project", "pubsub_topic",
+		"pubsub_service_account"},
+	sinkAudit: {"audit_log_file"},
+}
+
+// requiredKeyValues returns the values of the keys in sinkRequiredKeys.
+func (src Source) requiredKeyValues() map[string]string {
+	// With token_command, the access token is known only when the command runs.
+	accessToken := src.AccessToken
+	if src.TokenCommand != "" {
+		accessToken = src.TokenCommand
+	}
+	return map[string]string{
+		"owner":                  src.Owner,
+		"repo":                   src.Repo,
+		"access_token":           accessToken,
+		"s3_bucket":              src.S3Bucket,
+		"s3_region":              src.S3Region,
+		"s3_access_key":          src.S3AccessKey,
+		"s3_secret_key":          src.S3SecretKey,
+		"sns_topic_arn":          src.SNSTopicARN,
+		"aws_region":             src.AWSRegion,
+		"sns_access_key":         src.SNSAccessKey,
+		"sns_secret_key":         src.SNSSecretKey,
+		"audit_log_file":         src.AuditLogFile,
+		"pubsub_project":         src.PubSubProject,
+		"pubsub_topic":           src.PubSubTopic,
+		"pubsub_service_account": src.PubSubServiceAccount,
+	}
+}
+
+// activeSink is a sink that will run, with the reason why, used in error messages.
+type activeSink struct {
+	name   string
+	reason string
+}
+
+// activeSinks returns the sinks that will run, in the order of sinkNames.
+// If source.sinks is set, they are the ones listed. If not, they are github and gchat,
+// plus s3, sns, pubsub and audit if configured.
+func (src Source) activeSinks() []activeSink {
+	var sinks []activeSink
+	if src.Sinks != nil {
+		listed := sets.From(src.Sinks...)
+		for _, name := range sinkNames {
+			if listed.Contains(name) {
+				sinks = append(sinks, activeSink{name, "sinks: " + name})
+			}
+		}
+		return sinks
+	}
+
+	sinks = append(sinks, activeSink{sinkGitHub, ""}, activeSink{sinkGChat, ""})
+	if src.S3Bucket != "" {
+		sinks = append(sinks, activeSink{sinkS3, "s3_bucket is set"})
+	}
+	if src.SNSTopicARN != "" {
+		sinks = append(sinks, activeSink{sinkSNS, "sns_topic_arn is set"})
+	}
+	if src.PubSubTopic != "" {
+		sinks = append(sinks, activeSink{sinkPubSub, "pubsub_topic is set"})
+	}
+	if src.AuditLogFile != "" {
+		sinks = append(sinks, activeSink{sinkAudit, "audit_log_file is set"})
+	}
+	return sinks
+}
+
+// sinkActive returns true if sink name will run.
+func (src Source) sinkActive(name string) bool {
+	for _, sink := range src.activeSinks() {
+		if sink.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// DryRun is the value of source.dry_run: either a boolean, that applies to all the
+// sinks, or a list of sink names.
+type DryRun struct {
+	All   bool
+	Sinks []string
+}
+
+func (dr *DryRun) UnmarshalJSON(data []byte) error {
+	var all bool
+	if err := json.Unmarshal(data, &all); err == nil {
+		*dr = DryRun{All: all}
+		return nil
+	}
+
+	var names []string
+	if err := json.Unmarshal(data, &names); err != nil {
+		return fmt.Errorf("dry_run: want a boolean or a list of sink names: have: %s",
+			data)
+	}
+	for _, name := range names {
+		if !sets.From(sinkNames...).Contains(name) {
+			return fmt.Errorf("dry_run: invalid sink: %s (want one of: %s)",
+				name, strings.Join(sinkNames, ", "))
+		}
+	}
+	*dr = DryRun{Sinks: names}
+	return nil
+}
+
+func (dr DryRun) MarshalJSON() ([]byte, error) {
+	if dr.Sinks != nil {
+		return json.Marshal(dr.Sinks)
+	}
+	return json.Marshal(dr.All)
+}
+
+// Contains returns true if sink name must be dry-run.
+func (dr DryRun) Contains(name string) bool {
+	return dr.All || sets.From(dr.Sinks...).Contains(name)
+}
+
+// String renders DryRun.
+func (dr DryRun) String() string {
+	if dr.Sinks != nil {
+		return fmt.Sprint(dr.Sinks)
+	}
+	return fmt.Sprint(dr.All)
+}
+
 // BuildState is a pseudo-enum representing the valid values of PutParams.State
 type BuildState string
 
@@ -298,10 +849,16 @@ const (
 	StateFailure BuildState = "failure"
 	StatePending BuildState = "pending"
 	StateSuccess BuildState = "success"
+	StateSkipped BuildState = "skipped"
+	StateQueued  BuildState = "queued"
+	StateNeutral BuildState = "neutral"
 )
 
 const KeyState = "state"
 
+// KeyResult is the name of the put output metadata with the summary of the sinks.
+const KeyResult = "cogito_result"
+
 func (bs *BuildState) UnmarshalJSON(data []byte) error {
 	var str string
 	if err := json.Unmarshal(data, &str); err != nil {
@@ -311,7 +868,8 @@ func (bs *BuildState) UnmarshalJSON(data []byte) error {
 	*bs = BuildState(str)
 
 	switch *bs {
-	case StateAbort, StateError, StateFailure, StatePending, StateSuccess:
+	case StateAbort, StateError, StateFailure, StatePending, StateSuccess, StateSkipped,
+		StateQueued, StateNeutral:
 		return nil
 	default:
 		return fmt.Errorf("invalid build state: %s", str)
@@ -322,6 +880,11 @@ func (bs BuildState) MarshalJSON() ([]byte, error) {
 	return json.Marshal(string(bs))
 }
 
+// IsTerminal returns true if bs is a state that ends a build.
+func (bs BuildState) IsTerminal() bool {
+	return bs != StatePending && bs != StateQueued
+}
+
 // PutParams is the "params:" block in a pipeline put step for the Cogito resource.
 type PutParams struct {
 	//
@@ -331,28 +894,288 @@ type PutParams struct {
 	//
 	// Optional
 	//
-	Context           string `json:"context"`
-	ChatMessage       string `json:"chat_message"`
-	ChatMessageFile   string `json:"chat_message_file"`
-	ChatAppendSummary bool   `json:"chat_append_summary"`
-	GChatWebHook      string `json:"gchat_webhook"` // SENSITIVE
+	Context           string   `json:"context"`
+	ChatMessage       string   `json:"chat_message"`
+	ChatMessageFile   FileList `json:"chat_message_file"`
+	ChatAppendSummary bool     `json:"chat_append_summary"`
+	GChatWebHook      string   `json:"gchat_webhook"` // SENSITIVE
+	AnnotateTimestamp bool     `json:"annotate_timestamp"`
+	PullRequestNumber int      `json:"pull_request_number"`
+	RepoDir           string   `json:"repo_dir"`
+	// NormalizeLineEndings, if true, converts CRLF to LF in chat_message_file.
+	NormalizeLineEndings bool   `json:"normalize_line_endings"`
+	MultiRefPattern      string `json:"multi_ref_pattern"`
+	// StartedAt, if set, is the RFC 3339 timestamp of the start of the build, used to
+	// report the build duration.
+	StartedAt          string `json:"started_at"`
+	PendingDescription string `json:"pending_description"`
+	SuccessDescription string `json:"success_description"`
+	// ChatDigestFromDir, if set, is a directory in the put inputs with one file per
+	// recorded state, to send as a digest to chat.
+	ChatDigestFromDir string `json:"chat_digest_from_dir"`
+	// ContextVars are the values of the ${VAR} placeholders in Context.
+	ContextVars map[string]string `json:"context_vars"`
+	// SaveResponse, if true, saves the GitHub Commit status API response to the put
+	// inputs.
+	SaveResponse bool `json:"save_response"`
+	// ArtifactURLs are links to the build artifacts, rendered in the chat message.
+	ArtifactURLs []string `json:"artifact_urls"`
+	// Targets are additional commits, possibly of other repos, where to post the
+	// GitHub commit status.
+	Targets []Target `json:"targets"`
+	// ContextTemplate, if set, is a template rendering the full GitHub commit status
+	// context. See [ContextTemplateData].
+	ContextTemplate string `json:"context_template"`
+
+	// unknownState, if set, is the unknown params.state replaced by StateError. See
+	// source.on_unknown_state.
+	unknownState string
+	// fullContext, if set, is the full GitHub commit status context: ContextTemplate,
+	// rendered by NewPutRequest, or the match of source.context_by_branch.
+	fullContext string
+}
+
+// ContextTemplateData is the data passed to the template of params.context_template.
+type ContextTemplateData struct {
+	Env  Environment
+	Vars map[string]string // params.context_vars
+}
+
+// ChatFooterData is the data passed to the template of source.chat_footer. It embeds
+// the Environment, so that for example {{ .BuildPipelineName }} is a valid field.
+type ChatFooterData struct {
+	Environment
+	Branch string // The branch checked out; empty if HEAD is detached.
+	Tag    string // The first tag, in lexical order, of the commit; empty if none.
+}
+
+// renderContextTemplate returns params.ContextTemplate rendered with env.
+func renderContextTemplate(params PutParams, env Environment) (string, error) {
+	context, err := renderTemplate("context_template", params.ContextTemplate,
+		ContextTemplateData{Env: env, Vars: params.ContextVars})
+	if err != nil {
+		return "", err
+	}
+	if strings.TrimSpace(context) == "" {
+		return "", fmt.Errorf("rendered to an empty context")
+	}
+	return context, nil
+}
+
+// Target is an element of params.targets: a commit of a GitHub repo.
+type Target struct {
+	Owner string `json:"owner"`
+	Repo  string `json:"repo"`
+	SHA   string `json:"sha"`
 }
 
 // String renders PutParams, redacting the sensitive fields.
 func (params PutParams) String() string {
 	var bld strings.Builder
 
-	fmt.Fprintf(&bld, "state:               %s\n", params.State)
-	fmt.Fprintf(&bld, "context:             %s\n", params.Context)
-	fmt.Fprintf(&bld, "chat_message:        %s\n", params.ChatMessage)
-	fmt.Fprintf(&bld, "chat_message_file:   %s\n", params.ChatMessageFile)
-	fmt.Fprintf(&bld, "chat_append_summary: %v\n", params.ChatAppendSummary)
+	fmt.Fprintf(&bld, "state:                  %s\n", params.State)
+	fmt.Fprintf(&bld, "context:                %s\n", params.Context)
+	fmt.Fprintf(&bld, "context_vars:           %v\n", params.ContextVars)
+	fmt.Fprintf(&bld, "context_template:       %s\n", params.ContextTemplate)
+	fmt.Fprintf(&bld, "chat_message:           %s\n", params.ChatMessage)
+	fmt.Fprintf(&bld, "chat_message_file:      %s\n", params.ChatMessageFile)
+	fmt.Fprintf(&bld, "chat_digest_from_dir:   %s\n", params.ChatDigestFromDir)
+	fmt.Fprintf(&bld, "chat_append_summary:    %v\n", params.ChatAppendSummary)
+	fmt.Fprintf(&bld, "gchat_webhook:          %s\n", redact(params.GChatWebHook))
+	fmt.Fprintf(&bld, "annotate_timestamp:     %v\n", params.AnnotateTimestamp)
+	fmt.Fprintf(&bld, "pull_request_number:    %d\n", params.PullRequestNumber)
+	fmt.Fprintf(&bld, "repo_dir:               %s\n", params.RepoDir)
+	fmt.Fprintf(&bld, "normalize_line_endings: %v\n", params.NormalizeLineEndings)
+	fmt.Fprintf(&bld, "multi_ref_pattern:      %s\n", params.MultiRefPattern)
+	fmt.Fprintf(&bld, "started_at:             %s\n", params.StartedAt)
+	fmt.Fprintf(&bld, "save_response:          %v\n", params.SaveResponse)
+	fmt.Fprintf(&bld, "artifact_urls:          %v\n", params.ArtifactURLs)
+	fmt.Fprintf(&bld, "targets:                %v\n", params.Targets)
+	fmt.Fprintf(&bld, "success_description:    %s\n", params.SuccessDescription)
 	// Last one: no newline.
-	fmt.Fprintf(&bld, "gchat_webhook:       %s", redact(params.GChatWebHook))
+	fmt.Fprintf(&bld, "pending_description:    %s", params.PendingDescription)
 
 	return bld.String()
 }
 
+// sinkTimeout returns the duration of value, or def if value is empty.
+// Parameter value must have been validated by [Source.Validate].
+func sinkTimeout(value string, def time.Duration) time.Duration {
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return def
+	}
+	return d
+}
+
+// FileList is the value of params.chat_message_file: either a string, for one file, or a
+// list of strings.
+type FileList []string
+
+func (fl *FileList) UnmarshalJSON(data []byte) error {
+	var file string
+	if err := json.Unmarshal(data, &file); err == nil {
+		if file == "" {
+			*fl = nil
+		} else {
+			*fl = FileList{file}
+		}
+		return nil
+	}
+
+	var files []string
+	if err := json.Unmarshal(data, &files); err != nil {
+		return fmt.Errorf("chat_message_file: want a string or a list of strings: have: %s",
+			data)
+	}
+	*fl = files
+	return nil
+}
+
+func (fl FileList) MarshalJSON() ([]byte, error) {
+	if len(fl) <= 1 {
+		return json.Marshal(fl.String())
+	}
+	return json.Marshal([]string(fl))
+}
+
+// String renders FileList, comma-separated.
+func (fl FileList) String() string {
+	return strings.Join(fl, ", ")
+}
+
+// Validate verifies the PutParams configuration.
+func (params *PutParams) Validate() error {
+	// First, since the other validations must see the resolved values.
+	if err := params.resolveEnvRefs(); err != nil {
+		return fmt.Errorf("params: %s", err)
+	}
+	if params.PullRequestNumber < 0 {
+		return fmt.Errorf("params: invalid pull_request_number: %d (want: positive)",
+			params.PullRequestNumber)
+	}
+	if params.MultiRefPattern != "" {
+		if _, err := regexp.Compile(params.MultiRefPattern); err != nil {
+			return fmt.Errorf("params: invalid multi_ref_pattern: %s", err)
+		}
+	}
+	if params.StartedAt != "" {
+		if _, err := time.Parse(time.RFC3339, params.StartedAt); err != nil {
+			return fmt.Errorf("params: invalid started_at: %s (want: RFC 3339)", err)
+		}
+	}
+	if params.ContextTemplate != "" {
+		if params.Context != "" {
+			return fmt.Errorf("params: context and context_template are mutually exclusive")
+		}
+		// Compile only: the template can be rendered only once Env is filled.
+		if _, err := newTemplate("context_template").Parse(params.ContextTemplate); err != nil {
+			return fmt.Errorf("params: invalid context_template: %s", err)
+		}
+	}
+	if strings.Contains(params.Context, "${") {
+		context, err := expandContextVars(params.Context, params.ContextVars)
+		if err != nil {
+			return fmt.Errorf("params: context: %s", err)
+		}
+		params.Context = context
+	}
+	if dir := params.ChatDigestFromDir; dir != "" {
+		if strings.Contains(strings.Trim(dir, "/"), "/") {
+			return fmt.Errorf("params: invalid chat_digest_from_dir: %s (want: a directory of the put inputs)",
+				dir)
+		}
+		params.ChatDigestFromDir = strings.Trim(dir, "/")
+	}
+	for i, target := range params.Targets {
+		var missing []string
+		for _, kv := range []struct{ key, value string }{
+			{"owner", target.Owner}, {"repo", target.Repo}, {"sha", target.SHA},
+		} {
+			if kv.value == "" {
+				missing = append(missing, kv.key)
+			}
+		}
+		if len(missing) > 0 {
+			return fmt.Errorf("params: targets[%d]: missing keys: %s", i,
+				strings.Join(missing, ", "))
+		}
+		if !shaRe.MatchString(target.SHA) {
+			return fmt.Errorf("params: targets[%d]: invalid sha: %s (want: 40 hex digits)",
+				i, target.SHA)
+		}
+	}
+	for _, artifact := range params.ArtifactURLs {
+		if u, err := url.Parse(artifact); err != nil || !u.IsAbs() || u.Host == "" {
+			return fmt.Errorf("params: invalid artifact_urls: %s (want: absolute URL)",
+				artifact)
+		}
+	}
+
+	return nil
+}
+
+// envRefRe matches a param value that is a reference to an environment variable, for
+// example "env:MY_VAR". A value that only starts with "env:", for example
+// "env: staging", is not a reference, so that it stays a literal as before.
+var envRefRe = regexp.MustCompile(`^env:([A-Za-z_][A-Za-z0-9_]*)$`)
+
+// resolveEnvRefs replaces the values of the string params that are references to an
+// environment variable (see envRefRe) with the value of the variable. It returns an
+// error if a referenced variable is not set.
+func (params *PutParams) resolveEnvRefs() error {
+	fields := []struct {
+		key   string
+		value *string
+	}{
+		{"context", &params.Context},
+		{"chat_message", &params.ChatMessage},
+		{"gchat_webhook", &params.GChatWebHook},
+		{"started_at", &params.StartedAt},
+		{"pending_description", &params.PendingDescription},
+		{"success_description", &params.SuccessDescription},
+	}
+	for _, field := range fields {
+		match := envRefRe.FindStringSubmatch(*field.value)
+		if match == nil {
+			continue
+		}
+		value, set := os.LookupEnv(match[1])
+		if !set {
+			return fmt.Errorf("%s: %s: environment variable not set",
+				field.key, *field.value)
+		}
+		*field.value = value
+	}
+	return nil
+}
+
+// shaRe matches a full git commit SHA.
+var shaRe = regexp.MustCompile(`^[0-9a-fA-F]{40}$`)
+
+// contextVarRe matches a ${VAR} placeholder of params.context.
+var contextVarRe = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// expandContextVars returns context with its ${VAR} placeholders replaced by the
+// values in vars. It returns an error listing the placeholders not in vars.
+func expandContextVars(context string, vars map[string]string) (string, error) {
+	var unmatched []string
+	expanded := contextVarRe.ReplaceAllStringFunc(context, func(placeholder string) string {
+		name := contextVarRe.FindStringSubmatch(placeholder)[1]
+		value, found := vars[name]
+		if !found {
+			unmatched = append(unmatched, placeholder)
+			return placeholder
+		}
+		return value
+	})
+	if len(unmatched) > 0 {
+		return "", fmt.Errorf("unmatched placeholders: %s (not in context_vars)",
+			strings.Join(unmatched, ", "))
+	}
+	return expanded, nil
+}
+
 // Environment represents the environment variables made available to the program.
 // Depending on the type of build and on the step, only some variables could be set.
 // See https://concourse-ci.org/implementing-resource-types.html#resource-metadata
@@ -379,6 +1202,12 @@ func (env *Environment) Fill() {
 	env.AtcExternalUrl = os.Getenv("ATC_EXTERNAL_URL")
 }
 
+// InConcourse returns true if running in Concourse. It returns false if running outside
+// of Concourse, for example locally (manual mode).
+func (env Environment) InConcourse() bool {
+	return env.AtcExternalUrl != ""
+}
+
 // String renders Environment.
 func (env Environment) String() string {
 	var bld strings.Builder
@@ -8,6 +8,7 @@ import (
 	"testing"
 
 	"github.com/Pix4D/cogito/cogito"
+	"github.com/Pix4D/cogito/testhelp"
 	"github.com/hashicorp/go-hclog"
 	"gotest.tools/v3/assert"
 	"gotest.tools/v3/assert/cmp"
@@ -45,6 +46,12 @@ func TestSourceValidationSuccess(t *testing.T) {
 				return source
 			},
 		},
+		{
+			name: "chat only: GitHub keys not required",
+			mkSource: func() cogito.Source {
+				return cogito.Source{Sinks: []string{"gchat"}}
+			},
+		},
 	}
 
 	for _, tc := range testCases {
@@ -75,6 +82,207 @@ func TestSourceValidationFailure(t *testing.T) {
 			source:  cogito.Source{},
 			wantErr: "source: missing keys: owner, repo, access_token",
 		},
+		{
+			name: "s3_bucket without credentials",
+			source: cogito.Source{
+				Owner:       "the-owner",
+				Repo:        "the-repo",
+				AccessToken: "the-token",
+				S3Bucket:    "the-bucket",
+			},
+			wantErr: "source: s3_bucket is set: missing keys: s3_region, s3_access_key, s3_secret_key",
+		},
+		{
+			name: "invalid github_timeout",
+			source: cogito.Source{
+				Owner:         "the-owner",
+				Repo:          "the-repo",
+				AccessToken:   "the-token",
+				GitHubTimeout: "10 bananas",
+			},
+			wantErr: `source: invalid github_timeout: time: unknown unit " bananas" in duration "10 bananas"`,
+		},
+		{
+			name: "negative gchat_timeout",
+			source: cogito.Source{
+				Owner:        "the-owner",
+				Repo:         "the-repo",
+				AccessToken:  "the-token",
+				GChatTimeout: "-1s",
+			},
+			wantErr: "source: invalid gchat_timeout: -1s (want: positive)",
+		},
+		{
+			name: "gchat_webhook and gchat_webhook_file",
+			source: cogito.Source{
+				Owner:            "the-owner",
+				Repo:             "the-repo",
+				AccessToken:      "the-token",
+				GChatWebHook:     "the-webhook",
+				GChatWebHookFile: "secrets/webhook",
+			},
+			wantErr: "source: gchat_webhook and gchat_webhook_file are mutually exclusive",
+		},
+		{
+			name: "report_first_terminal_only without the github sink",
+			source: cogito.Source{
+				Owner:                   "the-owner",
+				Repo:                    "the-repo",
+				GChatWebHook:            "the-webhook",
+				Sinks:                   []string{"gchat"},
+				ReportFirstTerminalOnly: true,
+			},
+			wantErr: "source: report_first_terminal_only requires the github sink",
+		},
+		{
+			name: "gchat_once_per_build without the github sink",
+			source: cogito.Source{
+				Owner:             "the-owner",
+				Repo:              "the-repo",
+				GChatWebHook:      "the-webhook",
+				Sinks:             []string{"gchat"},
+				GChatOncePerBuild: true,
+			},
+			wantErr: "source: gchat_once_per_build requires the github sink",
+		},
+		{
+			name: "chat_notify_on_change without the github sink",
+			source: cogito.Source{
+				Owner:              "the-owner",
+				Repo:               "the-repo",
+				GChatWebHook:       "the-webhook",
+				Sinks:              []string{"gchat"},
+				ChatNotifyOnChange: true,
+			},
+			wantErr: "source: chat_notify_on_change requires the github sink",
+		},
+		{
+			name: "description_state_prefix with invalid state",
+			source: cogito.Source{
+				Owner:                  "the-owner",
+				Repo:                   "the-repo",
+				AccessToken:            "the-token",
+				DescriptionStatePrefix: map[cogito.BuildState]string{"burnt-pizza": "🍕"},
+			},
+			wantErr: "source: description_state_prefix: invalid build state: burnt-pizza",
+		},
+		{
+			name: "description_state_prefix too long",
+			source: cogito.Source{
+				Owner:       "the-owner",
+				Repo:        "the-repo",
+				AccessToken: "the-token",
+				DescriptionStatePrefix: map[cogito.BuildState]string{
+					cogito.StateFailure: strings.Repeat("❌", 33)},
+			},
+			wantErr: "source: description_state_prefix: failure: prefix too long: 33 characters (max 32)",
+		},
+		{
+			name: "invalid on_unknown_state",
+			source: cogito.Source{
+				Owner:          "the-owner",
+				Repo:           "the-repo",
+				AccessToken:    "the-token",
+				OnUnknownState: "ignore",
+			},
+			wantErr: "source: invalid on_unknown_state: ignore (want one of: fail, error, skip)",
+		},
+		{
+			name: "access_token and token_command",
+			source: cogito.Source{
+				Owner:        "the-owner",
+				Repo:         "the-repo",
+				AccessToken:  "the-token",
+				TokenCommand: "echo the-token",
+			},
+			wantErr: "source: access_token and token_command are mutually exclusive",
+		},
+		{
+			name: "invalid chat_footer",
+			source: cogito.Source{
+				Owner:       "the-owner",
+				Repo:        "the-repo",
+				AccessToken: "the-token",
+				ChatFooter:  "pipeline {{ .BuildPipelineName",
+			},
+			wantErr: "source: invalid chat_footer: template: chat_footer:1: unclosed action",
+		},
+		{
+			name: "invalid context_overflow",
+			source: cogito.Source{
+				Owner:           "the-owner",
+				Repo:            "the-repo",
+				AccessToken:     "the-token",
+				ContextOverflow: "truncate-head",
+			},
+			wantErr: "source: invalid context_overflow: truncate-head (want one of: error, truncate-tail, hash-suffix)",
+		},
+		{
+			name: "sns_topic_arn without credentials",
+			source: cogito.Source{
+				Owner:       "the-owner",
+				Repo:        "the-repo",
+				AccessToken: "the-token",
+				SNSTopicARN: "arn:aws:sns:eu-west-1:123456789012:the-topic",
+			},
+			wantErr: "source: sns_topic_arn is set: missing keys: aws_region, sns_access_key, sns_secret_key",
+		},
+		{
+			name: "pubsub_topic without the other keys",
+			source: cogito.Source{
+				Owner:       "the-owner",
+				Repo:        "the-repo",
+				AccessToken: "the-token",
+				PubSubTopic: "the-topic",
+			},
+			wantErr: "source: pubsub_topic is set: missing keys: pubsub_project, pubsub_service_account",
+		},
+		{
+			name: "invalid pubsub_service_account",
+			source: cogito.Source{
+				Owner:                "the-owner",
+				Repo:                 "the-repo",
+				AccessToken:          "the-token",
+				PubSubProject:        "the-project",
+				PubSubTopic:          "the-topic",
+				PubSubServiceAccount: `{"client_email": "sa@example.com"}`,
+			},
+			wantErr: "source: invalid pubsub_service_account: service account: missing keys: private_key, token_uri",
+		},
+		{
+			name:    "sinks with invalid sink",
+			source:  cogito.Source{Sinks: []string{"gchat", "pigeon"}},
+			wantErr: "source: sinks: invalid sink: pigeon (want one of: github, gchat, s3, sns, pubsub, audit)",
+		},
+		{
+			name: "non_blocking_sinks with invalid sink",
+			source: cogito.Source{
+				Owner:            "the-owner",
+				Repo:             "the-repo",
+				AccessToken:      "the-token",
+				NonBlockingSinks: []string{"pigeon"},
+			},
+			wantErr: "source: non_blocking_sinks: invalid sink: pigeon (want one of: github, gchat, s3, sns, pubsub, audit)",
+		},
+		{
+			name:    "sinks empty",
+			source:  cogito.Source{Sinks: []string{}},
+			wantErr: "source: sinks: empty (want one or more of: github, gchat, s3, sns, pubsub, audit)",
+		},
+		{
+			name:    "sinks requires the keys of the listed sinks",
+			source:  cogito.Source{Sinks: []string{"gchat", "github"}, Owner: "the-owner"},
+			wantErr: "source: sinks: github: missing keys: repo, access_token",
+		},
+		{
+			name: "sinks with s3: s3_bucket is required",
+			source: cogito.Source{
+				Sinks: []string{"s3"},
+				Owner: "the-owner",
+				Repo:  "the-repo",
+			},
+			wantErr: "source: sinks: s3: missing keys: s3_bucket, s3_region, s3_access_key, s3_secret_key",
+		},
 	}
 
 	for _, tc := range testCases {
@@ -84,6 +292,56 @@ func TestSourceValidationFailure(t *testing.T) {
 	}
 }
 
+func TestSourceAccessTokenFromEnv(t *testing.T) {
+	type testCase struct {
+		name        string
+		accessToken string
+		env         string
+		want        string
+		wantErr     string
+	}
+
+	test := func(t *testing.T, tc testCase) {
+		t.Setenv("COGITO_ACCESS_TOKEN", tc.env)
+		source := cogito.Source{
+			Owner:       "the-owner",
+			Repo:        "the-repo",
+			AccessToken: tc.accessToken,
+		}
+
+		err := source.Validate()
+
+		if tc.wantErr != "" {
+			assert.Error(t, err, tc.wantErr)
+			return
+		}
+		assert.NilError(t, err)
+		assert.Equal(t, source.AccessToken, tc.want)
+	}
+
+	testCases := []testCase{
+		{
+			name: "token from env",
+			env:  "env-token",
+			want: "env-token",
+		},
+		{
+			name:        "source has precedence",
+			accessToken: "source-token",
+			env:         "env-token",
+			want:        "source-token",
+		},
+		{
+			name:    "neither",
+			wantErr: "source: missing keys: access_token",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) { test(t, tc) })
+	}
+}
+
 // The majority of tests for failure are done in TestSourceValidationFailure, which limits
 // the input since it uses a struct. Thus, we also test with some raw JSON input text.
 func TestSourceParseRawFailure(t *testing.T) {
@@ -144,27 +402,521 @@ func TestSourceParseRawFailure(t *testing.T) {
 	}
 }
 
+func TestSourceChatNotifyOnStates(t *testing.T) {
+	type testCase struct {
+		name  string
+		input string
+		want  []cogito.BuildState
+	}
+
+	test := func(t *testing.T, tc testCase) {
+		var source cogito.Source
+		assert.NilError(t, json.Unmarshal([]byte(tc.input), &source))
+
+		assert.NilError(t, source.Validate())
+
+		assert.DeepEqual(t, source.ChatNotifyOnStates, tc.want)
+	}
+
+	testCases := []testCase{
+		{
+			name: "absent: default",
+			input: `
+{
+  "owner": "the-owner",
+  "repo": "the-repo",
+  "access_token": "the-token"
+}`,
+			want: []cogito.BuildState{cogito.StateAbort, cogito.StateError, cogito.StateFailure},
+		},
+		{
+			name: "empty: never notify",
+			input: `
+{
+  "owner": "the-owner",
+  "repo": "the-repo",
+  "access_token": "the-token",
+  "chat_notify_on_states": []
+}`,
+			want: []cogito.BuildState{},
+		},
+		{
+			name: "populated",
+			input: `
+{
+  "owner": "the-owner",
+  "repo": "the-repo",
+  "access_token": "the-token",
+  "chat_notify_on_states": ["pending", "success"]
+}`,
+			want: []cogito.BuildState{cogito.StatePending, cogito.StateSuccess},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) { test(t, tc) })
+	}
+}
+
+func TestPutRequestNormalizeLineEndings(t *testing.T) {
+	type testCase struct {
+		name   string
+		params string
+		want   bool
+	}
+
+	test := func(t *testing.T, tc testCase) {
+		input := fmt.Sprintf(`
+{
+  "source": {"owner": "the-owner", "repo": "the-repo", "access_token": "the-token"},
+  "params": %s
+}`, tc.params)
+
+		request, err := cogito.NewPutRequest([]byte(input))
+
+		assert.NilError(t, err)
+		assert.Equal(t, request.Params.NormalizeLineEndings, tc.want)
+	}
+
+	testCases := []testCase{
+		{
+			name:   "absent: default",
+			params: `{"state": "success"}`,
+			want:   true,
+		},
+		{
+			name:   "explicitly false",
+			params: `{"state": "success", "normalize_line_endings": false}`,
+			want:   false,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) { test(t, tc) })
+	}
+}
+
+func TestSourceDryRun(t *testing.T) {
+	type testCase struct {
+		name    string
+		dryRun  string
+		want    cogito.DryRun
+		wantErr string
+	}
+
+	test := func(t *testing.T, tc testCase) {
+		input := fmt.Sprintf(`
+{
+  "owner": "the-owner",
+  "repo": "the-repo",
+  "access_token": "the-token",
+  "dry_run": %s
+}`, tc.dryRun)
+		var source cogito.Source
+
+		err := json.Unmarshal([]byte(input), &source)
+
+		if tc.wantErr != "" {
+			assert.Error(t, err, tc.wantErr)
+			return
+		}
+		assert.NilError(t, err)
+		assert.DeepEqual(t, source.DryRun, tc.want)
+	}
+
+	testCases := []testCase{
+		{
+			name:   "boolean",
+			dryRun: `true`,
+			want:   cogito.DryRun{All: true},
+		},
+		{
+			name:   "list of sinks",
+			dryRun: `["gchat", "s3"]`,
+			want:   cogito.DryRun{Sinks: []string{"gchat", "s3"}},
+		},
+		{
+			name:    "invalid sink",
+			dryRun:  `["gchat", "slack"]`,
+			wantErr: "dry_run: invalid sink: slack (want one of: github, gchat, s3, sns, pubsub, audit)",
+		},
+		{
+			name:    "invalid type",
+			dryRun:  `"yes"`,
+			wantErr: `dry_run: want a boolean or a list of sink names: have: "yes"`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) { test(t, tc) })
+	}
+}
+
+func TestPutParamsContextVars(t *testing.T) {
+	type testCase struct {
+		name    string
+		context string
+		vars    map[string]string
+		want    string
+		wantErr string
+	}
+
+	test := func(t *testing.T, tc testCase) {
+		params := cogito.PutParams{Context: tc.context, ContextVars: tc.vars}
+
+		err := params.Validate()
+
+		if tc.wantErr != "" {
+			assert.Error(t, err, tc.wantErr)
+			return
+		}
+		assert.NilError(t, err)
+		assert.Equal(t, params.Context, tc.want)
+	}
+
+	testCases := []testCase{
+		{
+			name:    "no placeholders",
+			context: "unit-tests",
+			want:    "unit-tests",
+		},
+		{
+			name:    "placeholders substituted",
+			context: "tests/${os}-${arch}",
+			vars:    map[string]string{"os": "linux", "arch": "arm64"},
+			want:    "tests/linux-arm64",
+		},
+		{
+			name:    "shell-like syntax without braces is left as-is",
+			context: "cost-$5",
+			want:    "cost-$5",
+		},
+		{
+			name:    "unmatched placeholders",
+			context: "tests/${os}-${arch}-${go}",
+			vars:    map[string]string{"os": "linux"},
+			wantErr: "params: context: unmatched placeholders: ${arch}, ${go} (not in context_vars)",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) { test(t, tc) })
+	}
+}
+
+func TestPutParamsEnvRefs(t *testing.T) {
+	t.Setenv("COGITO_TEST_CONTEXT", "tests/linux")
+	t.Setenv("COGITO_TEST_MESSAGE", "")
+	params := cogito.PutParams{
+		Context:     "env:COGITO_TEST_CONTEXT",
+		ChatMessage: "env:COGITO_TEST_MESSAGE",
+	}
+
+	err := params.Validate()
+
+	assert.NilError(t, err)
+	assert.Equal(t, params.Context, "tests/linux")
+	assert.Equal(t, params.ChatMessage, "")
+}
+
+func TestPutParamsEnvRefsFailure(t *testing.T) {
+	params := cogito.PutParams{PendingDescription: "env:COGITO_TEST_NOT_SET"}
+
+	err := params.Validate()
+
+	assert.Error(t, err,
+		"params: pending_description: env:COGITO_TEST_NOT_SET: environment variable not set")
+}
+
+func TestPutParamsEnvRefsLiteral(t *testing.T) {
+	type testCase struct {
+		name    string
+		context string
+	}
+
+	test := func(t *testing.T, tc testCase) {
+		t.Setenv("COGITO_TEST_CONTEXT", "tests/linux")
+		params := cogito.PutParams{Context: tc.context}
+
+		err := params.Validate()
+
+		assert.NilError(t, err)
+		assert.Equal(t, params.Context, tc.context)
+	}
+
+	testCases := []testCase{
+		{name: "space after the prefix", context: "env: COGITO_TEST_CONTEXT"},
+		{name: "not a variable name", context: "env:staging/linux"},
+		{name: "empty name", context: "env:"},
+		{name: "prefix not at the start", context: "prod-env:COGITO_TEST_CONTEXT"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) { test(t, tc) })
+	}
+}
+
+func TestPutParamsArtifactURLsFailure(t *testing.T) {
+	type testCase struct {
+		name    string
+		urls    []string
+		wantErr string
+	}
+
+	test := func(t *testing.T, tc testCase) {
+		params := cogito.PutParams{ArtifactURLs: tc.urls}
+
+		err := params.Validate()
+
+		assert.Error(t, err, tc.wantErr)
+	}
+
+	testCases := []testCase{
+		{
+			name:    "relative URL",
+			urls:    []string{"https://example.com/a.zip", "builds/42/b.zip"},
+			wantErr: "params: invalid artifact_urls: builds/42/b.zip (want: absolute URL)",
+		},
+		{
+			name:    "missing host",
+			urls:    []string{"https:///a.zip"},
+			wantErr: "params: invalid artifact_urls: https:///a.zip (want: absolute URL)",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) { test(t, tc) })
+	}
+}
+
+func TestPutParamsTargetsFailure(t *testing.T) {
+	type testCase struct {
+		name    string
+		targets []cogito.Target
+		wantErr string
+	}
+
+	test := func(t *testing.T, tc testCase) {
+		params := cogito.PutParams{Targets: tc.targets}
+
+		err := params.Validate()
+
+		assert.Error(t, err, tc.wantErr)
+	}
+
+	sha := strings.Repeat("a", 40)
+	testCases := []testCase{
+		{
+			name: "missing keys",
+			targets: []cogito.Target{
+				{Owner: "the-owner", Repo: "sub-a", SHA: sha},
+				{Owner: "the-owner"},
+			},
+			wantErr: "params: targets[1]: missing keys: repo, sha",
+		},
+		{
+			name:    "invalid sha",
+			targets: []cogito.Target{{Owner: "the-owner", Repo: "sub-a", SHA: "main"}},
+			wantErr: "params: targets[0]: invalid sha: main (want: 40 hex digits)",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) { test(t, tc) })
+	}
+}
+
+func TestPutParamsContextTemplateFailure(t *testing.T) {
+	type testCase struct {
+		name    string
+		params  cogito.PutParams
+		wantErr string
+	}
+
+	test := func(t *testing.T, tc testCase) {
+		in := basePutRequest
+		in.Params = tc.params
+		in.Params.State = cogito.StatePending
+
+		_, err := cogito.NewPutRequest(testhelp.ToJSON(t, in))
+
+		assert.Error(t, err, tc.wantErr)
+	}
+
+	testCases := []testCase{
+		{
+			name: "also context",
+			params: cogito.PutParams{
+				Context:         "the-context",
+				ContextTemplate: "{{ .Env.BuildJobName }}",
+			},
+			wantErr: "put: params: context and context_template are mutually exclusive",
+		},
+		{
+			name:    "invalid template",
+			params:  cogito.PutParams{ContextTemplate: "{{ .Env.BuildJobName"},
+			wantErr: "put: params: invalid context_template: template: context_template:1: unclosed action",
+		},
+		{
+			name:    "missing var",
+			params:  cogito.PutParams{ContextTemplate: "tests ({{ .Vars.os }})"},
+			wantErr: `put: params: context_template: executing template context_template: template: context_template:1:15: executing "context_template" at <.Vars.os>: map has no entry for key "os"`,
+		},
+		{
+			name:    "empty context",
+			params:  cogito.PutParams{ContextTemplate: "{{ .Env.BuildTeamName }}"},
+			wantErr: "put: params: context_template: rendered to an empty context",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) { test(t, tc) })
+	}
+}
+
+func TestPutParamsChatMessageFile(t *testing.T) {
+	type testCase struct {
+		name     string
+		files    string
+		want     cogito.FileList
+		wantJSON string
+		wantErr  string
+	}
+
+	test := func(t *testing.T, tc testCase) {
+		input := fmt.Sprintf(`{"state": "error", "chat_message_file": %s}`, tc.files)
+		var params cogito.PutParams
+
+		err := json.Unmarshal([]byte(input), &params)
+
+		if tc.wantErr != "" {
+			assert.Error(t, err, tc.wantErr)
+			return
+		}
+		assert.NilError(t, err)
+		assert.DeepEqual(t, params.ChatMessageFile, tc.want)
+		data, err := json.Marshal(params.ChatMessageFile)
+		assert.NilError(t, err)
+		assert.Equal(t, string(data), tc.wantJSON)
+	}
+
+	testCases := []testCase{
+		{
+			name:     "one file",
+			files:    `"dir/msg.txt"`,
+			want:     cogito.FileList{"dir/msg.txt"},
+			wantJSON: `"dir/msg.txt"`,
+		},
+		{
+			name:     "list of files",
+			files:    `["tests/summary.txt", "coverage/summary.txt"]`,
+			want:     cogito.FileList{"tests/summary.txt", "coverage/summary.txt"},
+			wantJSON: `["tests/summary.txt","coverage/summary.txt"]`,
+		},
+		{
+			name:    "invalid type",
+			files:   `42`,
+			wantErr: `chat_message_file: want a string or a list of strings: have: 42`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) { test(t, tc) })
+	}
+}
+
 func TestSourcePrintLogRedaction(t *testing.T) {
 	source := cogito.Source{
-		Owner:              "the-owner",
-		Repo:               "the-repo",
-		AccessToken:        "sensitive-the-access-token",
-		GChatWebHook:       "sensitive-gchat-webhook",
-		LogLevel:           "debug",
-		ContextPrefix:      "the-prefix",
-		ChatAppendSummary:  true,
-		ChatNotifyOnStates: []cogito.BuildState{cogito.StateSuccess, cogito.StateFailure},
+		Owner:                "the-owner",
+		Repo:                 "the-repo",
+		AccessToken:          "sensitive-the-access-token",
+		GChatWebHook:         "sensitive-gchat-webhook",
+		LogLevel:             "debug",
+		ContextPrefix:        "the-prefix",
+		DefaultContext:       "the-context",
+		ContextBrand:         "the-brand",
+		ChatAppendSummary:    true,
+		ChatNotifyOnStates:   []cogito.BuildState{cogito.StateSuccess, cogito.StateFailure},
+		S3Bucket:             "the-bucket",
+		S3AccessKey:          "sensitive-s3-access-key",
+		S3SecretKey:          "sensitive-s3-secret-key",
+		SNSSecretKey:         "sensitive-sns-secret-key",
+		PubSubServiceAccount: "sensitive-pubsub-service-account",
 	}
 
 	t.Run("fmt.Print redacts fields", func(t *testing.T) {
-		want := `owner:                 the-owner
-repo:                  the-repo
-access_token:          ***REDACTED***
-gchat_webhook:         ***REDACTED***
-log_level:             debug
-context_prefix:        the-prefix
-chat_append_summary:   true
-chat_notify_on_states: [success failure]`
+		want := `owner:                       the-owner
+repo:                        the-repo
+access_token:                ***REDACTED***
+token_command:               
+gchat_webhook:               ***REDACTED***
+gchat_webhook_file:          
+log_level:                   debug
+log_level_check:             
+log_level_in:                
+log_level_out:               
+log_file:                    
+redaction_marker:            
+context_prefix:              the-prefix
+default_context:             the-context
+context_brand:               the-brand
+manual_context:              
+context_by_branch:           map[]
+on_unknown_state:            
+context_overflow:            
+chat_append_summary:         true
+chat_notify_on_states:       [success failure]
+chat_warn_if_never:          false
+chat_error_if_never:         false
+gchat_once_per_build:        false
+chat_notify_on_change:       false
+chat_footer:                 
+chat_show_transition:        false
+chat_split_long_messages:    false
+chat_preflight:              false
+gchat_check_webhook:         false
+skip_notify_trailer:         
+warn_on_max_statuses:        false
+warn_on_context_collision:   false
+github_timeout:              
+github_max_rps:              0
+gchat_timeout:               
+put_timeout:                 
+verify_sha:                  false
+verify_after_post:           false
+fail_on_shallow:             false
+report_first_terminal_only:  false
+dry_run:                     false
+debug_dump_requests:         false
+disable_keep_alives:         false
+report_skipped_sinks:        false
+ignore_sink_errors:          false
+strict_github:               false
+non_blocking_sinks:          []
+non_blocking_window:         
+sinks:                       []
+audit_log_file:              
+expected_default_branch:     
+canonicalize_repo:           false
+description_state_prefix:    map[]
+description_append_pipeline: false
+require_description:         false
+check_report_rate_limit:     false
+s3_endpoint:                 
+s3_region:                   
+s3_bucket:                   the-bucket
+s3_prefix:                   
+s3_access_key:               ***REDACTED***
+s3_secret_key:               ***REDACTED***
+sns_topic_arn:               
+sns_endpoint:                
+aws_region:                  
+sns_access_key:              
+sns_secret_key:              ***REDACTED***
+pubsub_project:              
+pubsub_topic:                
+pubsub_endpoint:             
+pubsub_service_account:      ***REDACTED***`
 
 		have := fmt.Sprint(source)
 
@@ -175,14 +927,78 @@ chat_notify_on_states: [success failure]`
 		input := cogito.Source{
 			Owner: "the-owner",
 		}
-		want := `owner:                 the-owner
-repo:                  
-access_token:          
-gchat_webhook:         
-log_level:             
-context_prefix:        
-chat_append_summary:   false
-chat_notify_on_states: []`
+		want := `owner:                       the-owner
+repo:                        
+access_token:                
+token_command:               
+gchat_webhook:               
+gchat_webhook_file:          
+log_level:                   
+log_level_check:             
+log_level_in:                
+log_level_out:               
+log_file:                    
+redaction_marker:            
+context_prefix:              
+default_context:             
+context_brand:               
+manual_context:              
+context_by_branch:           map[]
+on_unknown_state:            
+context_overflow:            
+chat_append_summary:         false
+chat_notify_on_states:       []
+chat_warn_if_never:          false
+chat_error_if_never:         false
+gchat_once_per_build:        false
+chat_notify_on_change:       false
+chat_footer:                 
+chat_show_transition:        false
+chat_split_long_messages:    false
+chat_preflight:              false
+gchat_check_webhook:         false
+skip_notify_trailer:         
+warn_on_max_statuses:        false
+warn_on_context_collision:   false
+github_timeout:              
+github_max_rps:              0
+gchat_timeout:               
+put_timeout:                 
+verify_sha:                  false
+verify_after_post:           false
+fail_on_shallow:             false
+report_first_terminal_only:  false
+dry_run:                     false
+debug_dump_requests:         false
+disable_keep_alives:         false
+report_skipped_sinks:        false
+ignore_sink_errors:          false
+strict_github:               false
+non_blocking_sinks:          []
+non_blocking_window:         
+sinks:                       []
+audit_log_file:              
+expected_default_branch:     
+canonicalize_repo:           false
+description_state_prefix:    map[]
+description_append_pipeline: false
+require_description:         false
+check_report_rate_limit:     false
+s3_endpoint:                 
+s3_region:                   
+s3_bucket:                   
+s3_prefix:                   
+s3_access_key:               
+s3_secret_key:               
+sns_topic_arn:               
+sns_endpoint:                
+aws_region:                  
+sns_access_key:              
+sns_secret_key:              
+pubsub_project:              
+pubsub_topic:                
+pubsub_endpoint:             
+pubsub_service_account:      `
 
 		have := fmt.Sprint(input)
 
@@ -196,9 +1012,48 @@ chat_notify_on_states: []`
 		log.Info("log test", "source", source)
 		have := logBuf.String()
 
-		assert.Assert(t, cmp.Contains(have, "| access_token:          ***REDACTED***"))
-		assert.Assert(t, cmp.Contains(have, "| gchat_webhook:         ***REDACTED***"))
+		assert.Assert(t, cmp.Contains(have, "| access_token:                ***REDACTED***"))
+		assert.Assert(t, cmp.Contains(have, "| gchat_webhook:               ***REDACTED***"))
+		assert.Assert(t, cmp.Contains(have, "| s3_secret_key:               ***REDACTED***"))
+		assert.Assert(t, cmp.Contains(have, "| sns_secret_key:              ***REDACTED***"))
+		assert.Assert(t, !strings.Contains(have, "sensitive"))
+	})
+}
+
+func TestSourceRedactionMarker(t *testing.T) {
+	t.Run("from source", func(t *testing.T) {
+		source := cogito.Source{
+			AccessToken:     "sensitive-the-access-token",
+			RedactionMarker: "[scrubbed]",
+		}
+
+		have := fmt.Sprint(source)
+
+		assert.Assert(t, cmp.Contains(have, "access_token:                [scrubbed]\n"))
 		assert.Assert(t, !strings.Contains(have, "sensitive"))
+		assert.Assert(t, !strings.Contains(have, "***REDACTED***"))
+	})
+
+	t.Run("from env, also for the params", func(t *testing.T) {
+		t.Setenv("COGITO_REDACTION_MARKER", "[scrubbed]")
+		source := cogito.Source{
+			Owner:       "the-owner",
+			Repo:        "the-repo",
+			AccessToken: "sensitive-the-access-token",
+		}
+		assert.NilError(t, source.Validate())
+		t.Cleanup(func() {
+			// Restore the default marker for the other tests.
+			source := cogito.Source{Owner: "o", Repo: "r", AccessToken: "t",
+				RedactionMarker: "***REDACTED***"}
+			assert.NilError(t, source.Validate())
+		})
+		params := cogito.PutParams{GChatWebHook: "sensitive-gchat-webhook"}
+
+		assert.Assert(t, cmp.Contains(fmt.Sprint(source),
+			"access_token:                [scrubbed]\n"))
+		assert.Assert(t, cmp.Contains(fmt.Sprint(params),
+			"gchat_webhook:          [scrubbed]\n"))
 	})
 }
 
@@ -207,17 +1062,31 @@ func TestPutParamsPrintLogRedaction(t *testing.T) {
 		State:           cogito.StatePending,
 		Context:         "johnny",
 		ChatMessage:     "stecchino",
-		ChatMessageFile: "dir/msg.txt",
+		ChatMessageFile: cogito.FileList{"dir/msg.txt"},
 		GChatWebHook:    "sensitive-gchat-webhook",
 	}
 
 	t.Run("fmt.Print redacts fields", func(t *testing.T) {
-		want := `state:               pending
-context:             johnny
-chat_message:        stecchino
-chat_message_file:   dir/msg.txt
-chat_append_summary: false
-gchat_webhook:       ***REDACTED***`
+		want := `state:                  pending
+context:                johnny
+context_vars:           map[]
+context_template:       
+chat_message:           stecchino
+chat_message_file:      dir/msg.txt
+chat_digest_from_dir:   
+chat_append_summary:    false
+gchat_webhook:          ***REDACTED***
+annotate_timestamp:     false
+pull_request_number:    0
+repo_dir:               
+normalize_line_endings: false
+multi_ref_pattern:      
+started_at:             
+save_response:          false
+artifact_urls:          []
+targets:                []
+success_description:    
+pending_description:    `
 
 		have := fmt.Sprint(params)
 
@@ -229,12 +1098,26 @@ gchat_webhook:       ***REDACTED***`
 			State: cogito.StateFailure,
 		}
 		// Trailing spaces here are needed.
-		want := `state:               failure
-context:             
-chat_message:        
-chat_message_file:   
-chat_append_summary: false
-gchat_webhook:       `
+		want := `state:                  failure
+context:                
+context_vars:           map[]
+context_template:       
+chat_message:           
+chat_message_file:      
+chat_digest_from_dir:   
+chat_append_summary:    false
+gchat_webhook:          
+annotate_timestamp:     false
+pull_request_number:    0
+repo_dir:               
+normalize_line_endings: false
+multi_ref_pattern:      
+started_at:             
+save_response:          false
+artifact_urls:          []
+targets:                []
+success_description:    
+pending_description:    `
 
 		have := fmt.Sprint(input)
 
@@ -248,7 +1131,7 @@ gchat_webhook:       `
 		log.Info("log test", "params", params)
 		have := logBuf.String()
 
-		assert.Assert(t, cmp.Contains(have, "| gchat_webhook:       ***REDACTED***"))
+		assert.Assert(t, cmp.Contains(have, "| gchat_webhook:          ***REDACTED***"))
 		assert.Assert(t, !strings.Contains(have, "sensitive"))
 	})
 }
@@ -272,12 +1155,30 @@ func TestEnvironment(t *testing.T) {
 }
 
 func TestBuildStateUnmarshalJSONSuccess(t *testing.T) {
-	var state cogito.BuildState
+	type testCase struct {
+		data string
+		want cogito.BuildState
+	}
 
-	err := state.UnmarshalJSON([]byte(`"pending"`))
+	test := func(t *testing.T, tc testCase) {
+		var state cogito.BuildState
 
-	assert.NilError(t, err)
-	assert.Equal(t, state, cogito.StatePending)
+		err := state.UnmarshalJSON([]byte(tc.data))
+
+		assert.NilError(t, err)
+		assert.Equal(t, state, tc.want)
+	}
+
+	testCases := []testCase{
+		{data: `"pending"`, want: cogito.StatePending},
+		{data: `"skipped"`, want: cogito.StateSkipped},
+		{data: `"queued"`, want: cogito.StateQueued},
+		{data: `"neutral"`, want: cogito.StateNeutral},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.data, func(t *testing.T) { test(t, tc) })
+	}
 }
 
 func TestBuildStateUnmarshalJSONFailure(t *testing.T) {
@@ -0,0 +1,93 @@
+package cogito
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/Pix4D/cogito/gcp"
+	"github.com/hashicorp/go-hclog"
+)
+
+// PubSubSink is an implementation of [Sinker] for the Cogito resource.
+// It publishes a build event to a Google Cloud Pub/Sub topic.
+type PubSubSink struct {
+	Log     hclog.Logger
+	GitRef  string
+	Request PutRequest
+	// Skips, if not nil, records why the message is not sent.
+	Skips SkipReport
+	// Transport sends the HTTP requests; nil means [http.DefaultTransport].
+	Transport http.RoundTripper
+	// Ctx is the context of the put step, see source.put_timeout. Nil means
+	// [context.Background].
+	Ctx context.Context
+}
+
+// Send publishes to the configured topic the same JSON status record written by
+// [S3Sink], with attributes owner, repo, context and state, like [SNSSink]. It
+// authenticates with an OAuth token obtained for the configured service account. Like
+// the chat, it honors source.chat_notify_on_states.
+func (sink PubSubSink) Send() error {
+	sink.Log.Debug("send: started")
+	defer sink.Log.Debug("send: finished")
+
+	src := sink.Request.Source
+	state := sink.Request.Params.State
+	if !stateIn(state, src.ChatNotifyOnStates) {
+		sink.Log.Debug("not sending",
+			"reason", "state not in chat_notify_on_states", "state", state)
+		sink.Skips.Add(sinkPubSub, "state not in chat_notify_on_states")
+		return nil
+	}
+
+	record := S3StatusRecord{
+		Owner:    src.Owner,
+		Repo:     src.Repo,
+		SHA:      sink.GitRef,
+		Context:  ghMakeContext(sink.Request),
+		State:    string(state),
+		BuildURL: concourseBuildURL(sink.Request.Env),
+		Time:     time.Now().UTC(),
+	}
+	data, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("PubSubSink: %s", err)
+	}
+	attributes := map[string]string{
+		"owner":   record.Owner,
+		"repo":    record.Repo,
+		"context": record.Context,
+		"state":   record.State,
+	}
+
+	sa, err := gcp.ParseServiceAccount([]byte(src.PubSubServiceAccount))
+	if err != nil {
+		return fmt.Errorf("PubSubSink: pubsub_service_account: %s", err)
+	}
+	endpoint := src.PubSubEndpoint
+	if endpoint == "" {
+		endpoint = gcp.PubSubEndpoint
+	}
+	topic := gcp.PubSubTopic{
+		Endpoint: endpoint,
+		Project:  src.PubSubProject,
+		Topic:    src.PubSubTopic,
+	}
+
+	ctx, cancel := context.WithTimeout(orBackground(sink.Ctx), 30*time.Second)
+	defer cancel()
+	token, err := gcp.AccessToken(ctx, sink.Transport, sa, gcp.PubSubScope, time.Now())
+	if err != nil {
+		return fmt.Errorf("PubSubSink: %s", err)
+	}
+	if err := gcp.Publish(ctx, sink.Transport, token, topic, data, attributes); err != nil {
+		return fmt.Errorf("PubSubSink: %s", err)
+	}
+
+	sink.Log.Info("status published successfully to Pub/Sub",
+		"state", record.State, "project", topic.Project, "topic", topic.Topic)
+	return nil
+}
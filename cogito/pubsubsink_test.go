@@ -0,0 +1,109 @@
+package cogito_test
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/Pix4D/cogito/cogito"
+	"github.com/Pix4D/cogito/gcp"
+	"github.com/Pix4D/cogito/testhelp"
+	"github.com/hashicorp/go-hclog"
+	"gotest.tools/v3/assert"
+)
+
+func TestSinkPubSubSendSuccess(t *testing.T) {
+	var auth, path string
+	var publish gcp.PublishRequest
+	ts := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			if req.URL.Path == "/token" {
+				body, _ := io.ReadAll(req.Body)
+				form, _ := url.ParseQuery(string(body))
+				if form.Get("assertion") == "" {
+					w.WriteHeader(http.StatusBadRequest)
+					return
+				}
+				w.Write([]byte(`{"access_token": "the-token"}`))
+				return
+			}
+			auth = req.Header.Get("Authorization")
+			path = req.URL.Path
+			json.NewDecoder(req.Body).Decode(&publish)
+		}))
+	serviceAccount, _ := testhelp.FakeServiceAccount(t, ts.URL+"/token")
+	request := basePutRequest
+	request.Source.PubSubProject = "the-project"
+	request.Source.PubSubTopic = "the-topic"
+	request.Source.PubSubEndpoint = ts.URL
+	request.Source.PubSubServiceAccount = serviceAccount
+	request.Env.BuildJobName = "the-job"
+	assert.NilError(t, request.Source.Validate())
+	sink := cogito.PubSubSink{
+		Log:     hclog.NewNullLogger(),
+		GitRef:  "deadbeef",
+		Request: request,
+	}
+
+	err := sink.Send()
+
+	assert.NilError(t, err)
+	ts.Close() // Avoid races before the following asserts.
+	assert.Equal(t, auth, "Bearer the-token")
+	assert.Equal(t, path, "/v1/projects/the-project/topics/the-topic:publish")
+	assert.Equal(t, len(publish.Messages), 1)
+	var record cogito.S3StatusRecord
+	assert.NilError(t, json.Unmarshal(publish.Messages[0].Data, &record))
+	assert.Equal(t, record.SHA, "deadbeef")
+	assert.Equal(t, record.State, string(cogito.StateError))
+	assert.Equal(t, record.Context, "the-job")
+	assert.DeepEqual(t, publish.Messages[0].Attributes, map[string]string{
+		"context": "the-job",
+		"owner":   "the-owner",
+		"repo":    "the-repo",
+		"state":   "error",
+	})
+}
+
+func TestSinkPubSubSendSkipsStateNotInNotifyStates(t *testing.T) {
+	ts := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			t.Error("unexpected request")
+		}))
+	defer ts.Close()
+	request := basePutRequest
+	request.Params.State = cogito.StatePending
+	request.Source.PubSubTopic = "the-topic"
+	request.Source.PubSubEndpoint = ts.URL
+	request.Source.ChatNotifyOnStates = []cogito.BuildState{cogito.StateFailure}
+	sink := cogito.PubSubSink{
+		Log:     hclog.NewNullLogger(),
+		GitRef:  "deadbeef",
+		Request: request,
+	}
+
+	err := sink.Send()
+
+	assert.NilError(t, err)
+}
+
+func TestSinkPubSubSendInvalidServiceAccount(t *testing.T) {
+	request := basePutRequest
+	request.Source.PubSubProject = "the-project"
+	request.Source.PubSubTopic = "the-topic"
+	// Without Validate, that would reject it.
+	request.Source.PubSubServiceAccount = "banana"
+	request.Source.ChatNotifyOnStates = []cogito.BuildState{request.Params.State}
+	sink := cogito.PubSubSink{
+		Log:     hclog.NewNullLogger(),
+		GitRef:  "deadbeef",
+		Request: request,
+	}
+
+	err := sink.Send()
+
+	assert.ErrorContains(t, err, "PubSubSink: pubsub_service_account: service account: ")
+}
@@ -27,6 +27,20 @@ type Sinker interface {
 	Send() error
 }
 
+// summaryLogger is implemented by the Putters that log a summary line at the end of the
+// put step.
+type summaryLogger interface {
+	// logSummary is called after all the sinks have been invoked, with errs[i] the
+	// error returned by sink i.
+	logSummary(errs []error)
+}
+
+// releaser is implemented by the Putters that hold resources for the whole put step.
+type releaser interface {
+	// release is called when [Put] returns.
+	release()
+}
+
 // Put implements the "put" step (the "out" executable).
 //
 // From https://concourse-ci.org/implementing-resource-types.html#resource-out:
@@ -41,6 +55,10 @@ type Sinker interface {
 // intended for public consumption and will make it upstream, intended to be shown on the
 // build's page.
 func Put(log hclog.Logger, input []byte, out io.Writer, args []string, putter Putter) error {
+	if r, ok := putter.(releaser); ok {
+		defer r.release()
+	}
+
 	if err := putter.LoadConfiguration(input, args); err != nil {
 		return fmt.Errorf("put: %s", err)
 	}
@@ -51,11 +69,17 @@ func Put(log hclog.Logger, input []byte, out io.Writer, args []string, putter Pu
 
 	// We invoke all the sinks and keep going also if some of them return an error.
 	var sinkErrors []error
-	for _, sink := range putter.Sinks() {
+	sinks := putter.Sinks()
+	errs := make([]error, len(sinks))
+	for i, sink := range sinks {
 		if err := sink.Send(); err != nil {
+			errs[i] = err
 			sinkErrors = append(sinkErrors, err)
 		}
 	}
+	if sl, ok := putter.(summaryLogger); ok {
+		sl.logSummary(errs)
+	}
 	if len(sinkErrors) > 0 {
 		return fmt.Errorf("put: %s", multiErrString(sinkErrors))
 	}
@@ -68,15 +92,29 @@ func Put(log hclog.Logger, input []byte, out io.Writer, args []string, putter Pu
 }
 
 // multiErrString takes a slice of errors and returns a formatted string.
+// Identical errors (for example, the network is down for all the sinks) are reported
+// once, in order of first occurrence, followed by "(xN)".
 func multiErrString(errs []error) string {
 	if len(errs) == 1 {
 		return errs[0].Error()
 	}
+	var msgs []string
+	counts := make(map[string]int, len(errs))
+	for _, err := range errs {
+		msg := err.Error()
+		if counts[msg] == 0 {
+			msgs = append(msgs, msg)
+		}
+		counts[msg]++
+	}
 	bld := new(strings.Builder)
 	bld.WriteString("multiple errors:")
-	for _, err := range errs {
+	for _, msg := range msgs {
 		bld.WriteString("\n\t")
-		bld.WriteString(err.Error())
+		bld.WriteString(msg)
+		if n := counts[msg]; n > 1 {
+			fmt.Fprintf(bld, " (x%d)", n)
+		}
 	}
 	return bld.String()
 }
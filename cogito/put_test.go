@@ -1,15 +1,28 @@
 package cogito_test
 
 import (
+	"bytes"
 	"errors"
+	"fmt"
 	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path"
 	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/Pix4D/cogito/cogito"
+	"github.com/Pix4D/cogito/github"
+	"github.com/Pix4D/cogito/googlechat"
 	"github.com/Pix4D/cogito/testhelp"
 	"github.com/hashicorp/go-hclog"
 	"gotest.tools/v3/assert"
+	"gotest.tools/v3/assert/cmp"
 )
 
 var (
@@ -105,6 +118,17 @@ func TestPutFailure(t *testing.T) {
 			},
 			wantErr: "put: multiple errors:\n\tmock: send error 1\n\tmock: send error 2",
 		},
+		{
+			name: "identical sink errors",
+			putter: MockPutter{
+				sinkers: []cogito.Sinker{
+					MockSinker{sendError: errors.New("mock: network down")},
+					MockSinker{sendError: errors.New("mock: network down")},
+					MockSinker{sendError: errors.New("mock: network down")},
+				},
+			},
+			wantErr: "put: multiple errors:\n\tmock: network down (x3)",
+		},
 		{
 			name: "output error",
 			putter: MockPutter{
@@ -159,6 +183,38 @@ func TestPutterLoadConfigurationFailure(t *testing.T) {
 			},
 			wantErr: "put: parsing request: invalid build state: burnt-pizza",
 		},
+		{
+			name: "params: negative pull_request_number",
+			putInput: cogito.PutRequest{
+				Source: baseSource,
+				Params: cogito.PutParams{State: cogito.StatePending, PullRequestNumber: -1},
+			},
+			wantErr: "put: params: invalid pull_request_number: -1 (want: positive)",
+		},
+		{
+			name: "params: invalid multi_ref_pattern",
+			putInput: cogito.PutRequest{
+				Source: baseSource,
+				Params: cogito.PutParams{State: cogito.StatePending, MultiRefPattern: "refs/("},
+			},
+			wantErr: "put: params: invalid multi_ref_pattern: error parsing regexp: missing closing ): `refs/(`",
+		},
+		{
+			name: "params: invalid started_at",
+			putInput: cogito.PutRequest{
+				Source: baseSource,
+				Params: cogito.PutParams{State: cogito.StatePending, StartedAt: "yesterday"},
+			},
+			wantErr: `put: params: invalid started_at: parsing time "yesterday" as "2006-01-02T15:04:05Z07:00": cannot parse "yesterday" as "2006" (want: RFC 3339)`,
+		},
+		{
+			name: "params: invalid chat_digest_from_dir",
+			putInput: cogito.PutRequest{
+				Source: baseSource,
+				Params: cogito.PutParams{State: cogito.StatePending, ChatDigestFromDir: "a/b"},
+			},
+			wantErr: "put: params: invalid chat_digest_from_dir: a/b (want: a directory of the put inputs)",
+		},
 		{
 			name:     "arguments: missing input directory",
 			putInput: basePutRequest,
@@ -186,6 +242,251 @@ func TestPutterLoadConfigurationInvalidParamsFailure(t *testing.T) {
 	assert.Error(t, err, wantErr)
 }
 
+func TestPutterLoadConfigurationOnUnknownState(t *testing.T) {
+	type testCase struct {
+		name       string
+		mode       string
+		wantErr    string
+		wantState  cogito.BuildState
+		wantResult string
+	}
+
+	test := func(t *testing.T, tc testCase) {
+		request := basePutRequest
+		request.Source.OnUnknownState = tc.mode
+		request.Params.State = "burnt-pizza"
+		in := testhelp.ToJSON(t, request)
+		putter := cogito.NewPutter("dummy-API", hclog.NewNullLogger())
+
+		err := putter.LoadConfiguration(in, []string{"dummy-dir"})
+
+		if tc.wantErr != "" {
+			assert.Error(t, err, tc.wantErr)
+			return
+		}
+		assert.NilError(t, err)
+		assert.Equal(t, putter.Request.Params.State, tc.wantState)
+		sinks := putter.Sinks()
+		if tc.wantResult == "" {
+			assert.Assert(t, len(sinks) > 0)
+			return
+		}
+		assert.Equal(t, len(sinks), 0)
+		var out bytes.Buffer
+		assert.NilError(t, putter.Output(&out))
+		var output cogito.Output
+		testhelp.FromJSON(t, out.Bytes(), &output)
+		assert.DeepEqual(t, output.Metadata[1],
+			cogito.Metadata{Name: "cogito_result", Value: tc.wantResult})
+	}
+
+	testCases := []testCase{
+		{
+			name:    "default: fail",
+			wantErr: "put: parsing request: invalid build state: burnt-pizza",
+		},
+		{
+			name:    "fail",
+			mode:    "fail",
+			wantErr: "put: parsing request: invalid build state: burnt-pizza",
+		},
+		{
+			name:      "error: coerced to StateError",
+			mode:      "error",
+			wantState: cogito.StateError,
+		},
+		{
+			name:       "skip: no sinks",
+			mode:       "skip",
+			wantState:  cogito.StateError,
+			wantResult: "2 sinks: github skipped, gchat skipped",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) { test(t, tc) })
+	}
+}
+
+func TestPutterLoadConfigurationEnvRefs(t *testing.T) {
+	t.Setenv("COGITO_TEST_CONTEXT", "tests/linux")
+	request := basePutRequest
+	request.Params.Context = "env:COGITO_TEST_CONTEXT"
+	in := testhelp.ToJSON(t, request)
+	putter := cogito.NewPutter("dummy-API", hclog.NewNullLogger())
+
+	err := putter.LoadConfiguration(in, []string{"dummy-dir"})
+
+	assert.NilError(t, err)
+	assert.Equal(t, putter.Request.Params.Context, "tests/linux")
+}
+
+func TestPutterLoadConfigurationTokenCommand(t *testing.T) {
+	type testCase struct {
+		name      string
+		command   string
+		wantToken string
+		wantErr   string
+	}
+
+	test := func(t *testing.T, tc testCase) {
+		request := basePutRequest
+		request.Source.AccessToken = ""
+		request.Source.TokenCommand = tc.command
+		in := testhelp.ToJSON(t, request)
+		putter := cogito.NewPutter("dummy-API", hclog.NewNullLogger())
+
+		err := putter.LoadConfiguration(in, []string{"dummy-dir"})
+
+		if tc.wantErr != "" {
+			assert.Error(t, err, tc.wantErr)
+			return
+		}
+		assert.NilError(t, err)
+		assert.Equal(t, putter.Request.Source.AccessToken, tc.wantToken)
+		assert.Assert(t, !strings.Contains(putter.Request.Source.String(), tc.wantToken))
+	}
+
+	testCases := []testCase{
+		{
+			name:      "token from stdout",
+			command:   "printf 'the-%s-token' fresh",
+			wantToken: "the-fresh-token",
+		},
+		{
+			name:    "nonzero exit",
+			command: "echo the-fresh-token; echo bad the-fresh-token >&2; exit 3",
+			wantErr: `put: token_command: exit status 3 (stderr: "bad ***REDACTED***")`,
+		},
+		{
+			name:    "empty output",
+			command: "true",
+			wantErr: "put: token_command: empty output, want the access token",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) { test(t, tc) })
+	}
+}
+
+func TestPutterLoadConfigurationContextPrefixFromEnv(t *testing.T) {
+	type testCase struct {
+		name          string
+		contextPrefix string
+		env           string
+		want          string
+	}
+
+	test := func(t *testing.T, tc testCase) {
+		t.Setenv("COGITO_CONTEXT_PREFIX", tc.env)
+		request := basePutRequest
+		request.Source.ContextPrefix = tc.contextPrefix
+		in := testhelp.ToJSON(t, request)
+		putter := cogito.NewPutter("dummy-API", hclog.NewNullLogger())
+
+		err := putter.LoadConfiguration(in, []string{"dummy-dir"})
+
+		assert.NilError(t, err)
+		assert.Equal(t, putter.Request.Source.ContextPrefix, tc.want)
+	}
+
+	testCases := []testCase{
+		{
+			name: "prefix from env",
+			env:  "staging",
+			want: "staging",
+		},
+		{
+			name:          "source has precedence",
+			contextPrefix: "production",
+			env:           "staging",
+			want:          "production",
+		},
+		{
+			name: "neither",
+			want: "",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) { test(t, tc) })
+	}
+}
+
+func TestPutterLoadConfigurationDisableKeepAlives(t *testing.T) {
+	orig := http.DefaultTransport
+	request := basePutRequest
+	request.Source.DisableKeepAlives = true
+	in := testhelp.ToJSON(t, request)
+	putter := cogito.NewPutter("dummy-API", hclog.NewNullLogger())
+
+	err := putter.LoadConfiguration(in, []string{"dummy-dir"})
+
+	assert.NilError(t, err)
+	assert.Equal(t, http.DefaultTransport, orig, "http.DefaultTransport modified")
+	for _, sink := range putter.Sinks() {
+		var rt http.RoundTripper
+		switch sink := sink.(type) {
+		case cogito.GitHubCommitStatusSink:
+			rt = sink.Transport
+		case cogito.GoogleChatSink:
+			rt = sink.Transport
+		default:
+			t.Fatalf("unexpected sink: %T", sink)
+		}
+		tr, ok := rt.(*http.Transport)
+		assert.Assert(t, ok, "have: %T", rt)
+		assert.Assert(t, tr.DisableKeepAlives)
+	}
+}
+
+func TestPutterLoadConfigurationExpectedDefaultBranchFailure(t *testing.T) {
+	ts := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			fmt.Fprint(w, `{"default_branch": "master"}`)
+		}))
+	defer ts.Close()
+	request := basePutRequest
+	request.Source.ExpectedDefaultBranch = "main"
+	in := testhelp.ToJSON(t, request)
+	putter := cogito.NewPutter(ts.URL, hclog.NewNullLogger())
+
+	err := putter.LoadConfiguration(in, []string{"dummy-dir"})
+
+	assert.ErrorContains(t, err, "put: expected_default_branch: have: master; want: main")
+}
+
+func TestPutterLoadConfigurationCanonicalizeRepo(t *testing.T) {
+	var calls int
+	ts := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			calls++
+			fmt.Fprint(w, `{"name": "The-Repo", "owner": {"login": "The-Owner"}}`)
+		}))
+	defer ts.Close()
+	request := basePutRequest
+	request.Source.CanonicalizeRepo = true
+	in := testhelp.ToJSON(t, request)
+	putter := cogito.NewPutter(ts.URL, hclog.NewNullLogger())
+
+	err := putter.LoadConfiguration(in, []string{"dummy-dir"})
+
+	assert.NilError(t, err)
+	assert.Equal(t, calls, 1)
+	assert.Equal(t, putter.Request.Source.Owner, "The-Owner")
+	assert.Equal(t, putter.Request.Source.Repo, "The-Repo")
+	var out bytes.Buffer
+	assert.NilError(t, putter.Output(&out))
+	var output cogito.Output
+	testhelp.FromJSON(t, out.Bytes(), &output)
+	assert.DeepEqual(t, output.Metadata, []cogito.Metadata{
+		{Name: "state", Value: string(request.Params.State)},
+		{Name: "cogito_result", Value: "0 sinks"},
+		{Name: "repo", Value: "The-Owner/The-Repo"},
+	})
+}
+
 func TestPutterProcessInputDirSuccess(t *testing.T) {
 	type testCase struct {
 		name     string
@@ -216,7 +517,73 @@ func TestPutterProcessInputDirSuccess(t *testing.T) {
 		{
 			name:     "two dirs: repo and msg file",
 			inputDir: "testdata/repo-and-msgdir",
-			params:   cogito.PutParams{ChatMessageFile: "msgdir/msg.txt"},
+			params:   cogito.PutParams{ChatMessageFile: cogito.FileList{"msgdir/msg.txt"}},
+		},
+		{
+			name:     "repo_dir: repo among multiple dirs",
+			inputDir: "testdata/repo-and-others",
+			params:   cogito.PutParams{RepoDir: "a-repo"},
+		},
+		{
+			name:     "repo_dir: repo among multiple dirs and msg file",
+			inputDir: "testdata/repo-and-others",
+			params:   cogito.PutParams{RepoDir: "a-repo", ChatMessageFile: cogito.FileList{"dir-1/msg.txt"}},
+		},
+		{
+			name:     "list of msg files in multiple dirs and repo",
+			inputDir: "testdata/repo-and-others",
+			params:   cogito.PutParams{ChatMessageFile: cogito.FileList{"dir-1/msg.txt", "dir-2/hello"}},
+		},
+		{
+			name:     "two dirs: repo and chat_digest_from_dir",
+			inputDir: "testdata/repo-and-msgdir",
+			params:   cogito.PutParams{ChatDigestFromDir: "msgdir"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) { test(t, tc) })
+	}
+}
+
+func TestPutterProcessInputDirGitDirFile(t *testing.T) {
+	type testCase struct {
+		name   string
+		gitDir string // Content of the .git file.
+	}
+
+	test := func(t *testing.T, tc testCase) {
+		var ghReq github.AddRequest
+		var URL *url.URL
+		ts := testhelp.SpyHttpServer(&ghReq, nil, &URL, http.StatusCreated)
+		inputDir := "testdata/repo-worktree"
+		tmpDir := testhelp.MakeGitRepoFromTestdata(t, inputDir,
+			"https://github.com/dummy-owner/dummy-repo", "deadbeefdeadbeef", "dummyHead")
+		putter := cogito.NewPutter(ts.URL, hclog.NewNullLogger())
+		putter.InputDir = filepath.Join(tmpDir, filepath.Base(inputDir))
+		// Git refuses to track a file named .git, so we cannot put it in testdata.
+		assert.NilError(t, os.WriteFile(filepath.Join(putter.InputDir, "a-repo", ".git"),
+			[]byte(tc.gitDir), 0o660))
+		putter.Request = cogito.PutRequest{
+			Source: cogito.Source{Owner: "dummy-owner", Repo: "dummy-repo"},
+			Params: cogito.PutParams{State: cogito.StateSuccess, RepoDir: "a-repo"},
+		}
+
+		assert.NilError(t, putter.ProcessInputDir())
+		assert.NilError(t, putter.Sinks()[0].Send())
+
+		ts.Close() // Avoid races before the following asserts.
+		assert.Equal(t, path.Base(URL.Path), "deadbeefdeadbeef")
+	}
+
+	testCases := []testCase{
+		{
+			name:   "worktree: gitdir with commondir",
+			gitDir: "gitdir: ../main-repo/.git/worktrees/a-repo\n",
+		},
+		{
+			name:   "separate git dir",
+			gitDir: "gitdir: ../main-repo/.git\n",
 		},
 	}
 
@@ -225,6 +592,64 @@ func TestPutterProcessInputDirSuccess(t *testing.T) {
 	}
 }
 
+func TestPutterProcessInputDirGitDirFileFailure(t *testing.T) {
+	inputDir := "testdata/repo-worktree"
+	tmpDir := testhelp.MakeGitRepoFromTestdata(t, inputDir,
+		"https://github.com/dummy-owner/dummy-repo", "deadbeefdeadbeef", "dummyHead")
+	putter := cogito.NewPutter("dummy-API", hclog.NewNullLogger())
+	putter.InputDir = filepath.Join(tmpDir, filepath.Base(inputDir))
+	assert.NilError(t, os.WriteFile(filepath.Join(putter.InputDir, "a-repo", ".git"),
+		[]byte("banana\n"), 0o660))
+	putter.Request = cogito.PutRequest{
+		Source: cogito.Source{Owner: "dummy-owner", Repo: "dummy-repo"},
+		Params: cogito.PutParams{State: cogito.StateSuccess, RepoDir: "a-repo"},
+	}
+
+	err := putter.ProcessInputDir()
+
+	assert.Error(t, err, `git dir: invalid .git file: "banana" (want: gitdir: PATH)`)
+}
+
+func TestPutterProcessInputDirGChatWebHookFile(t *testing.T) {
+	inputDir := "testdata/repo-and-webhook"
+	tmpDir := testhelp.MakeGitRepoFromTestdata(t, inputDir,
+		"https://github.com/dummy-owner/dummy-repo", "dummySHA", "banana")
+	putter := cogito.NewPutter("dummy-API", hclog.NewNullLogger())
+	putter.InputDir = filepath.Join(tmpDir, filepath.Base(inputDir))
+	putter.Request = cogito.PutRequest{
+		Source: cogito.Source{
+			Owner:            "dummy-owner",
+			Repo:             "dummy-repo",
+			GChatWebHookFile: "secrets/webhook",
+		},
+	}
+
+	err := putter.ProcessInputDir()
+
+	assert.NilError(t, err)
+	assert.Equal(t, putter.Request.Source.GChatWebHook,
+		"https://chat.googleapis.com/v1/spaces/the-space/messages?key=the-key")
+}
+
+func TestPutterProcessInputDirGChatWebHookFileFailure(t *testing.T) {
+	inputDir := "testdata/repo-and-webhook"
+	tmpDir := testhelp.MakeGitRepoFromTestdata(t, inputDir,
+		"https://github.com/dummy-owner/dummy-repo", "dummySHA", "banana")
+	putter := cogito.NewPutter("dummy-API", hclog.NewNullLogger())
+	putter.InputDir = filepath.Join(tmpDir, filepath.Base(inputDir))
+	putter.Request = cogito.PutRequest{
+		Source: cogito.Source{
+			Owner:            "dummy-owner",
+			Repo:             "dummy-repo",
+			GChatWebHookFile: "secrets/banana",
+		},
+	}
+
+	err := putter.ProcessInputDir()
+
+	assert.ErrorContains(t, err, "put:inputs: reading gchat_webhook_file: open ")
+}
+
 func TestPutterProcessInputDirFailure(t *testing.T) {
 	type testCase struct {
 		name     string
@@ -272,21 +697,39 @@ func TestPutterProcessInputDirFailure(t *testing.T) {
 		{
 			name:     "repo and msgdir, but missing dir in chat_message_file",
 			inputDir: "testdata/repo-and-msgdir",
-			params:   cogito.PutParams{ChatMessageFile: "msg.txt"},
+			params:   cogito.PutParams{ChatMessageFile: cogito.FileList{"msg.txt"}},
 			wantErr:  "chat_message_file: wrong format: have: msg.txt, want: path of the form: <dir>/<file>",
 		},
 		{
 			name:     "chat_message_file specified but different put:inputs",
 			inputDir: "testdata/repo-and-msgdir",
-			params:   cogito.PutParams{ChatMessageFile: "banana/msg.txt"},
+			params:   cogito.PutParams{ChatMessageFile: cogito.FileList{"banana/msg.txt"}},
 			wantErr:  "put:inputs: directory for chat_message_file not found: have: [a-repo msgdir], chat_message_file: banana/msg.txt",
 		},
 		{
 			name:     "chat_message_file specified but too few put:inputs",
 			inputDir: "testdata/one-repo",
-			params:   cogito.PutParams{ChatMessageFile: "banana/msg.txt"},
+			params:   cogito.PutParams{ChatMessageFile: cogito.FileList{"banana/msg.txt"}},
 			wantErr:  "put:inputs: directory for chat_message_file not found: have: [a-repo], chat_message_file: banana/msg.txt",
 		},
+		{
+			name:     "chat_digest_from_dir specified but different put:inputs",
+			inputDir: "testdata/repo-and-msgdir",
+			params:   cogito.PutParams{ChatDigestFromDir: "banana"},
+			wantErr:  "put:inputs: directory for chat_digest_from_dir not found: have: [a-repo msgdir], chat_digest_from_dir: banana",
+		},
+		{
+			name:     "repo_dir: not found",
+			inputDir: "testdata/repo-and-others",
+			params:   cogito.PutParams{RepoDir: "banana"},
+			wantErr:  "put:inputs: directory for repo_dir not found: have: [a-repo dir-1 dir-2], repo_dir: banana",
+		},
+		{
+			name:     "repo_dir: not a repo",
+			inputDir: "testdata/repo-and-others",
+			params:   cogito.PutParams{RepoDir: "dir-1"},
+			wantErr:  "put:inputs: repo_dir: not a git repository: stat ",
+		},
 	}
 
 	for _, tc := range testCases {
@@ -294,42 +737,1226 @@ func TestPutterProcessInputDirFailure(t *testing.T) {
 	}
 }
 
-func TestPutterProcessInputDirNonExisting(t *testing.T) {
-	putter := &cogito.ProdPutter{
-		InputDir: "non-existing",
-		Request:  cogito.PutRequest{Source: baseSource},
+func TestPutterProcessInputDirPreviousState(t *testing.T) {
+	ts := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			fmt.Fprintln(w, `{"statuses": [{"state": "pending", "context": "the-job"}]}`)
+		}))
+	defer ts.Close()
+	inputDir := "testdata/one-repo"
+	tmpDir := testhelp.MakeGitRepoFromTestdata(t, inputDir,
+		"https://github.com/dummy-owner/dummy-repo", "dummySHA", "banana")
+	putter := cogito.NewPutter(ts.URL, hclog.NewNullLogger())
+	putter.InputDir = filepath.Join(tmpDir, filepath.Base(inputDir))
+	putter.Request = cogito.PutRequest{
+		Source: cogito.Source{
+			Owner:              "dummy-owner",
+			Repo:               "dummy-repo",
+			ChatShowTransition: true,
+		},
+		Env: cogito.Environment{BuildJobName: "the-job"},
 	}
 
 	err := putter.ProcessInputDir()
 
-	assert.ErrorContains(t, err,
-		"collecting directories in non-existing: open non-existing: no such file or directory")
+	assert.NilError(t, err)
+	chatSink := putter.Sinks()[1].(cogito.GoogleChatSink)
+	assert.Equal(t, chatSink.PrevState, cogito.StatePending)
 }
 
-func TestPutterSinks(t *testing.T) {
-	putter := cogito.NewPutter("dummy-API", hclog.NewNullLogger())
+func TestPutterProcessInputDirWarnOnContextCollision(t *testing.T) {
+	type testCase struct {
+		name      string
+		targetURL string
+		wantWarn  bool
+	}
 
-	sinks := putter.Sinks()
+	test := func(t *testing.T, tc testCase) {
+		ts := httptest.NewServer(
+			http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				fmt.Fprintf(w, `{"statuses": [{"state": "success", "context": "the-job", "target_url": %q}]}`,
+					tc.targetURL)
+			}))
+		defer ts.Close()
+		inputDir := "testdata/one-repo"
+		tmpDir := testhelp.MakeGitRepoFromTestdata(t, inputDir,
+			"https://github.com/dummy-owner/dummy-repo", "dummySHA", "cafe0000cafe0000")
+		var logBuf bytes.Buffer
+		log := hclog.New(&hclog.LoggerOptions{Output: &logBuf})
+		putter := cogito.NewPutter(ts.URL, log)
+		putter.InputDir = filepath.Join(tmpDir, filepath.Base(inputDir))
+		putter.Request = cogito.PutRequest{
+			Source: cogito.Source{
+				Owner:                  "dummy-owner",
+				Repo:                   "dummy-repo",
+				WarnOnContextCollision: true,
+			},
+			Params: cogito.PutParams{State: cogito.StatePending},
+			Env: cogito.Environment{
+				BuildJobName:   "the-job",
+				AtcExternalUrl: "https://ci.example.com",
+			},
+		}
 
-	assert.Assert(t, len(sinks) == 2)
-	_, ok1 := sinks[0].(cogito.GitHubCommitStatusSink)
-	assert.Assert(t, ok1)
-	_, ok2 := sinks[1].(cogito.GoogleChatSink)
-	assert.Assert(t, ok2)
-}
+		err := putter.ProcessInputDir()
 
-func TestPutterOutputSuccess(t *testing.T) {
-	putter := cogito.NewPutter("dummy-API", hclog.NewNullLogger())
+		assert.NilError(t, err)
+		have := strings.Contains(logBuf.String(), "context collision")
+		assert.Equal(t, have, tc.wantWarn, "log:\n%s", logBuf.String())
+	}
 
-	err := putter.Output(io.Discard)
+	testCases := []testCase{
+		{
+			name:      "posted by another tool",
+			targetURL: "https://other-ci.example.com/builds/1",
+			wantWarn:  true,
+		},
+		{
+			name:      "posted by us",
+			targetURL: "https://ci.example.com/teams/main/pipelines/p/jobs/the-job/builds/1",
+			wantWarn:  false,
+		},
+	}
 
-	assert.NilError(t, err)
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) { test(t, tc) })
+	}
 }
 
-func TestPutterOutputFailure(t *testing.T) {
-	putter := cogito.NewPutter("dummy-API", hclog.NewNullLogger())
+func TestPutterProcessInputDirSkipNotifyTrailer(t *testing.T) {
+	type testCase struct {
+		name     string
+		inputDir string
+		want     bool
+	}
 
-	err := putter.Output(&testhelp.FailingWriter{})
+	test := func(t *testing.T, tc testCase) {
+		tmpDir := testhelp.MakeGitRepoFromTestdata(t, tc.inputDir,
+			"https://github.com/dummy-owner/dummy-repo", "dummySHA", "banana")
+		putter := cogito.NewPutter("dummy-API", hclog.NewNullLogger())
+		putter.InputDir = filepath.Join(tmpDir, filepath.Base(tc.inputDir))
+		putter.Request = cogito.PutRequest{
+			Source: cogito.Source{
+				Owner:             "dummy-owner",
+				Repo:              "dummy-repo",
+				SkipNotifyTrailer: "Cogito-Skip-Notify",
+			},
+		}
 
-	assert.Error(t, err, "put: test write error")
+		err := putter.ProcessInputDir()
+
+		assert.NilError(t, err)
+		chatSink := putter.Sinks()[1].(cogito.GoogleChatSink)
+		assert.Equal(t, chatSink.SkipNotify, tc.want)
+	}
+
+	testCases := []testCase{
+		{
+			name:     "commit message with the trailer",
+			inputDir: "testdata/repo-skip-notify",
+			want:     true,
+		},
+		{
+			name:     "no commit message",
+			inputDir: "testdata/one-repo",
+			want:     false,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) { test(t, tc) })
+	}
+}
+
+func TestPutterProcessInputDirShallowClone(t *testing.T) {
+	inputDir := "testdata/repo-shallow"
+	tmpDir := testhelp.MakeGitRepoFromTestdata(t, inputDir,
+		"https://github.com/dummy-owner/dummy-repo", "dummySHA", "cafe0000cafe0000")
+
+	t.Run("warning", func(t *testing.T) {
+		var logBuf bytes.Buffer
+		log := hclog.New(&hclog.LoggerOptions{Output: &logBuf})
+		putter := cogito.NewPutter("dummy-API", log)
+		putter.InputDir = filepath.Join(tmpDir, filepath.Base(inputDir))
+		putter.Request = cogito.PutRequest{
+			Source: cogito.Source{Owner: "dummy-owner", Repo: "dummy-repo"},
+		}
+
+		err := putter.ProcessInputDir()
+
+		assert.NilError(t, err)
+		assert.Assert(t, cmp.Contains(logBuf.String(),
+			"[WARN]  git repo is a shallow clone: the reported SHA may be a grafted commit"))
+	})
+
+	t.Run("fail_on_shallow", func(t *testing.T) {
+		putter := cogito.NewPutter("dummy-API", hclog.NewNullLogger())
+		putter.InputDir = filepath.Join(tmpDir, filepath.Base(inputDir))
+		putter.Request = cogito.PutRequest{
+			Source: cogito.Source{
+				Owner:         "dummy-owner",
+				Repo:          "dummy-repo",
+				FailOnShallow: true,
+			},
+		}
+
+		err := putter.ProcessInputDir()
+
+		assert.Error(t, err, "put:inputs: git repo is a shallow clone (fail_on_shallow is set)")
+	})
+}
+
+func TestPutterMultiRefPattern(t *testing.T) {
+	var mu sync.Mutex
+	var paths []string
+	ts := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			mu.Lock()
+			paths = append(paths, path.Base(req.URL.Path))
+			mu.Unlock()
+			w.WriteHeader(http.StatusCreated)
+		}))
+	inputDir := "testdata/repo-multi-ref"
+	tmpDir := testhelp.MakeGitRepoFromTestdata(t, inputDir,
+		"https://github.com/dummy-owner/dummy-repo", "dummySHA", "cafe0000cafe0000")
+	putter := cogito.NewPutter(ts.URL, hclog.NewNullLogger())
+	putter.InputDir = filepath.Join(tmpDir, filepath.Base(inputDir))
+	putter.Request = cogito.PutRequest{
+		Source: cogito.Source{Owner: "dummy-owner", Repo: "dummy-repo"},
+		Params: cogito.PutParams{
+			State:           cogito.StateSuccess,
+			MultiRefPattern: "^refs/tags/sub-a/",
+		},
+	}
+
+	assert.NilError(t, putter.ProcessInputDir())
+	for _, sink := range putter.Sinks() {
+		assert.NilError(t, sink.Send())
+	}
+
+	ts.Close() // Avoid races before the following asserts.
+	assert.DeepEqual(t, paths, []string{"cafe0000cafe0000", "aaaa1111aaaa1111", "aaaa2222aaaa2222"})
+}
+
+func TestPutterMultiRefPatternWithPullRequest(t *testing.T) {
+	var mu sync.Mutex
+	var paths []string
+	ts := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			if req.Method == http.MethodGet {
+				fmt.Fprintln(w, `{"state": "open", "head": {"sha": "cafefacecafeface"}}`)
+				return
+			}
+			mu.Lock()
+			paths = append(paths, path.Base(req.URL.Path))
+			mu.Unlock()
+			w.WriteHeader(http.StatusCreated)
+		}))
+	inputDir := "testdata/repo-multi-ref"
+	tmpDir := testhelp.MakeGitRepoFromTestdata(t, inputDir,
+		"https://github.com/dummy-owner/dummy-repo", "dummySHA", "cafe0000cafe0000")
+	putter := cogito.NewPutter(ts.URL, hclog.NewNullLogger())
+	putter.InputDir = filepath.Join(tmpDir, filepath.Base(inputDir))
+	putter.Request = cogito.PutRequest{
+		Source: cogito.Source{Owner: "dummy-owner", Repo: "dummy-repo"},
+		Params: cogito.PutParams{
+			State:             cogito.StateSuccess,
+			MultiRefPattern:   "^refs/tags/sub-a/",
+			PullRequestNumber: 42,
+		},
+	}
+
+	assert.NilError(t, putter.ProcessInputDir())
+	for _, sink := range putter.Sinks() {
+		assert.NilError(t, sink.Send())
+	}
+
+	ts.Close() // Avoid races before the following asserts.
+	// Only the main commit is replaced by the pull request head.
+	assert.DeepEqual(t, paths, []string{"cafefacecafeface", "aaaa1111aaaa1111", "aaaa2222aaaa2222"})
+}
+
+func TestPutterPullRequestHead(t *testing.T) {
+	var mu sync.Mutex
+	var requests []string
+	ts := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			mu.Lock()
+			requests = append(requests, req.Method+" "+req.URL.Path)
+			mu.Unlock()
+			if req.Method == http.MethodGet {
+				fmt.Fprintln(w, `{"state": "open", "head": {"sha": "cafefacecafeface"}}`)
+				return
+			}
+			w.WriteHeader(http.StatusCreated)
+		}))
+	inputDir := "testdata/one-repo"
+	tmpDir := testhelp.MakeGitRepoFromTestdata(t, inputDir,
+		"https://github.com/dummy-owner/dummy-repo", "dummySHA", "cafe0000cafe0000")
+	putter := cogito.NewPutter(ts.URL, hclog.NewNullLogger())
+	putter.InputDir = filepath.Join(tmpDir, filepath.Base(inputDir))
+	putter.Request = cogito.PutRequest{
+		Source: cogito.Source{
+			Owner:              "dummy-owner",
+			Repo:               "dummy-repo",
+			ChatShowTransition: true,
+		},
+		Params: cogito.PutParams{
+			State:             cogito.StateSuccess,
+			PullRequestNumber: 42,
+		},
+	}
+
+	assert.NilError(t, putter.ProcessInputDir())
+	for _, sink := range putter.Sinks() {
+		assert.NilError(t, sink.Send())
+	}
+
+	ts.Close() // Avoid races before the following asserts.
+	// Resolved once, then used both to read the previous status and to post the new one.
+	assert.DeepEqual(t, requests, []string{
+		"GET /repos/dummy-owner/dummy-repo/pulls/42",
+		"GET /repos/dummy-owner/dummy-repo/commits/cafefacecafeface/status",
+		"POST /repos/dummy-owner/dummy-repo/statuses/cafefacecafeface",
+	})
+}
+
+func TestPutterContextByBranch(t *testing.T) {
+	type testCase struct {
+		name        string
+		head        string
+		params      cogito.PutParams
+		wantContext string
+	}
+
+	test := func(t *testing.T, tc testCase) {
+		var ghReq github.AddRequest
+		var URL *url.URL
+		ts := testhelp.SpyHttpServer(&ghReq, nil, &URL, http.StatusCreated)
+		inputDir := "testdata/one-repo"
+		tmpDir := testhelp.MakeGitRepoFromTestdata(t, inputDir,
+			"https://github.com/dummy-owner/dummy-repo", "deadbeefdeadbeef", tc.head)
+		putter := cogito.NewPutter(ts.URL, hclog.NewNullLogger())
+		putter.InputDir = filepath.Join(tmpDir, filepath.Base(inputDir))
+		tc.params.State = cogito.StateSuccess
+		putter.Request = cogito.PutRequest{
+			Source: cogito.Source{
+				Owner: "dummy-owner",
+				Repo:  "dummy-repo",
+				ContextByBranch: map[string]string{
+					"main":       "ci/main",
+					"a-branch-*": "ci/pr",
+				},
+			},
+			Params: tc.params,
+			Env:    cogito.Environment{BuildJobName: "the-job"},
+		}
+
+		assert.NilError(t, putter.ProcessInputDir())
+		assert.NilError(t, putter.Sinks()[0].Send())
+
+		ts.Close() // Avoid races before the following asserts.
+		assert.Equal(t, ghReq.Context, tc.wantContext)
+	}
+
+	testCases := []testCase{
+		{
+			name:        "matching branch",
+			head:        "ref: refs/heads/a-branch-FIXME",
+			wantContext: "ci/pr",
+		},
+		{
+			name:        "detached head: fallback to the job name",
+			head:        "deadbeefdeadbeef",
+			wantContext: "the-job",
+		},
+		{
+			name:        "params.context has precedence",
+			head:        "ref: refs/heads/a-branch-FIXME",
+			params:      cogito.PutParams{Context: "the-context"},
+			wantContext: "the-context",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) { test(t, tc) })
+	}
+}
+
+func TestPutterGitHubMaxRPS(t *testing.T) {
+	var mu sync.Mutex
+	var times []time.Time
+	ts := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			mu.Lock()
+			times = append(times, time.Now())
+			mu.Unlock()
+			w.WriteHeader(http.StatusCreated)
+		}))
+	inputDir := "testdata/repo-multi-ref"
+	tmpDir := testhelp.MakeGitRepoFromTestdata(t, inputDir,
+		"https://github.com/dummy-owner/dummy-repo", "dummySHA", "cafe0000cafe0000")
+	putter := cogito.NewPutter(ts.URL, hclog.NewNullLogger())
+	putter.InputDir = filepath.Join(tmpDir, filepath.Base(inputDir))
+	putter.Request = cogito.PutRequest{
+		Source: cogito.Source{
+			Owner:        "dummy-owner",
+			Repo:         "dummy-repo",
+			GitHubMaxRPS: 20, // One request every 50ms.
+		},
+		Params: cogito.PutParams{
+			State:           cogito.StateSuccess,
+			MultiRefPattern: "^refs/tags/sub-a/",
+		},
+	}
+
+	assert.NilError(t, putter.ProcessInputDir())
+	for _, sink := range putter.Sinks() {
+		assert.NilError(t, sink.Send())
+	}
+
+	ts.Close() // Avoid races before the following asserts.
+	assert.Equal(t, len(times), 3)
+	for i := 1; i < len(times); i++ {
+		gap := times[i].Sub(times[i-1])
+		assert.Assert(t, gap >= 45*time.Millisecond, "post %d: gap: %s", i, gap)
+	}
+}
+
+func TestPutterGitHubMaxRPSPacesAllRequests(t *testing.T) {
+	var mu sync.Mutex
+	var times []time.Time
+	ts := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			mu.Lock()
+			times = append(times, time.Now())
+			mu.Unlock()
+			if req.Method == http.MethodGet {
+				// verify_sha: the commit exists.
+				w.WriteHeader(http.StatusOK)
+				return
+			}
+			w.WriteHeader(http.StatusCreated)
+		}))
+	inputDir := "testdata/repo-multi-ref"
+	tmpDir := testhelp.MakeGitRepoFromTestdata(t, inputDir,
+		"https://github.com/dummy-owner/dummy-repo", "dummySHA", "cafe0000cafe0000")
+	putter := cogito.NewPutter(ts.URL, hclog.NewNullLogger())
+	putter.InputDir = filepath.Join(tmpDir, filepath.Base(inputDir))
+	putter.Request = cogito.PutRequest{
+		Source: cogito.Source{
+			Owner:        "dummy-owner",
+			Repo:         "dummy-repo",
+			VerifySHA:    true,
+			GitHubMaxRPS: 20, // One request every 50ms.
+		},
+		Params: cogito.PutParams{
+			State:           cogito.StateSuccess,
+			MultiRefPattern: "^refs/tags/sub-a/",
+		},
+	}
+
+	assert.NilError(t, putter.ProcessInputDir())
+	for _, sink := range putter.Sinks() {
+		assert.NilError(t, sink.Send())
+	}
+
+	ts.Close() // Avoid races before the following asserts.
+	// For each ref: one GET for verify_sha and one POST for the commit status.
+	assert.Equal(t, len(times), 6)
+	for i := 1; i < len(times); i++ {
+		gap := times[i].Sub(times[i-1])
+		assert.Assert(t, gap >= 45*time.Millisecond, "request %d: gap: %s", i, gap)
+	}
+}
+
+func TestPutterChatFooterBranchAndTag(t *testing.T) {
+	type testCase struct {
+		name     string
+		sha      string
+		head     string
+		wantText string
+	}
+
+	test := func(t *testing.T, tc testCase) {
+		var message googlechat.BasicMessage
+		var URL *url.URL
+		ts := testhelp.SpyHttpServer(&message, googlechat.MessageReply{}, &URL,
+			http.StatusOK)
+		inputDir := "testdata/repo-multi-ref"
+		tmpDir := testhelp.MakeGitRepoFromTestdata(t, inputDir,
+			"https://github.com/dummy-owner/dummy-repo", tc.sha, tc.head)
+		putter := cogito.NewPutter(ts.URL, hclog.NewNullLogger())
+		putter.InputDir = filepath.Join(tmpDir, filepath.Base(inputDir))
+		putter.Request = cogito.PutRequest{
+			Source: cogito.Source{
+				Owner:        "dummy-owner",
+				Repo:         "dummy-repo",
+				GChatWebHook: ts.URL,
+				Sinks:        []string{"gchat"},
+				ChatFooter:   "branch: {{ .Branch }}, tag: {{ .Tag }}",
+			},
+			Params: cogito.PutParams{
+				State:       cogito.StateFailure,
+				ChatMessage: "the message",
+			},
+		}
+
+		assert.NilError(t, putter.ProcessInputDir())
+		for _, sink := range putter.Sinks() {
+			assert.NilError(t, sink.Send())
+		}
+
+		ts.Close() // Avoid races before the following asserts.
+		assert.Equal(t, message.Text, "the message\n\n"+tc.wantText)
+	}
+
+	testCases := []testCase{
+		{
+			name:     "branch checked out, tagged commit",
+			sha:      "aaaa2222aaaa2222",
+			head:     "ref: refs/heads/a-branch-FIXME",
+			wantText: "branch: a-branch-FIXME, tag: sub-a/v2",
+		},
+		{
+			name:     "detached HEAD, untagged commit",
+			sha:      "dummySHA",
+			head:     "cafe0000cafe0000",
+			wantText: "branch: , tag: ",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) { test(t, tc) })
+	}
+}
+
+func TestPutterTargets(t *testing.T) {
+	var mu sync.Mutex
+	var paths []string
+	ts := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			mu.Lock()
+			paths = append(paths, req.URL.Path)
+			mu.Unlock()
+			w.WriteHeader(http.StatusCreated)
+		}))
+	inputDir := "testdata/one-repo"
+	tmpDir := testhelp.MakeGitRepoFromTestdata(t, inputDir,
+		"https://github.com/dummy-owner/dummy-repo", "dummySHA", "cafe0000cafe0000")
+	putter := cogito.NewPutter(ts.URL, hclog.NewNullLogger())
+	putter.InputDir = filepath.Join(tmpDir, filepath.Base(inputDir))
+	sha := func(c string) string { return strings.Repeat(c, 40) }
+	putter.Request = cogito.PutRequest{
+		Source: cogito.Source{Owner: "dummy-owner", Repo: "dummy-repo"},
+		Params: cogito.PutParams{
+			State: cogito.StateSuccess,
+			Targets: []cogito.Target{
+				{Owner: "the-owner", Repo: "sub-a", SHA: sha("a")},
+				{Owner: "the-owner", Repo: "sub-b", SHA: sha("b")},
+				{Owner: "other-owner", Repo: "sub-c", SHA: sha("c")},
+			},
+		},
+	}
+	assert.NilError(t, putter.Request.Params.Validate())
+
+	assert.NilError(t, putter.ProcessInputDir())
+	for _, sink := range putter.Sinks() {
+		assert.NilError(t, sink.Send())
+	}
+
+	ts.Close() // Avoid races before the following asserts.
+	assert.DeepEqual(t, paths, []string{
+		"/repos/dummy-owner/dummy-repo/statuses/cafe0000cafe0000",
+		"/repos/the-owner/sub-a/statuses/" + sha("a"),
+		"/repos/the-owner/sub-b/statuses/" + sha("b"),
+		"/repos/other-owner/sub-c/statuses/" + sha("c"),
+	})
+}
+
+func TestPutterDryRunOnlyChat(t *testing.T) {
+	var ghPosted bool
+	gitHub := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			ghPosted = true
+			w.WriteHeader(http.StatusCreated)
+		}))
+	var chatPosted bool
+	chat := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			chatPosted = true
+			fmt.Fprintln(w, "{}")
+		}))
+	inputDir := "testdata/one-repo"
+	tmpDir := testhelp.MakeGitRepoFromTestdata(t, inputDir,
+		"https://github.com/dummy-owner/dummy-repo", "dummySHA", "cafe0000cafe0000")
+	putter := cogito.NewPutter(gitHub.URL, hclog.NewNullLogger())
+	putter.InputDir = filepath.Join(tmpDir, filepath.Base(inputDir))
+	putter.Request = cogito.PutRequest{
+		Source: cogito.Source{
+			Owner:        "dummy-owner",
+			Repo:         "dummy-repo",
+			AccessToken:  "the-token",
+			GChatWebHook: chat.URL,
+			DryRun:       cogito.DryRun{Sinks: []string{"gchat"}},
+		},
+		Params: cogito.PutParams{State: cogito.StateError}, // sent to chat by default
+	}
+	assert.NilError(t, putter.Request.Source.Validate())
+
+	assert.NilError(t, putter.ProcessInputDir())
+	for _, sink := range putter.Sinks() {
+		assert.NilError(t, sink.Send())
+	}
+
+	gitHub.Close() // Avoid races before the following asserts.
+	chat.Close()
+	assert.Assert(t, ghPosted)
+	assert.Assert(t, !chatPosted)
+}
+
+func TestPutterReportSkippedSinks(t *testing.T) {
+	gitHub := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			w.WriteHeader(http.StatusCreated)
+		}))
+	inputDir := "testdata/one-repo"
+	tmpDir := testhelp.MakeGitRepoFromTestdata(t, inputDir,
+		"https://github.com/dummy-owner/dummy-repo", "dummySHA", "cafe0000cafe0000")
+	putter := cogito.NewPutter(gitHub.URL, hclog.NewNullLogger())
+	putter.InputDir = filepath.Join(tmpDir, filepath.Base(inputDir))
+	putter.Request = cogito.PutRequest{
+		Source: cogito.Source{
+			Owner:              "dummy-owner",
+			Repo:               "dummy-repo",
+			AccessToken:        "the-token",
+			GChatWebHook:       "dummy-webhook",
+			ReportSkippedSinks: true,
+		},
+		Params: cogito.PutParams{State: cogito.StatePending}, // not sent to chat by default
+	}
+	assert.NilError(t, putter.Request.Source.Validate())
+	assert.NilError(t, putter.ProcessInputDir())
+	for _, sink := range putter.Sinks() {
+		assert.NilError(t, sink.Send())
+	}
+	gitHub.Close()
+	var out bytes.Buffer
+
+	err := putter.Output(&out)
+
+	assert.NilError(t, err)
+	var output cogito.Output
+	testhelp.FromJSON(t, out.Bytes(), &output)
+	assert.DeepEqual(t, output.Metadata, []cogito.Metadata{
+		{Name: "state", Value: "pending"},
+		{Name: "cogito_result", Value: "2 sinks: github ok, gchat skipped"},
+		{Name: "skipped.gchat", Value: "state not in chat_notify_on_states"},
+	})
+}
+
+func TestPutterOutputSummary(t *testing.T) {
+	gitHub := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			w.WriteHeader(http.StatusCreated)
+		}))
+	inputDir := "testdata/one-repo"
+	tmpDir := testhelp.MakeGitRepoFromTestdata(t, inputDir,
+		"https://github.com/dummy-owner/dummy-repo", "dummySHA", "cafe0000cafe0000")
+	putter := cogito.NewPutter(gitHub.URL, hclog.NewNullLogger())
+	putter.InputDir = filepath.Join(tmpDir, filepath.Base(inputDir))
+	putter.Request = cogito.PutRequest{
+		Source: cogito.Source{
+			Owner:       "dummy-owner",
+			Repo:        "dummy-repo",
+			AccessToken: "the-token",
+			DryRun:      cogito.DryRun{Sinks: []string{"s3"}},
+			S3Bucket:    "the-bucket",
+		},
+		Params: cogito.PutParams{State: cogito.StateSuccess},
+	}
+	assert.NilError(t, putter.ProcessInputDir())
+	for _, sink := range putter.Sinks() {
+		assert.NilError(t, sink.Send())
+	}
+	gitHub.Close()
+	var out bytes.Buffer
+
+	err := putter.Output(&out)
+
+	assert.NilError(t, err)
+	var output cogito.Output
+	testhelp.FromJSON(t, out.Bytes(), &output)
+	// Without source.report_skipped_sinks, only the summary.
+	assert.DeepEqual(t, output.Metadata, []cogito.Metadata{
+		{Name: "state", Value: "success"},
+		{Name: "cogito_result", Value: "3 sinks: github ok, gchat skipped, s3 skipped"},
+	})
+}
+
+func TestPutIgnoreSinkErrors(t *testing.T) {
+	type testCase struct {
+		name         string
+		strictGitHub bool
+		gitHubStatus int
+		wantErr      string
+		wantResult   string
+	}
+
+	test := func(t *testing.T, tc testCase) {
+		gitHub := httptest.NewServer(
+			http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				w.WriteHeader(tc.gitHubStatus)
+			}))
+		defer gitHub.Close()
+		gChat := httptest.NewServer(
+			http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				w.WriteHeader(http.StatusInternalServerError)
+			}))
+		defer gChat.Close()
+		inputDir := "testdata/one-repo"
+		tmpDir := testhelp.MakeGitRepoFromTestdata(t, inputDir,
+			"https://github.com/dummy-owner/dummy-repo", "dummySHA", "cafe0000cafe0000")
+		request := cogito.PutRequest{
+			Source: cogito.Source{
+				Owner:            "dummy-owner",
+				Repo:             "dummy-repo",
+				AccessToken:      "the-token",
+				GChatWebHook:     gChat.URL,
+				IgnoreSinkErrors: true,
+				StrictGitHub:     tc.strictGitHub,
+			},
+			Params: cogito.PutParams{State: cogito.StateFailure},
+		}
+		var logBuf bytes.Buffer
+		log := hclog.New(&hclog.LoggerOptions{Output: &logBuf})
+		putter := cogito.NewPutter(gitHub.URL, log)
+		var out bytes.Buffer
+
+		err := cogito.Put(log, testhelp.ToJSON(t, request), &out,
+			[]string{filepath.Join(tmpDir, filepath.Base(inputDir))}, putter)
+
+		assert.Assert(t, cmp.Contains(logBuf.String(),
+			"[ERROR] put.lenient: ignoring sink error: reason=ignore_sink_errors sink=gchat"))
+		if tc.wantErr != "" {
+			assert.ErrorContains(t, err, tc.wantErr)
+			return
+		}
+		assert.NilError(t, err)
+		var output cogito.Output
+		testhelp.FromJSON(t, out.Bytes(), &output)
+		assert.DeepEqual(t, output.Metadata[1],
+			cogito.Metadata{Name: "cogito_result", Value: tc.wantResult})
+	}
+
+	testCases := []testCase{
+		{
+			name:         "chat error is ignored",
+			gitHubStatus: http.StatusCreated,
+			wantResult:   "2 sinks: github ok, gchat failed (ignored)",
+		},
+		{
+			name:         "all errors are ignored",
+			gitHubStatus: http.StatusInternalServerError,
+			wantResult:   "2 sinks: github failed (ignored), gchat failed (ignored)",
+		},
+		{
+			name:         "strict_github: github error is not ignored",
+			strictGitHub: true,
+			gitHubStatus: http.StatusInternalServerError,
+			wantErr:      `put: failed to add state "failure" for commit cafe000: 500`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) { test(t, tc) })
+	}
+}
+
+func TestPutLogSummary(t *testing.T) {
+	gitHub := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			w.WriteHeader(http.StatusCreated)
+		}))
+	defer gitHub.Close()
+	gChat := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			w.WriteHeader(http.StatusInternalServerError)
+		}))
+	defer gChat.Close()
+	inputDir := "testdata/one-repo"
+	tmpDir := testhelp.MakeGitRepoFromTestdata(t, inputDir,
+		"https://github.com/dummy-owner/dummy-repo", "dummySHA", "cafe0000cafe0000")
+	request := cogito.PutRequest{
+		Source: cogito.Source{
+			Owner:        "dummy-owner",
+			Repo:         "dummy-repo",
+			AccessToken:  "the-token",
+			GChatWebHook: gChat.URL,
+		},
+		Params: cogito.PutParams{State: cogito.StateFailure, Context: "the-context"},
+	}
+	var logBuf bytes.Buffer
+	log := hclog.New(&hclog.LoggerOptions{Output: &logBuf})
+	putter := cogito.NewPutter(gitHub.URL, log)
+
+	err := cogito.Put(log, testhelp.ToJSON(t, request), io.Discard,
+		[]string{filepath.Join(tmpDir, filepath.Base(inputDir))}, putter)
+
+	assert.ErrorContains(t, err, "put: GoogleChatSink:")
+	assert.Assert(t, cmp.Contains(logBuf.String(),
+		"[INFO]  put: put summary: repo=dummy-owner/dummy-repo sha=cafe0000c state=failure "+
+			"contexts=the-context sinks-run=github sinks-skipped=\"\" sinks-failed=gchat "+
+			"duration="))
+}
+
+func TestPutTimeout(t *testing.T) {
+	release := make(chan struct{})
+	slow := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			<-release
+			w.WriteHeader(http.StatusCreated)
+		}))
+	defer slow.Close()
+	defer close(release) // Before slow.Close, which waits for the handlers.
+	inputDir := "testdata/one-repo"
+	tmpDir := testhelp.MakeGitRepoFromTestdata(t, inputDir,
+		"https://github.com/dummy-owner/dummy-repo", "dummySHA", "cafe0000cafe0000")
+	request := cogito.PutRequest{
+		Source: cogito.Source{
+			Owner:        "dummy-owner",
+			Repo:         "dummy-repo",
+			AccessToken:  "the-token",
+			GChatWebHook: slow.URL,
+			PutTimeout:   "100ms",
+		},
+		Params: cogito.PutParams{State: cogito.StateFailure},
+	}
+	putter := cogito.NewPutter(slow.URL, hclog.NewNullLogger())
+	start := time.Now()
+
+	err := cogito.Put(hclog.NewNullLogger(), testhelp.ToJSON(t, request), io.Discard,
+		[]string{filepath.Join(tmpDir, filepath.Base(inputDir))}, putter)
+
+	assert.Error(t, err, `put: multiple errors:
+	put timed out after 100ms (put_timeout): sink github not completed
+	put timed out after 100ms (put_timeout): sink gchat not sent`)
+	elapsed := time.Since(start)
+	assert.Assert(t, elapsed < 2*time.Second, "elapsed: %s", elapsed)
+}
+
+func TestPutTimeoutBoundsTheWholePut(t *testing.T) {
+	type testCase struct {
+		name    string
+		source  cogito.Source
+		wantErr string
+	}
+
+	test := func(t *testing.T, tc testCase) {
+		release := make(chan struct{})
+		slow := httptest.NewServer(
+			http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				<-release
+			}))
+		defer slow.Close()
+		defer close(release) // Before slow.Close, which waits for the handlers.
+		inputDir := "testdata/one-repo"
+		tmpDir := testhelp.MakeGitRepoFromTestdata(t, inputDir,
+			"https://github.com/dummy-owner/dummy-repo", "dummySHA", "cafe0000cafe0000")
+		tc.source.Owner = "dummy-owner"
+		tc.source.Repo = "dummy-repo"
+		tc.source.PutTimeout = "100ms"
+		request := cogito.PutRequest{
+			Source: tc.source,
+			Params: cogito.PutParams{State: cogito.StateSuccess},
+		}
+		putter := cogito.NewPutter(slow.URL, hclog.NewNullLogger())
+		start := time.Now()
+
+		err := cogito.Put(hclog.NewNullLogger(), testhelp.ToJSON(t, request), io.Discard,
+			[]string{filepath.Join(tmpDir, filepath.Base(inputDir))}, putter)
+
+		assert.ErrorContains(t, err, tc.wantErr)
+		elapsed := time.Since(start)
+		assert.Assert(t, elapsed < 2*time.Second, "elapsed: %s", elapsed)
+	}
+
+	testCases := []testCase{
+		{
+			name:    "token_command",
+			source:  cogito.Source{TokenCommand: "exec sleep 5"},
+			wantErr: "token_command: put timed out (put_timeout)",
+		},
+		{
+			name: "canonicalize_repo",
+			source: cogito.Source{
+				AccessToken:      "the-token",
+				CanonicalizeRepo: true,
+			},
+			wantErr: "canonicalize_repo: http client Do: ",
+		},
+		{
+			name: "expected_default_branch",
+			source: cogito.Source{
+				AccessToken:           "the-token",
+				ExpectedDefaultBranch: "main",
+			},
+			wantErr: "expected_default_branch: http client Do: ",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) { test(t, tc) })
+	}
+}
+
+func TestPutNonBlockingSinks(t *testing.T) {
+	type testCase struct {
+		name       string
+		gChatDelay time.Duration
+		wantResult string
+	}
+
+	test := func(t *testing.T, tc testCase) {
+		gitHub := httptest.NewServer(
+			http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				w.WriteHeader(http.StatusCreated)
+			}))
+		defer gitHub.Close()
+		release := make(chan struct{})
+		gChat := httptest.NewServer(
+			http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				select {
+				case <-time.After(tc.gChatDelay):
+				case <-release:
+				}
+				fmt.Fprint(w, "{}")
+			}))
+		// Release the slow handler before Close, which waits for it.
+		defer gChat.Close()
+		defer close(release)
+		inputDir := "testdata/one-repo"
+		tmpDir := testhelp.MakeGitRepoFromTestdata(t, inputDir,
+			"https://github.com/dummy-owner/dummy-repo", "dummySHA", "cafe0000cafe0000")
+		request := cogito.PutRequest{
+			Source: cogito.Source{
+				Owner:             "dummy-owner",
+				Repo:              "dummy-repo",
+				AccessToken:       "the-token",
+				GChatWebHook:      gChat.URL,
+				NonBlockingSinks:  []string{"gchat"},
+				NonBlockingWindow: "200ms",
+			},
+			Params: cogito.PutParams{State: cogito.StateFailure},
+		}
+		putter := cogito.NewPutter(gitHub.URL, hclog.NewNullLogger())
+		var out bytes.Buffer
+		start := time.Now()
+
+		err := cogito.Put(hclog.NewNullLogger(), testhelp.ToJSON(t, request), &out,
+			[]string{filepath.Join(tmpDir, filepath.Base(inputDir))}, putter)
+
+		assert.NilError(t, err)
+		assert.Assert(t, time.Since(start) < 5*time.Second, "put waited for gchat")
+		var output cogito.Output
+		testhelp.FromJSON(t, out.Bytes(), &output)
+		assert.DeepEqual(t, output.Metadata[1],
+			cogito.Metadata{Name: "cogito_result", Value: tc.wantResult})
+	}
+
+	testCases := []testCase{
+		{
+			name:       "completes within the window",
+			gChatDelay: 0,
+			wantResult: "2 sinks: github ok, gchat ok",
+		},
+		{
+			name:       "does not complete within the window",
+			gChatDelay: time.Minute,
+			wantResult: "2 sinks: github ok, gchat unfinished",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) { test(t, tc) })
+	}
+}
+
+func TestPutterProcessInputDirNonExisting(t *testing.T) {
+	putter := &cogito.ProdPutter{
+		InputDir: "non-existing",
+		Request:  cogito.PutRequest{Source: baseSource},
+	}
+
+	err := putter.ProcessInputDir()
+
+	assert.ErrorContains(t, err,
+		"collecting directories in non-existing: open non-existing: no such file or directory")
+}
+
+func TestPutterSinks(t *testing.T) {
+	putter := cogito.NewPutter("dummy-API", hclog.NewNullLogger())
+
+	sinks := putter.Sinks()
+
+	assert.Assert(t, len(sinks) == 2)
+	_, ok1 := sinks[0].(cogito.GitHubCommitStatusSink)
+	assert.Assert(t, ok1)
+	_, ok2 := sinks[1].(cogito.GoogleChatSink)
+	assert.Assert(t, ok2)
+}
+
+func TestPutterSinksOptional(t *testing.T) {
+	putter := cogito.NewPutter("dummy-API", hclog.NewNullLogger())
+	putter.Request.Source.S3Bucket = "the-bucket"
+	putter.Request.Source.SNSTopicARN = "the-topic-arn"
+
+	sinks := putter.Sinks()
+
+	assert.Assert(t, len(sinks) == 4)
+	_, ok := sinks[2].(cogito.S3Sink)
+	assert.Assert(t, ok)
+	_, ok = sinks[3].(cogito.SNSSink)
+	assert.Assert(t, ok)
+}
+
+func TestPutterSinksChatOnly(t *testing.T) {
+	putter := cogito.NewPutter("dummy-API", hclog.NewNullLogger())
+	putter.Request.Source.Sinks = []string{"gchat"}
+
+	sinks := putter.Sinks()
+
+	assert.Assert(t, len(sinks) == 1)
+	_, ok := sinks[0].(cogito.GoogleChatSink)
+	assert.Assert(t, ok)
+}
+
+func TestPutterSinksAudit(t *testing.T) {
+	putter := cogito.NewPutter("dummy-API", hclog.NewNullLogger())
+	putter.Request.Source.AuditLogFile = "/the/audit.jsonl"
+
+	sinks := putter.Sinks()
+
+	assert.Assert(t, len(sinks) == 3)
+	audit, ok := sinks[2].(cogito.FileAuditSink)
+	assert.Assert(t, ok)
+	assert.DeepEqual(t, audit.Sinks, []string{"github", "gchat"})
+}
+
+func TestPutterAuditRecordsTheSinksThatSent(t *testing.T) {
+	type testCase struct {
+		name      string
+		ghCode    int
+		wantSinks []string
+	}
+
+	test := func(t *testing.T, tc testCase) {
+		ts := httptest.NewServer(
+			http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				w.WriteHeader(tc.ghCode)
+			}))
+		inputDir := "testdata/one-repo"
+		tmpDir := testhelp.MakeGitRepoFromTestdata(t, inputDir,
+			"https://github.com/dummy-owner/dummy-repo", "dummySHA", "cafe0000cafe0000")
+		auditFile := filepath.Join(t.TempDir(), "audit.jsonl")
+		putter := cogito.NewPutter(ts.URL, hclog.NewNullLogger())
+		putter.InputDir = filepath.Join(tmpDir, filepath.Base(inputDir))
+		putter.Request = cogito.PutRequest{
+			Source: cogito.Source{
+				Owner:        "dummy-owner",
+				Repo:         "dummy-repo",
+				AuditLogFile: auditFile,
+			},
+			// The gchat sink is skipped, since gchat_webhook is not set.
+			Params: cogito.PutParams{State: cogito.StateFailure},
+		}
+
+		assert.NilError(t, putter.ProcessInputDir())
+		for _, sink := range putter.Sinks() {
+			_ = sink.Send() // The audit sink runs also if the GitHub sink fails.
+		}
+
+		ts.Close() // Avoid races before the following asserts.
+		data, err := os.ReadFile(auditFile)
+		assert.NilError(t, err)
+		var record cogito.AuditRecord
+		testhelp.FromJSON(t, data, &record)
+		assert.DeepEqual(t, record.Sinks, tc.wantSinks)
+	}
+
+	testCases := []testCase{
+		{
+			name:      "github sent, gchat skipped",
+			ghCode:    http.StatusCreated,
+			wantSinks: []string{"github"},
+		},
+		{
+			name:      "github failed, gchat skipped",
+			ghCode:    http.StatusInternalServerError,
+			wantSinks: []string{},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) { test(t, tc) })
+	}
+}
+
+func TestPutterOutputSuccess(t *testing.T) {
+	putter := cogito.NewPutter("dummy-API", hclog.NewNullLogger())
+
+	err := putter.Output(io.Discard)
+
+	assert.NilError(t, err)
+}
+
+func TestPutterOutputFailure(t *testing.T) {
+	putter := cogito.NewPutter("dummy-API", hclog.NewNullLogger())
+
+	err := putter.Output(&testhelp.FailingWriter{})
+
+	assert.Error(t, err, "put: test write error")
+}
+
+func TestPutterReportFirstTerminalOnly(t *testing.T) {
+	type testCase struct {
+		name      string
+		state     cogito.BuildState
+		statuses  string // JSON reply to the list of statuses.
+		wantPosts int
+	}
+
+	const buildURL = "https://ci.example.com" +
+		"/teams/the-team/pipelines/the-pipeline/jobs/the-job/builds/42"
+
+	test := func(t *testing.T, tc testCase) {
+		var mu sync.Mutex
+		var posts int
+		ts := httptest.NewServer(
+			http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				if req.Method == http.MethodGet {
+					fmt.Fprintln(w, tc.statuses)
+					return
+				}
+				mu.Lock()
+				posts++
+				mu.Unlock()
+				w.WriteHeader(http.StatusCreated)
+			}))
+		inputDir := "testdata/one-repo"
+		tmpDir := testhelp.MakeGitRepoFromTestdata(t, inputDir,
+			"https://github.com/dummy-owner/dummy-repo", "dummySHA", "cafe0000cafe0000")
+		putter := cogito.NewPutter(ts.URL, hclog.NewNullLogger())
+		putter.InputDir = filepath.Join(tmpDir, filepath.Base(inputDir))
+		putter.Request = cogito.PutRequest{
+			Source: cogito.Source{
+				Owner:                   "dummy-owner",
+				Repo:                    "dummy-repo",
+				ReportFirstTerminalOnly: true,
+			},
+			Params: cogito.PutParams{State: tc.state},
+			Env: cogito.Environment{
+				AtcExternalUrl:    "https://ci.example.com",
+				BuildTeamName:     "the-team",
+				BuildPipelineName: "the-pipeline",
+				BuildJobName:      "the-job",
+				BuildName:         "42",
+			},
+		}
+
+		assert.NilError(t, putter.ProcessInputDir())
+		for _, sink := range putter.Sinks() {
+			assert.NilError(t, sink.Send())
+		}
+
+		ts.Close() // Avoid races before the following asserts.
+		assert.Equal(t, posts, tc.wantPosts)
+	}
+
+	testCases := []testCase{
+		{
+			name:      "terminal state already sent by this build: skip",
+			state:     cogito.StateFailure,
+			statuses:  `[{"state": "success", "target_url": "` + buildURL + `"}]`,
+			wantPosts: 0,
+		},
+		{
+			name:      "only pending sent by this build: send",
+			state:     cogito.StateFailure,
+			statuses:  `[{"state": "pending", "target_url": "` + buildURL + `"}]`,
+			wantPosts: 1,
+		},
+		{
+			name:      "terminal state sent by another build: send",
+			state:     cogito.StateFailure,
+			statuses:  `[{"state": "success", "target_url": "` + buildURL + `0"}]`,
+			wantPosts: 1,
+		},
+		{
+			name:      "non-terminal state: always send",
+			state:     cogito.StatePending,
+			statuses:  `[{"state": "success", "target_url": "` + buildURL + `"}]`,
+			wantPosts: 1,
+		},
+		{
+			name:      "cannot read the statuses: send",
+			state:     cogito.StateFailure,
+			statuses:  `not JSON`,
+			wantPosts: 1,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) { test(t, tc) })
+	}
+}
+
+func TestPutterGChatOncePerBuildReadsBackGitHub(t *testing.T) {
+	const buildURL = "https://ci.example.com" +
+		"/teams/the-team/pipelines/the-pipeline/jobs/the-job/builds/42"
+	var mu sync.Mutex
+	var posts []string
+	ts := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			if req.Method == http.MethodGet {
+				fmt.Fprintln(w, `[{"state": "success", "target_url": "`+buildURL+`"}]`)
+				return
+			}
+			mu.Lock()
+			posts = append(posts, req.URL.Path)
+			mu.Unlock()
+			w.WriteHeader(http.StatusCreated)
+		}))
+	inputDir := "testdata/one-repo"
+	tmpDir := testhelp.MakeGitRepoFromTestdata(t, inputDir,
+		"https://github.com/dummy-owner/dummy-repo", "dummySHA", "cafe0000cafe0000")
+	putter := cogito.NewPutter(ts.URL, hclog.NewNullLogger())
+	putter.InputDir = filepath.Join(tmpDir, filepath.Base(inputDir))
+	putter.Request = cogito.PutRequest{
+		Source: cogito.Source{
+			Owner:              "dummy-owner",
+			Repo:               "dummy-repo",
+			GChatWebHook:       ts.URL + "/chat",
+			GChatOncePerBuild:  true,
+			ChatNotifyOnStates: []cogito.BuildState{cogito.StateFailure},
+		},
+		Params: cogito.PutParams{State: cogito.StateFailure},
+		Env: cogito.Environment{
+			AtcExternalUrl:    "https://ci.example.com",
+			BuildTeamName:     "the-team",
+			BuildPipelineName: "the-pipeline",
+			BuildJobName:      "the-job",
+			BuildName:         "42",
+		},
+	}
+
+	assert.NilError(t, putter.ProcessInputDir())
+	for _, sink := range putter.Sinks() {
+		assert.NilError(t, sink.Send())
+	}
+
+	ts.Close() // Avoid races before the following asserts.
+	// The GitHub commit status is posted, the chat message is not.
+	assert.DeepEqual(t, posts,
+		[]string{"/repos/dummy-owner/dummy-repo/statuses/cafe0000cafe0000"})
 }
@@ -1,16 +1,25 @@
 package cogito
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"io/fs"
+	"net/http"
 	"net/url"
 	"os"
 	"path"
 	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 
+	"github.com/Pix4D/cogito/github"
 	"github.com/Pix4D/cogito/sets"
 	"github.com/hashicorp/go-hclog"
 	"github.com/sasbury/mini"
@@ -22,9 +31,52 @@ type ProdPutter struct {
 	Request  PutRequest
 	InputDir string
 	// Cogito specific fields.
-	ghAPI  string
-	log    hclog.Logger
-	gitRef string
+	ghAPI     string
+	log       hclog.Logger
+	gitRef    string
+	prevState BuildState
+	// prevGhState is the state of the previous GitHub commit status, for
+	// source.chat_notify_on_change.
+	prevGhState string
+	// multiRefs are the additional commits matching params.multi_ref_pattern.
+	multiRefs []string
+	// skips records the sinks that didn't send, for the put summary and for
+	// source.report_skipped_sinks.
+	skips SkipReport
+	// putSinks are the names of the sinks of this put step, for the put summary.
+	putSinks []string
+	// sinkNames are the names of the sinks returned by Sinks, in the same order, since
+	// the wrappers hide them.
+	sinkNames []string
+	// ignored records the sinks that failed, with the error, when the error is
+	// ignored due to source.ignore_sink_errors or source.non_blocking_sinks.
+	ignored SkipReport
+	// unfinished records the non-blocking sinks that didn't complete within the
+	// completion window (see source.non_blocking_sinks).
+	unfinished SkipReport
+	// failed records the sinks that failed, with the error, for source.audit_log_file.
+	failed SkipReport
+	// skipNotify is true if the commit message has the trailer of
+	// source.skip_notify_trailer.
+	skipNotify bool
+	// branch and tag are the branch checked out and the tag of gitRef, if any. See
+	// source.chat_footer.
+	branch string
+	tag    string
+	// terminalSent is true if this build already posted a terminal state to GitHub.
+	// See source.report_first_terminal_only and source.gchat_once_per_build.
+	terminalSent bool
+	// started is when the put step started, for source.put_timeout.
+	started time.Time
+	// transport sends all the HTTP requests of the put step. See
+	// source.disable_keep_alives and source.debug_dump_requests.
+	transport http.RoundTripper
+	// pacer paces all the requests to the GitHub API of the put step. See
+	// [ProdPutter.githubPacer].
+	pacer *github.Pacer
+	// ctx bounds the whole put step. See [ProdPutter.putContext].
+	ctx    context.Context
+	cancel context.CancelFunc
 }
 
 // NewPutter returns a Cogito ProdPutter.
@@ -36,6 +88,7 @@ func NewPutter(ghAPI string, log hclog.Logger) *ProdPutter {
 }
 
 func (putter *ProdPutter) LoadConfiguration(input []byte, args []string) error {
+	putter.started = time.Now()
 	putter.log = putter.log.Named("put")
 	putter.log.Debug("started")
 	defer putter.log.Debug("finished")
@@ -44,7 +97,26 @@ func (putter *ProdPutter) LoadConfiguration(input []byte, args []string) error {
 	if err != nil {
 		return err
 	}
+	// The context prefix can also be set via the environment, to share the same pipeline
+	// across environments. The source configuration takes precedence.
+	if request.Source.ContextPrefix == "" {
+		request.Source.ContextPrefix = os.Getenv("COGITO_CONTEXT_PREFIX")
+	}
+	if state := request.Params.unknownState; state != "" {
+		putter.log.Warn("unknown build state", "state", state,
+			"on_unknown_state", request.Source.OnUnknownState,
+			"coerced-to", request.Params.State)
+	}
 	putter.Request = request
+	// Run the command at each put, since the token it prints can be short-lived.
+	if putter.Request.Source.TokenCommand != "" {
+		token, err := runTokenCommand(putter.putContext(),
+			putter.Request.Source.TokenCommand, tokenCommandTimeout)
+		if err != nil {
+			return fmt.Errorf("put: %s", err)
+		}
+		putter.Request.Source.AccessToken = token
+	}
 	putter.log.Debug("parsed put request",
 		"source", putter.Request.Source,
 		"params", putter.Request.Params,
@@ -61,9 +133,103 @@ func (putter *ProdPutter) LoadConfiguration(input []byte, args []string) error {
 	buildState := putter.Request.Params.State
 	putter.log.Debug("", "state", buildState)
 
+	// A single transport for all the HTTP requests of the put step, including the ones
+	// to the GitHub API just below. It is never installed as http.DefaultTransport.
+	putter.transport = http.DefaultTransport
+	if putter.Request.Source.DisableKeepAlives {
+		putter.transport = withoutKeepAlives(putter.transport)
+	}
+	if putter.Request.Source.DebugDumpRequests {
+		putter.transport = dumpTransport{
+			log:  putter.log.Named("dump"),
+			next: putter.transport,
+		}
+	}
+
+	if putter.Request.Source.CanonicalizeRepo {
+		if err := putter.canonicalizeRepo(); err != nil {
+			return fmt.Errorf("put: %s", err)
+		}
+	}
+
+	if err := verifyDefaultBranch(putter.ghAPI, putter.Request.Source,
+		putter.ghOptions()); err != nil {
+		return fmt.Errorf("put: %s", err)
+	}
+
+	if !putter.Request.Env.InConcourse() {
+		putter.log.Info("running in manual mode", "reason", "ATC_EXTERNAL_URL not set",
+			"manual_context", putter.Request.Source.ManualContext)
+	}
+
 	return nil
 }
 
+// canonicalizeRepo replaces source.owner and source.repo with their canonical casing,
+// as returned by the GitHub API, so that all the sinks and the output metadata use it.
+// See source.canonicalize_repo.
+func (putter *ProdPutter) canonicalizeRepo() error {
+	source := &putter.Request.Source
+	repo, err := github.GetRepository(putter.ghAPI, source.AccessToken, source.Owner,
+		source.Repo, putter.ghOptions())
+	if err != nil {
+		return fmt.Errorf("canonicalize_repo: %w", err)
+	}
+	if repo.Owner.Login != source.Owner || repo.Name != source.Repo {
+		putter.log.Info("canonicalize_repo: using the canonical casing",
+			"have", source.Owner+"/"+source.Repo,
+			"canonical", repo.Owner.Login+"/"+repo.Name)
+	}
+	source.Owner = repo.Owner.Login
+	source.Repo = repo.Name
+	return nil
+}
+
+// ghOptions returns the options of the requests to the GitHub API made directly by the
+// putter, outside of the sinks.
+func (putter *ProdPutter) ghOptions() github.Options {
+	return github.Options{
+		Timeout:   sinkTimeout(putter.Request.Source.GitHubTimeout, github.DefaultTimeout),
+		Pacer:     putter.githubPacer(),
+		Transport: putter.transport,
+		Context:   putter.putContext(),
+	}
+}
+
+// putContext returns the context of the whole put step, created at the first call. If
+// source.put_timeout is set, it expires put_timeout after the start of the put step, so
+// that it cancels any request still in flight.
+func (putter *ProdPutter) putContext() context.Context {
+	if putter.ctx == nil {
+		if putter.started.IsZero() {
+			putter.started = time.Now()
+		}
+		if timeout := sinkTimeout(putter.Request.Source.PutTimeout, 0); timeout > 0 {
+			putter.ctx, putter.cancel = context.WithDeadline(context.Background(),
+				putter.started.Add(timeout))
+		} else {
+			putter.ctx, putter.cancel = context.WithCancel(context.Background())
+		}
+	}
+	return putter.ctx
+}
+
+// release cancels the context of the put step. See [releaser].
+func (putter *ProdPutter) release() {
+	if putter.cancel != nil {
+		putter.cancel()
+	}
+}
+
+// githubPacer returns the pacer shared by all the requests to the GitHub API of the put
+// step, from the putter and from the sinks. See source.github_max_rps.
+func (putter *ProdPutter) githubPacer() *github.Pacer {
+	if putter.pacer == nil {
+		putter.pacer = github.NewPacer(putter.Request.Source.GitHubMaxRPS)
+	}
+	return putter.pacer
+}
+
 func (putter *ProdPutter) ProcessInputDir() error {
 	// putter.InputDir, corresponding to key "put:inputs:", should contain 1 or 2 dirs.
 	// If it contains one, we support autodiscovery by not requiring to name it, we know
@@ -74,6 +240,8 @@ func (putter *ProdPutter) ProcessInputDir() error {
 	// This allows (although clumsily) to distinguish which is which.
 	// This complexity has historical reasons to preserve backwards compatibility
 	// (the nameless git repo).
+	// If params.repo_dir is set, it names the git repo directory explicitly and the
+	// above autodiscovery (and limit on the number of directories) doesn't apply.
 	//
 	// Somehow independent is the reason why we enforce the count of directories to be
 	// max 2: this is to avoid the default Concourse behavior of streaming _all_ the
@@ -81,7 +249,7 @@ func (putter *ProdPutter) ProcessInputDir() error {
 
 	params := putter.Request.Params
 	source := putter.Request.Source
-	var msgDir string
+	var msgDirs []string
 
 	collected, err := collectInputDirs(putter.InputDir)
 	if err != nil {
@@ -90,39 +258,87 @@ func (putter *ProdPutter) ProcessInputDir() error {
 
 	inputDirs := sets.From(collected...)
 
-	if params.ChatMessageFile != "" {
-		msgDir, _ = path.Split(params.ChatMessageFile)
+	// The files in the put inputs that are not in the git repo, with their
+	// configuration key.
+	type inputFile struct{ key, path string }
+	var inputFiles []inputFile
+	for _, msgFile := range params.ChatMessageFile {
+		inputFiles = append(inputFiles, inputFile{"chat_message_file", msgFile})
+	}
+	if source.GChatWebHookFile != "" {
+		inputFiles = append(inputFiles,
+			inputFile{"gchat_webhook_file", source.GChatWebHookFile})
+	}
+
+	for _, file := range inputFiles {
+		msgDir, _ := path.Split(file.path)
 		msgDir = strings.TrimSuffix(msgDir, "/")
 		if msgDir == "" {
-			return fmt.Errorf("chat_message_file: wrong format: have: %s, want: path of the form: <dir>/<file>",
-				params.ChatMessageFile)
+			return fmt.Errorf("%s: wrong format: have: %s, want: path of the form: <dir>/<file>",
+				file.key, file.path)
+		}
+		if sets.From(msgDirs...).Contains(msgDir) {
+			// Multiple files in the same directory.
+			continue
 		}
 
 		found := inputDirs.Remove(msgDir)
 		if !found {
-			return fmt.Errorf("put:inputs: directory for chat_message_file not found: have: %v, chat_message_file: %s",
-				collected, params.ChatMessageFile)
+			return fmt.Errorf("put:inputs: directory for %s not found: have: %v, %s: %s",
+				file.key, collected, file.key, file.path)
 		}
+		msgDirs = append(msgDirs, msgDir)
 	}
 
-	if inputDirs.Size() == 0 {
-		return fmt.Errorf(
-			"put:inputs: missing directory for GitHub repo: have: %v, GitHub: %s/%s",
-			collected, source.Owner, source.Repo)
-	} else if inputDirs.Size() > 1 {
-		return fmt.Errorf(
-			"put:inputs: want only directory for GitHub repo: have: %v, GitHub: %s/%s",
-			inputDirs, source.Owner, source.Repo)
+	if dir := params.ChatDigestFromDir; dir != "" && !sets.From(msgDirs...).Contains(dir) {
+		if !inputDirs.Remove(dir) {
+			return fmt.Errorf("put:inputs: directory for chat_digest_from_dir not found: have: %v, chat_digest_from_dir: %s",
+				collected, dir)
+		}
+		msgDirs = append(msgDirs, dir)
 	}
 
-	// The set has one or two elements. if it exists, remove from the set the message
-	// directory. The remaining one is the git repo.
-	putter.log.Debug("", "inputDirs", inputDirs, "msgDir", msgDir)
-	remaining := inputDirs.Difference(sets.From(msgDir))
-	repoDir := filepath.Join(putter.InputDir, remaining.OrderedList()[0])
+	if source.GChatWebHookFile != "" {
+		webhook, err := os.ReadFile(filepath.Join(putter.InputDir, source.GChatWebHookFile))
+		if err != nil {
+			return fmt.Errorf("put:inputs: reading gchat_webhook_file: %s", err)
+		}
+		putter.Request.Source.GChatWebHook = strings.TrimSpace(string(webhook))
+	}
 
-	if err := checkGitRepoDir(repoDir, source.Owner, source.Repo); err != nil {
-		return err
+	var repoDir string
+	if params.RepoDir != "" {
+		if !inputDirs.Contains(params.RepoDir) {
+			return fmt.Errorf("put:inputs: directory for repo_dir not found: have: %v, repo_dir: %s",
+				collected, params.RepoDir)
+		}
+		repoDir = filepath.Join(putter.InputDir, params.RepoDir)
+		if _, err := os.Stat(filepath.Join(repoDir, ".git")); err != nil {
+			return fmt.Errorf("put:inputs: repo_dir: not a git repository: %w", err)
+		}
+	} else {
+		if inputDirs.IsEmpty() {
+			return fmt.Errorf(
+				"put:inputs: missing directory for GitHub repo: have: %v, GitHub: %s/%s",
+				collected, source.Owner, source.Repo)
+		} else if inputDirs.Size() > 1 {
+			return fmt.Errorf(
+				"put:inputs: want only directory for GitHub repo: have: %v, GitHub: %s/%s",
+				inputDirs, source.Owner, source.Repo)
+		}
+
+		// The message directories have already been removed from the set, so the
+		// remaining one is the git repo.
+		putter.log.Debug("", "inputDirs", inputDirs, "msgDirs", msgDirs)
+		repoDir = filepath.Join(putter.InputDir, inputDirs.OrderedList()[0])
+	}
+
+	// If the github sink is not active, owner and repo are optional; without them there
+	// is nothing to check the git remote against.
+	if source.Owner != "" || source.Repo != "" {
+		if err := checkGitRepoDir(repoDir, source.Owner, source.Repo); err != nil {
+			return err
+		}
 	}
 
 	putter.gitRef, err = getGitCommit(repoDir)
@@ -131,33 +347,562 @@ func (putter *ProdPutter) ProcessInputDir() error {
 	}
 	putter.log.Debug("", "git-ref", putter.gitRef)
 
+	// The context from params (context, context_template) has precedence.
+	if len(source.ContextByBranch) > 0 && params.Context == "" && params.fullContext == "" {
+		branch, err := getGitBranch(repoDir)
+		if err != nil {
+			return err
+		}
+		if context, ok := contextForBranch(source.ContextByBranch, branch); ok {
+			putter.log.Debug("context_by_branch: matched", "branch", branch,
+				"context", context)
+			putter.Request.Params.fullContext = context
+		}
+	}
+
+	gitDir, commonDir, err := gitDirs(repoDir)
+	if err != nil {
+		return err
+	}
+
+	// A shallow clone has grafted commits, whose history is missing.
+	if _, err := os.Stat(filepath.Join(commonDir, "shallow")); err == nil {
+		if source.FailOnShallow {
+			return fmt.Errorf("put:inputs: git repo is a shallow clone (fail_on_shallow is set)")
+		}
+		putter.log.Warn("git repo is a shallow clone: the reported SHA may be a grafted commit",
+			"git-ref", putter.gitRef)
+	}
+
+	if source.SkipNotifyTrailer != "" {
+		// The Concourse git resource writes the commit message to .git/commit_message.
+		msg, err := os.ReadFile(filepath.Join(gitDir, "commit_message"))
+		if err != nil {
+			// This is a nice-to-have, it should not fail the put step.
+			putter.log.Warn("skip_notify_trailer: cannot read the commit message",
+				"reason", err)
+		}
+		putter.skipNotify = hasTrailer(string(msg), source.SkipNotifyTrailer)
+		putter.log.Debug("", "skip-notify", putter.skipNotify)
+	}
+
+	// Only source.chat_footer uses them: don't read the refs otherwise.
+	if source.ChatFooter != "" {
+		putter.branch, err = getGitBranch(repoDir)
+		if err != nil {
+			return err
+		}
+		putter.tag, err = getGitTag(repoDir, putter.gitRef)
+		if err != nil {
+			return err
+		}
+		putter.log.Debug("", "branch", putter.branch, "tag", putter.tag)
+	}
+
+	if params.MultiRefPattern != "" {
+		putter.multiRefs, err = matchGitRefs(repoDir, params.MultiRefPattern,
+			putter.gitRef)
+		if err != nil {
+			return err
+		}
+		putter.log.Info("multi_ref_pattern", "pattern", params.MultiRefPattern,
+			"matching-commits", putter.multiRefs)
+	}
+
+	// After the git reads above, since the head of the pull request can be missing
+	// from the git repo of the put inputs. Before the previous status read and the
+	// sinks, that all use it.
+	if number := params.PullRequestNumber; number > 0 {
+		putter.gitRef, err = github.PullRequestHead(putter.ghAPI, source.AccessToken,
+			source.Owner, source.Repo, number, putter.ghOptions())
+		if err != nil {
+			return err
+		}
+		putter.log.Debug("resolved pull request head", "pull-request", number,
+			"git-ref", putter.gitRef)
+	}
+
+	// Read the previous status before any sink has the occasion to post the new one.
+	if (source.ChatShowTransition || source.WarnOnContextCollision ||
+		source.ChatNotifyOnChange) && source.sinkActive(sinkGitHub) {
+		commitStatus := github.NewCommitStatus(putter.ghAPI, source.AccessToken,
+			source.Owner, source.Repo, ghMakeContext(putter.Request), putter.ghOptions())
+		prevStatus, err := commitStatus.LatestStatus(putter.gitRef)
+		if err != nil {
+			// This is a nice-to-have, it should not fail the put step.
+			putter.log.Warn("cannot get previous state", "reason", err)
+		}
+		if source.ChatShowTransition {
+			putter.prevState = BuildState(prevStatus.State)
+			putter.log.Debug("", "previous-state", putter.prevState)
+		}
+		if source.ChatNotifyOnChange {
+			putter.prevGhState = prevStatus.State
+		}
+		if source.WarnOnContextCollision && contextCollision(putter.Request.Env, prevStatus) {
+			putter.log.Warn("context collision: the latest status with this context "+
+				"was posted by another tool, check that the context is unique",
+				"context", prevStatus.Context, "state", prevStatus.State,
+				"target_url", prevStatus.TargetURL)
+		}
+	}
+
+	// The GitHub commit statuses are the only state shared by the put steps of a build,
+	// since each put step runs in a new container.
+	if (source.ReportFirstTerminalOnly || source.GChatOncePerBuild) &&
+		params.State.IsTerminal() &&
+		putter.Request.Env.InConcourse() {
+		commitStatus := github.NewCommitStatus(putter.ghAPI, source.AccessToken,
+			source.Owner, source.Repo, ghMakeContext(putter.Request), putter.ghOptions())
+		statuses, err := commitStatus.Statuses(putter.gitRef)
+		if err != nil {
+			// Better to send the terminal state twice than not at all.
+			putter.log.Warn("cannot get the previous statuses, sending anyway",
+				"reason", err)
+		}
+		putter.terminalSent = terminalSentByBuild(statuses,
+			concourseBuildURL(putter.Request.Env))
+		putter.log.Debug("", "terminal-sent", putter.terminalSent)
+	}
+
 	return nil
 }
 
+// terminalSentByBuild returns true if statuses contain a terminal state posted by the
+// build with URL buildURL (the target_url of the statuses of the GitHub sink).
+func terminalSentByBuild(statuses []github.Status, buildURL string) bool {
+	for _, status := range statuses {
+		if status.TargetURL == buildURL && status.State != string(StatePending) {
+			return true
+		}
+	}
+	return false
+}
+
 func (putter *ProdPutter) Sinks() []Sinker {
-	return []Sinker{
-		GitHubCommitStatusSink{
-			Log:     putter.log.Named("ghCommitStatus"),
-			GhAPI:   putter.ghAPI,
-			GitRef:  putter.gitRef,
-			Request: putter.Request,
-		},
-		GoogleChatSink{
+	putter.skips = SkipReport{}
+	putter.ignored = SkipReport{}
+	putter.unfinished = SkipReport{}
+	putter.failed = SkipReport{}
+	putter.sinkNames = nil
+
+	source := putter.Request.Source
+	var responseDir string
+	if putter.Request.Params.SaveResponse {
+		responseDir = putter.InputDir
+	}
+	pacer := putter.githubPacer()
+	var sinks []Sinker
+	if source.sinkActive(sinkGitHub) {
+		sinks = append(sinks, GitHubCommitStatusSink{
+			Log:         putter.log.Named("ghCommitStatus"),
+			GhAPI:       putter.ghAPI,
+			GitRef:      putter.gitRef,
+			Request:     putter.Request,
+			ResponseDir: responseDir,
+			Pacer:       pacer,
+			Transport:   putter.transport,
+			Ctx:         putter.putContext(),
+		})
+	}
+	if source.sinkActive(sinkGChat) {
+		sinks = append(sinks, GoogleChatSink{
 			Log: putter.log.Named("gChat"),
 			// TODO putter.InputDir itself should be of type fs.FS.
-			InputDir: os.DirFS(putter.InputDir),
-			GitRef:   putter.gitRef,
-			Request:  putter.Request,
-		},
+			InputDir:        os.DirFS(putter.InputDir),
+			GitRef:          putter.gitRef,
+			Request:         putter.Request,
+			PrevState:       putter.prevState,
+			PrevGitHubState: putter.prevGhState,
+			TerminalSent:    putter.terminalSent,
+			Transport:       putter.transport,
+			Ctx:             putter.putContext(),
+			Skips:           putter.skips,
+			SkipNotify:      putter.skipNotify,
+			Branch:          putter.branch,
+			Tag:             putter.tag,
+		})
+	}
+	if source.sinkActive(sinkS3) {
+		sinks = append(sinks, S3Sink{
+			Log:       putter.log.Named("s3"),
+			GitRef:    putter.gitRef,
+			Request:   putter.Request,
+			Transport: putter.transport,
+			Ctx:       putter.putContext(),
+		})
 	}
+	if source.sinkActive(sinkSNS) {
+		sinks = append(sinks, SNSSink{
+			Log:       putter.log.Named("sns"),
+			GitRef:    putter.gitRef,
+			Request:   putter.Request,
+			Skips:     putter.skips,
+			Transport: putter.transport,
+			Ctx:       putter.putContext(),
+		})
+	}
+	if source.sinkActive(sinkPubSub) {
+		sinks = append(sinks, PubSubSink{
+			Log:       putter.log.Named("pubsub"),
+			GitRef:    putter.gitRef,
+			Request:   putter.Request,
+			Skips:     putter.skips,
+			Transport: putter.transport,
+			Ctx:       putter.putContext(),
+		})
+	}
+
+	// Additional commits of the same repo, if params.multi_ref_pattern is set.
+	if source.sinkActive(sinkGitHub) {
+		for _, gitRef := range putter.multiRefs {
+			sinks = append(sinks, GitHubCommitStatusSink{
+				Log:         putter.log.Named("ghCommitStatus"),
+				GhAPI:       putter.ghAPI,
+				GitRef:      gitRef,
+				Request:     putter.Request,
+				ResponseDir: responseDir,
+				Pacer:       pacer,
+				Transport:   putter.transport,
+				Ctx:         putter.putContext(),
+			})
+		}
+		// Commits of other repos, if params.targets is set.
+		for _, target := range putter.Request.Params.Targets {
+			request := putter.Request
+			request.Source.Owner = target.Owner
+			request.Source.Repo = target.Repo
+			sinks = append(sinks, GitHubCommitStatusSink{
+				Log:         putter.log.Named("ghCommitStatus"),
+				GhAPI:       putter.ghAPI,
+				GitRef:      target.SHA,
+				Request:     request,
+				ResponseDir: responseDir,
+				Pacer:       pacer,
+				Transport:   putter.transport,
+				Ctx:         putter.putContext(),
+			})
+		}
+	}
+
+	// Last, so that it can record the other sinks.
+	if source.sinkActive(sinkAudit) {
+		sinks = append(sinks, FileAuditSink{
+			Log:     putter.log.Named("audit"),
+			GitRef:  putter.gitRef,
+			Request: putter.Request,
+			Sinks:   uniqueSinkNames(sinks),
+			NotSent: []SkipReport{putter.skips, putter.ignored, putter.failed},
+		})
+	}
+	putter.putSinks = uniqueSinkNames(sinks)
+
+	if state := putter.Request.Params.unknownState; state != "" &&
+		source.OnUnknownState == onUnknownSkip {
+		putter.log.Info("not sending", "reason", "on_unknown_state: skip",
+			"state", state)
+		for _, name := range putter.putSinks {
+			putter.skips.Add(name, "on_unknown_state: unknown state: "+state)
+		}
+		return nil
+	}
+
+	if source.ReportFirstTerminalOnly && putter.terminalSent {
+		putter.log.Info("not sending",
+			"reason", "report_first_terminal_only: terminal state already sent",
+			"state", putter.Request.Params.State)
+		for _, name := range putter.putSinks {
+			putter.skips.Add(name, "report_first_terminal_only: terminal state already sent")
+		}
+		return nil
+	}
+
+	nonBlocking := sets.From(source.NonBlockingSinks...)
+	background := &backgroundSends{
+		log:        putter.log.Named("background"),
+		ignored:    putter.ignored,
+		unfinished: putter.unfinished,
+	}
+	// The names of the sinks, since the wrappers hide them.
+	names := make([]string, 0, len(sinks)+1)
+	for i, sink := range sinks {
+		name := sinkName(sink)
+		names = append(names, name)
+		if source.DryRun.Contains(name) {
+			sink = dryRunSink{
+				log:     putter.log.Named("dryRun"),
+				name:    name,
+				request: putter.Request,
+				skips:   putter.skips,
+			}
+		}
+		// Before the wrappers that can ignore the error.
+		if source.sinkActive(sinkAudit) && name != sinkAudit {
+			sink = failedSink{Sinker: sink, name: name, failed: putter.failed}
+		}
+		if source.IgnoreSinkErrors &&
+			!(name == sinkGitHub && source.StrictGitHub) {
+			sink = lenientSink{
+				Sinker:  sink,
+				log:     putter.log.Named("lenient"),
+				name:    name,
+				ignored: putter.ignored,
+			}
+		}
+		if nonBlocking.Contains(name) {
+			sink = background.wrap(sink, name)
+		}
+		sinks[i] = sink
+	}
+	// Last, so that it runs after all the other sinks, also if some of them fail.
+	if len(source.NonBlockingSinks) > 0 {
+		sinks = append(sinks, background.waiter(
+			sinkTimeout(source.NonBlockingWindow, defaultNonBlockingWindow)))
+		names = append(names, "non_blocking_sinks")
+	}
+	// The upper bound of the whole put step, so it must wrap also the waiter.
+	if source.PutTimeout != "" {
+		if putter.started.IsZero() {
+			putter.started = time.Now()
+		}
+		timeout := sinkTimeout(source.PutTimeout, 0)
+		for i, sink := range sinks {
+			sinks[i] = deadlineSink{
+				Sinker:   sink,
+				name:     names[i],
+				deadline: putter.started.Add(timeout),
+				timeout:  timeout,
+			}
+		}
+	}
+	putter.sinkNames = names
+	return sinks
+}
+
+// uniqueSinkNames returns the names of sinks, in order and without duplicates (there
+// can be multiple GitHub sinks, see params.multi_ref_pattern).
+func uniqueSinkNames(sinks []Sinker) []string {
+	var names []string
+	for _, sink := range sinks {
+		if name := sinkName(sink); !sets.From(names...).Contains(name) {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// sinkName returns the name used to identify sink in the configuration and in logs.
+func sinkName(sink Sinker) string {
+	switch sink.(type) {
+	case GitHubCommitStatusSink:
+		return sinkGitHub
+	case GoogleChatSink:
+		return sinkGChat
+	case S3Sink:
+		return sinkS3
+	case SNSSink:
+		return sinkSNS
+	case PubSubSink:
+		return sinkPubSub
+	case FileAuditSink:
+		return sinkAudit
+	default:
+		return fmt.Sprintf("%T", sink)
+	}
+}
+
+// lenientSink wraps a [Sinker] whose errors must not fail the put step (see
+// source.ignore_sink_errors): it logs the error instead of returning it.
+type lenientSink struct {
+	Sinker
+	log     hclog.Logger
+	name    string
+	ignored SkipReport
+}
+
+func (sink lenientSink) Send() error {
+	if err := sink.Sinker.Send(); err != nil {
+		sink.log.Error("ignoring sink error", "reason", "ignore_sink_errors",
+			"sink", sink.name, "error", err)
+		sink.ignored.Add(sink.name, err.Error())
+	}
+	return nil
+}
+
+// failedSink wraps a [Sinker], recording its error, so that the audit record lists
+// only the sinks that sent (see source.audit_log_file).
+type failedSink struct {
+	Sinker
+	name   string
+	failed SkipReport
+}
+
+func (sink failedSink) Send() error {
+	err := sink.Sinker.Send()
+	if err != nil {
+		sink.failed.Add(sink.name, err.Error())
+	}
+	return err
+}
+
+// dryRunSink replaces a [Sinker] configured to be dry-run (see source.dry_run): it
+// logs the intent instead of sending.
+type dryRunSink struct {
+	log     hclog.Logger
+	name    string
+	request PutRequest
+	skips   SkipReport
+}
+
+func (sink dryRunSink) Send() error {
+	sink.log.Info("dry run: not sending", "sink", sink.name,
+		"state", sink.request.Params.State, "context", ghMakeContext(sink.request))
+	sink.skips.Add(sink.name, "dry_run")
+	return nil
+}
+
+// SkipReport records, per sink name, the reason why a sink didn't send. It is summarized
+// in the put output metadata and reported in detail if source.report_skipped_sinks is
+// set.
+// A nil SkipReport is valid and records nothing.
+// It is safe for concurrent use, since a sink can run in the background (see
+// source.non_blocking_sinks).
+type SkipReport map[string]string
+
+// skipReportMu protects all the SkipReport maps. They are few and small.
+var skipReportMu sync.Mutex
+
+// Add records that sink didn't send, for reason.
+func (r SkipReport) Add(sink, reason string) {
+	skipReportMu.Lock()
+	defer skipReportMu.Unlock()
+	if r != nil {
+		r[sink] = reason
+	}
+}
+
+// Reason returns the reason recorded for sink, if any.
+func (r SkipReport) Reason(sink string) (string, bool) {
+	skipReportMu.Lock()
+	defer skipReportMu.Unlock()
+	reason, found := r[sink]
+	return reason, found
+}
+
+// Names returns the sorted names of the recorded sinks.
+func (r SkipReport) Names() []string {
+	skipReportMu.Lock()
+	defer skipReportMu.Unlock()
+	names := make([]string, 0, len(r))
+	for name := range r {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// summary returns a one-line summary of the outcome of the sinks, for example
+// "2 sinks: github ok, gchat skipped". Since Output is called only if all the sinks
+// succeeded, the outcome of a sink is either ok or skipped, or failed if the error was
+// ignored (see source.ignore_sink_errors), or unfinished if it was still running in the
+// background at the end of the completion window (see source.non_blocking_sinks).
+func (putter *ProdPutter) summary() string {
+	parts := make([]string, 0, len(putter.putSinks))
+	for _, name := range putter.putSinks {
+		outcome := "ok"
+		if _, found := putter.skips.Reason(name); found {
+			outcome = "skipped"
+		}
+		if _, found := putter.ignored.Reason(name); found {
+			outcome = "failed (ignored)"
+		}
+		if _, found := putter.unfinished.Reason(name); found {
+			outcome = "unfinished"
+		}
+		parts = append(parts, name+" "+outcome)
+	}
+	if len(parts) == 0 {
+		return "0 sinks"
+	}
+	noun := "sinks"
+	if len(parts) == 1 {
+		noun = "sink"
+	}
+	return fmt.Sprintf("%d %s: %s", len(parts), noun, strings.Join(parts, ", "))
+}
+
+// logSummary logs one line with the outcome of the put step, easy to grep across builds.
+// The sinks that ran include the ones still sending in the background (see
+// source.non_blocking_sinks); the failed ones include the ones whose error was ignored
+// (see source.ignore_sink_errors).
+func (putter *ProdPutter) logSummary(errs []error) {
+	var failedNames []string
+	for i, err := range errs {
+		if err != nil && i < len(putter.sinkNames) {
+			failedNames = append(failedNames, putter.sinkNames[i])
+		}
+	}
+	failed := sets.From(failedNames...)
+	var ran, skipped, failures []string
+	for _, name := range putter.putSinks {
+		_, ignored := putter.ignored.Reason(name)
+		_, skip := putter.skips.Reason(name)
+		switch {
+		case failed.Contains(name) || ignored:
+			failures = append(failures, name)
+		case skip:
+			skipped = append(skipped, name)
+		default:
+			ran = append(ran, name)
+		}
+	}
+	var contexts []string
+	if sets.From(ran...).Contains(sinkGitHub) {
+		contexts = append(contexts, ghMakeContext(putter.Request))
+	}
+	sha := putter.gitRef
+	if len(sha) > 9 {
+		sha = sha[0:9]
+	}
+	var duration time.Duration
+	if !putter.started.IsZero() {
+		duration = time.Since(putter.started).Round(time.Millisecond)
+	}
+
+	putter.log.Info("put summary",
+		"repo", putter.Request.Source.Owner+"/"+putter.Request.Source.Repo,
+		"sha", sha,
+		"state", putter.Request.Params.State,
+		"contexts", strings.Join(contexts, ","),
+		"sinks-run", strings.Join(ran, ","),
+		"sinks-skipped", strings.Join(skipped, ","),
+		"sinks-failed", strings.Join(failures, ","),
+		"duration", duration)
 }
 
 func (putter *ProdPutter) Output(out io.Writer) error {
 	// Following the protocol for put, we return the version and metadata.
 	// For Cogito, the metadata contains the Concourse build state.
 	output := Output{
-		Version:  DummyVersion,
-		Metadata: []Metadata{{Name: KeyState, Value: string(putter.Request.Params.State)}},
+		Version: DummyVersion,
+		Metadata: []Metadata{
+			{Name: KeyState, Value: string(putter.Request.Params.State)},
+			{Name: KeyResult, Value: putter.summary()},
+		},
+	}
+	// If source.canonicalize_repo is set, also the canonical owner/repo.
+	if src := putter.Request.Source; src.CanonicalizeRepo {
+		output.Metadata = append(output.Metadata,
+			Metadata{Name: "repo", Value: src.Owner + "/" + src.Repo})
+	}
+	// If source.report_skipped_sinks is set, also the sinks that didn't send.
+	if putter.Request.Source.ReportSkippedSinks {
+		for _, name := range putter.skips.Names() {
+			reason, _ := putter.skips.Reason(name)
+			putter.log.Info("skipped notification", "sink", name, "reason", reason)
+			output.Metadata = append(output.Metadata,
+				Metadata{Name: "skipped." + name, Value: reason})
+		}
 	}
 	enc := json.NewEncoder(out)
 	if err := enc.Encode(output); err != nil {
@@ -192,7 +937,11 @@ func collectInputDirs(dir string) ([]string, error) {
 // - The remote origin url can be parsed following the GitHub conventions.
 // - The result of the parse matches OWNER and REPO.
 func checkGitRepoDir(dir, owner, repo string) error {
-	cfg, err := mini.LoadConfiguration(filepath.Join(dir, ".git/config"))
+	_, commonDir, err := gitDirs(dir)
+	if err != nil {
+		return err
+	}
+	cfg, err := mini.LoadConfiguration(filepath.Join(commonDir, "config"))
 	if err != nil {
 		return fmt.Errorf("parsing .git/config: %w", err)
 	}
@@ -313,11 +1062,56 @@ func parseGitPseudoURL(rawURL string) (gitURL, error) {
 	return gu, nil
 }
 
+// gitDirs returns the git directory of the repository at repoPath, with HEAD, and the
+// common directory, with the config and the refs. Usually both are repoPath/.git, but
+// .git can also be a file pointing to the git directory ("gitdir: PATH"), as for a
+// worktree or a submodule. The git directory of a worktree in turn names the common
+// directory in its file "commondir".
+//
+// If .git is not a file, gitDirs doesn't check further, so that the callers report
+// the missing file that they need.
+func gitDirs(repoPath string) (string, string, error) {
+	dotGit := filepath.Join(repoPath, ".git")
+	fi, err := os.Stat(dotGit)
+	if err != nil || fi.IsDir() {
+		return dotGit, dotGit, nil
+	}
+
+	buf, err := os.ReadFile(dotGit)
+	if err != nil {
+		return "", "", fmt.Errorf("git dir: %w", err)
+	}
+	line := strings.TrimSpace(string(buf))
+	if !strings.HasPrefix(line, "gitdir:") {
+		return "", "", fmt.Errorf("git dir: invalid .git file: %q (want: gitdir: PATH)",
+			line)
+	}
+	gitDir := strings.TrimSpace(strings.TrimPrefix(line, "gitdir:"))
+	if !filepath.IsAbs(gitDir) {
+		gitDir = filepath.Join(repoPath, gitDir)
+	}
+
+	commonDir := gitDir
+	buf, err = os.ReadFile(filepath.Join(gitDir, "commondir"))
+	if err == nil {
+		commonDir = strings.TrimSpace(string(buf))
+		if !filepath.IsAbs(commonDir) {
+			commonDir = filepath.Join(gitDir, commonDir)
+		}
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return "", "", fmt.Errorf("git dir: %w", err)
+	}
+	return gitDir, commonDir, nil
+}
+
 // getGitCommit looks into a git repository and extracts the commit SHA of the HEAD.
 func getGitCommit(repoPath string) (string, error) {
-	dotGitPath := filepath.Join(repoPath, ".git")
+	gitDir, dotGitPath, err := gitDirs(repoPath)
+	if err != nil {
+		return "", err
+	}
 
-	headPath := filepath.Join(dotGitPath, "HEAD")
+	headPath := filepath.Join(gitDir, "HEAD")
 	headBuf, err := os.ReadFile(headPath)
 	if err != nil {
 		return "", fmt.Errorf("git commit: read HEAD: %w", err)
@@ -342,6 +1136,17 @@ func getGitCommit(repoPath string) (string, error) {
 		shaRelPath := tokens[1]
 		shaPath := filepath.Join(dotGitPath, shaRelPath)
 		shaBuf, err := os.ReadFile(shaPath)
+		if errors.Is(err, fs.ErrNotExist) {
+			// The ref might have been packed (git gc, git pack-refs, some clones).
+			packed, errPacked := readPackedRefs(dotGitPath)
+			if errPacked != nil {
+				return "", fmt.Errorf("git commit: branch checkout: %w", errPacked)
+			}
+			if packedSHA, ok := packed[shaRelPath]; ok {
+				sha = packedSHA
+				break
+			}
+		}
 		if err != nil {
 			return "", fmt.Errorf("git commit: branch checkout: read SHA file: %w", err)
 		}
@@ -353,6 +1158,205 @@ func getGitCommit(repoPath string) (string, error) {
 	return sha, nil
 }
 
+// contextCollision returns true if status, the latest status with our context, was
+// posted by another tool (or by another Concourse): its target_url doesn't point to
+// our Concourse. It returns false if it cannot tell, for example in manual mode. See
+// source.warn_on_context_collision.
+func contextCollision(env Environment, status github.Status) bool {
+	if status.Context == "" || status.TargetURL == "" || !env.InConcourse() {
+		return false
+	}
+	return !strings.HasPrefix(status.TargetURL, env.AtcExternalUrl)
+}
+
+// getGitBranch returns the name of the branch checked out in the git repository
+// repoPath, or the empty string if HEAD is detached.
+func getGitBranch(repoPath string) (string, error) {
+	gitDir, _, err := gitDirs(repoPath)
+	if err != nil {
+		return "", err
+	}
+	headBuf, err := os.ReadFile(filepath.Join(gitDir, "HEAD"))
+	if err != nil {
+		return "", fmt.Errorf("git branch: read HEAD: %w", err)
+	}
+	head := strings.TrimSpace(string(headBuf))
+	if !strings.HasPrefix(head, "ref: refs/heads/") {
+		return "", nil
+	}
+	return strings.TrimPrefix(head, "ref: refs/heads/"), nil
+}
+
+// getGitTag returns the first tag, in lexical order, pointing to commit sha in the git
+// repository repoPath, or the empty string if there is none. A loose annotated tag is
+// not peeled (it points to the tag object), so it is not found.
+func getGitTag(repoPath, sha string) (string, error) {
+	refs, err := gitListRefs(repoPath)
+	if err != nil {
+		return "", fmt.Errorf("git tag: %w", err)
+	}
+	var tags []string
+	for name, refSHA := range refs {
+		if refSHA == sha && strings.HasPrefix(name, "refs/tags/") {
+			tags = append(tags, strings.TrimPrefix(name, "refs/tags/"))
+		}
+	}
+	if len(tags) == 0 {
+		return "", nil
+	}
+	sort.Strings(tags)
+	return tags[0], nil
+}
+
+// contextForBranch returns the context of the first glob of contexts, in lexical order,
+// that matches branch. See source.context_by_branch.
+func contextForBranch(contexts map[string]string, branch string) (string, bool) {
+	if branch == "" {
+		return "", false
+	}
+	globs := make([]string, 0, len(contexts))
+	for glob := range contexts {
+		globs = append(globs, glob)
+	}
+	sort.Strings(globs)
+	for _, glob := range globs {
+		// The globs have been validated by Source.Validate.
+		if matched, _ := path.Match(glob, branch); matched {
+			return contexts[glob], true
+		}
+	}
+	return "", false
+}
+
+// readPackedRefs returns a map from ref name to SHA, for all the refs in the
+// packed-refs file of the git directory dotGitPath. A missing packed-refs file is not
+// an error.
+//
+// For annotated tags, the SHA is the one of the peeled commit (the "^SHA" line that
+// follows the tag), since it is the one that can have a commit status.
+func readPackedRefs(dotGitPath string) (map[string]string, error) {
+	refs := make(map[string]string)
+	buf, err := os.ReadFile(filepath.Join(dotGitPath, "packed-refs"))
+	if errors.Is(err, fs.ErrNotExist) {
+		return refs, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read packed-refs: %w", err)
+	}
+
+	var prev string
+	for i, line := range strings.Split(string(buf), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if strings.HasPrefix(line, "^") {
+			if prev == "" {
+				return nil, fmt.Errorf("packed-refs: line %d: peeled SHA without ref", i+1)
+			}
+			refs[prev] = strings.TrimPrefix(line, "^")
+			continue
+		}
+		tokens := strings.Fields(line)
+		if len(tokens) != 2 {
+			return nil, fmt.Errorf("packed-refs: line %d: invalid format: %q", i+1, line)
+		}
+		refs[tokens[1]] = tokens[0]
+		prev = tokens[1]
+	}
+	return refs, nil
+}
+
+// hasTrailer returns true if commit message msg has a git trailer named key (matched
+// case-insensitively) with a true value, for example "Cogito-Skip-Notify: true".
+// As git does, only the last paragraph of the message is considered.
+func hasTrailer(msg, key string) bool {
+	paragraphs := strings.Split(strings.TrimSpace(msg), "\n\n")
+	for _, line := range strings.Split(paragraphs[len(paragraphs)-1], "\n") {
+		k, v, found := strings.Cut(line, ":")
+		if !found || !strings.EqualFold(strings.TrimSpace(k), key) {
+			continue
+		}
+		if value, err := strconv.ParseBool(strings.TrimSpace(v)); err == nil && value {
+			return true
+		}
+	}
+	return false
+}
+
+// gitListRefs returns a map from ref name (for example refs/tags/v1) to SHA, for all
+// the refs of the git repository at repoPath, both packed and loose. As git does, a
+// loose ref takes precedence over a packed ref with the same name.
+func gitListRefs(repoPath string) (map[string]string, error) {
+	_, dotGitPath, err := gitDirs(repoPath)
+	if err != nil {
+		return nil, err
+	}
+	refs, err := readPackedRefs(dotGitPath)
+	if err != nil {
+		return nil, fmt.Errorf("git refs: %w", err)
+	}
+	err = filepath.WalkDir(filepath.Join(dotGitPath, "refs"),
+		func(path string, d fs.DirEntry, err error) error {
+			if errors.Is(err, fs.ErrNotExist) && d == nil {
+				// A repository with only packed refs might not have the refs directory.
+				return nil
+			}
+			if err != nil || d.IsDir() {
+				return err
+			}
+			buf, err := os.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			name, err := filepath.Rel(dotGitPath, path)
+			if err != nil {
+				return err
+			}
+			refs[filepath.ToSlash(name)] = strings.TrimSpace(string(buf))
+			return nil
+		})
+	if err != nil {
+		return nil, fmt.Errorf("git refs: %w", err)
+	}
+	return refs, nil
+}
+
+// matchGitRefs returns the sorted, unique SHAs of the refs of the git repository at
+// repoPath whose name matches regexp pattern, excluding SHA exclude.
+func matchGitRefs(repoPath, pattern, exclude string) ([]string, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("multi_ref_pattern: %s", err)
+	}
+	refs, err := gitListRefs(repoPath)
+	if err != nil {
+		return nil, fmt.Errorf("multi_ref_pattern: %w", err)
+	}
+	var shas []string
+	for name, sha := range refs {
+		if re.MatchString(name) && sha != exclude {
+			shas = append(shas, sha)
+		}
+	}
+	return sets.From(shas...).OrderedList(), nil
+}
+
+// buildDuration returns the humanized duration of the build from params.started_at to
+// now, or the empty string if params.started_at is not set.
+func buildDuration(params PutParams, now time.Time) string {
+	if params.StartedAt == "" {
+		return ""
+	}
+	// Already validated by PutParams.Validate.
+	startedAt, err := time.Parse(time.RFC3339, params.StartedAt)
+	if err != nil {
+		return ""
+	}
+	duration, _ := humanizeDuration(now.Sub(startedAt).Truncate(time.Second))
+	return duration
+}
+
 // concourseBuildURL builds a URL pointing to a specific build of a job in a pipeline.
 func concourseBuildURL(env Environment) string {
 	// Example:
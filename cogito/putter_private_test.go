@@ -2,6 +2,7 @@ package cogito
 
 import (
 	"errors"
+	"net/http"
 	"net/url"
 	"os"
 	"path/filepath"
@@ -9,6 +10,7 @@ import (
 
 	"github.com/Pix4D/cogito/testhelp"
 	"github.com/google/go-cmp/cmp"
+	"github.com/hashicorp/go-hclog"
 	"gotest.tools/v3/assert"
 )
 
@@ -360,6 +362,12 @@ func TestGitGetCommitSuccess(t *testing.T) {
 			repoURL: "dummy",
 			head:    wantSHA,
 		},
+		{
+			name:    "branch checkout with packed refs",
+			dir:     "testdata/repo-packed-refs/a-repo",
+			repoURL: "dummy",
+			head:    defHead,
+		},
 	}
 
 	for _, tc := range testCases {
@@ -408,6 +416,80 @@ func TestGitGetCommitFailure(t *testing.T) {
 			head:    "banana mango",
 			wantErr: "git commit: branch checkout: read SHA file: open ",
 		},
+		{
+			name:    "HEAD points to ref missing also from packed-refs",
+			dir:     "testdata/repo-packed-refs/a-repo",
+			repoURL: "dummyURL",
+			head:    "ref: refs/heads/banana",
+			wantErr: "git commit: branch checkout: read SHA file: open ",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) { test(t, tc) })
+	}
+}
+
+func TestGitListRefsPacked(t *testing.T) {
+	const commitSHA = "af6cd86e98eb1485f04d38b78d9532e916bbff02"
+	tmpDir := testhelp.MakeGitRepoFromTestdata(t, "testdata/repo-packed-refs/a-repo",
+		"dummy", commitSHA, "ref: refs/heads/a-branch-FIXME")
+
+	refs, err := gitListRefs(filepath.Join(tmpDir, "a-repo"))
+
+	assert.NilError(t, err)
+	assert.DeepEqual(t, refs, map[string]string{
+		"refs/heads/a-branch-FIXME": commitSHA,
+		"refs/tags/sub-a/v1":        "1111aaaa1111aaaa",
+		// Annotated tag: the peeled commit SHA.
+		"refs/tags/sub-a/v2": "3333cccc3333cccc",
+	})
+}
+
+func TestHasTrailer(t *testing.T) {
+	type testCase struct {
+		name string
+		msg  string
+		want bool
+	}
+
+	const key = "Cogito-Skip-Notify"
+
+	test := func(t *testing.T, tc testCase) {
+		assert.Equal(t, hasTrailer(tc.msg, key), tc.want)
+	}
+
+	testCases := []testCase{
+		{
+			name: "trailer in last paragraph",
+			msg:  "Fix typo\n\nBody.\n\nCogito-Skip-Notify: true\nSigned-off-by: A <a@b>\n",
+			want: true,
+		},
+		{
+			name: "key matched case-insensitively",
+			msg:  "Fix typo\n\ncogito-skip-notify: TRUE",
+			want: true,
+		},
+		{
+			name: "no trailer",
+			msg:  "Fix typo\n\nSigned-off-by: A <a@b>",
+			want: false,
+		},
+		{
+			name: "trailer with false value",
+			msg:  "Fix typo\n\nCogito-Skip-Notify: false",
+			want: false,
+		},
+		{
+			name: "not in last paragraph",
+			msg:  "Fix typo\n\nCogito-Skip-Notify: true\n\nThe real body.",
+			want: false,
+		},
+		{
+			name: "empty message",
+			msg:  "",
+			want: false,
+		},
 	}
 
 	for _, tc := range testCases {
@@ -437,6 +519,15 @@ func TestMultiErrString(t *testing.T) {
 			errs: []error{errors.New("error 1"), errors.New("error 2")},
 			wantErr: `multiple errors:
 	error 1
+	error 2`,
+		},
+		{
+			name: "identical errors are coalesced",
+			errs: []error{
+				errors.New("error 1"), errors.New("error 2"), errors.New("error 1"),
+			},
+			wantErr: `multiple errors:
+	error 1 (x2)
 	error 2`,
 		},
 	}
@@ -500,3 +591,28 @@ func TestConcourseBuildURL(t *testing.T) {
 		t.Run(tc.name, func(t *testing.T) { test(t, tc) })
 	}
 }
+
+func TestPutterTransportKeepAlivesAndDump(t *testing.T) {
+	orig := http.DefaultTransport
+	request := PutRequest{
+		Source: Source{
+			Owner:             "the-owner",
+			Repo:              "the-repo",
+			AccessToken:       "the-token",
+			DisableKeepAlives: true,
+			DebugDumpRequests: true,
+		},
+		Params: PutParams{State: StateSuccess},
+	}
+	putter := NewPutter("dummy-API", hclog.NewNullLogger())
+
+	err := putter.LoadConfiguration(testhelp.ToJSON(t, request), []string{"dummy-dir"})
+
+	assert.NilError(t, err)
+	assert.Equal(t, http.DefaultTransport, orig, "http.DefaultTransport modified")
+	dump, ok := putter.transport.(dumpTransport)
+	assert.Assert(t, ok, "have: %T", putter.transport)
+	tr, ok := dump.next.(*http.Transport)
+	assert.Assert(t, ok, "have: %T", dump.next)
+	assert.Assert(t, tr.DisableKeepAlives)
+}
@@ -0,0 +1,52 @@
+package cogito
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// deadlineSink wraps a [Sinker], failing it if it doesn't complete by the deadline of
+// the put step (see source.put_timeout). The requests in flight of a sink that times out
+// are cancelled by the context of the put step (see [ProdPutter.putContext]).
+type deadlineSink struct {
+	Sinker
+	name     string
+	deadline time.Time
+	timeout  time.Duration
+}
+
+func (sink deadlineSink) Send() error {
+	remaining := time.Until(sink.deadline)
+	if remaining <= 0 {
+		return sink.timedOut("not sent")
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- sink.Sinker.Send() }()
+	timer := time.NewTimer(remaining)
+	defer timer.Stop()
+	select {
+	case err := <-done:
+		// The sink might have failed because the context of the put step expired.
+		if err != nil && !time.Now().Before(sink.deadline) {
+			return sink.timedOut("not completed")
+		}
+		return err
+	case <-timer.C:
+		return sink.timedOut("not completed")
+	}
+}
+
+func (sink deadlineSink) timedOut(what string) error {
+	return fmt.Errorf("put timed out after %s (put_timeout): sink %s %s",
+		sink.timeout, sink.name, what)
+}
+
+// orBackground returns ctx, or [context.Background] if ctx is nil.
+func orBackground(ctx context.Context) context.Context {
+	if ctx == nil {
+		return context.Background()
+	}
+	return ctx
+}
@@ -0,0 +1,101 @@
+package cogito
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/Pix4D/cogito/aws"
+	"github.com/hashicorp/go-hclog"
+)
+
+// S3Sink is an implementation of [Sinker] for the Cogito resource.
+// It writes a status record to an S3-compatible object store.
+type S3Sink struct {
+	Log     hclog.Logger
+	GitRef  string
+	Request PutRequest
+	// Transport sends the HTTP requests; nil means [http.DefaultTransport].
+	Transport http.RoundTripper
+	// Ctx is the context of the put step, see source.put_timeout. Nil means
+	// [context.Background].
+	Ctx context.Context
+}
+
+// S3StatusRecord is the JSON object written by [S3Sink].
+type S3StatusRecord struct {
+	Owner    string    `json:"owner"`
+	Repo     string    `json:"repo"`
+	SHA      string    `json:"sha"`
+	Context  string    `json:"context"`
+	State    string    `json:"state"`
+	BuildURL string    `json:"build_url"`
+	Time     time.Time `json:"time"`
+}
+
+// Send writes the status record to the configured bucket, with key
+// <prefix>/<owner>/<repo>/<sha>/<context>.json. See [s3KeyPart].
+func (sink S3Sink) Send() error {
+	sink.Log.Debug("send: started")
+	defer sink.Log.Debug("send: finished")
+
+	src := sink.Request.Source
+	context := ghMakeContext(sink.Request)
+	record := S3StatusRecord{
+		Owner:    src.Owner,
+		Repo:     src.Repo,
+		SHA:      sink.GitRef,
+		Context:  context,
+		State:    string(sink.Request.Params.State),
+		BuildURL: concourseBuildURL(sink.Request.Env),
+		Time:     time.Now().UTC(),
+	}
+	body, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("S3Sink: %s", err)
+	}
+
+	endpoint := src.S3Endpoint
+	if endpoint == "" {
+		endpoint = aws.S3Endpoint(src.S3Region)
+	}
+	obj := aws.S3Object{
+		Endpoint: endpoint,
+		Region:   src.S3Region,
+		Bucket:   src.S3Bucket,
+		Key: path.Join(src.S3Prefix, s3KeyPart(src.Owner), s3KeyPart(src.Repo),
+			s3KeyPart(sink.GitRef), s3KeyPart(context+".json")),
+	}
+	creds := aws.Credentials{AccessKey: src.S3AccessKey, SecretKey: src.S3SecretKey}
+
+	ctx, cancel := awsContext(sink.Ctx)
+	defer cancel()
+	if err := aws.PutObject(ctx, sink.Transport, creds, obj, "application/json",
+		body); err != nil {
+		return fmt.Errorf("S3Sink: %s", err)
+	}
+
+	sink.Log.Info("status written successfully to S3",
+		"state", record.State, "bucket", obj.Bucket, "key", obj.Key)
+	return nil
+}
+
+// s3KeyPart escapes part, to be joined in a key, so that it stays a single path segment
+// below s3_prefix: "/" becomes "%2F" (and "%" becomes "%25", to keep it reversible),
+// and "." and ".." become "%2E" and "%2E%2E".
+func s3KeyPart(part string) string {
+	part = strings.NewReplacer("%", "%25", "/", "%2F").Replace(part)
+	if part == "." || part == ".." {
+		part = strings.ReplaceAll(part, ".", "%2E")
+	}
+	return part
+}
+
+// awsContext returns the context for the AWS API calls (S3 and SNS).
+func awsContext(parent context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(orBackground(parent), 30*time.Second)
+}
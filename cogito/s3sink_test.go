@@ -0,0 +1,130 @@
+package cogito_test
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Pix4D/cogito/cogito"
+	"github.com/hashicorp/go-hclog"
+	"gotest.tools/v3/assert"
+)
+
+func TestSinkS3SendSuccess(t *testing.T) {
+	var path string
+	var body []byte
+	ts := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			path = req.URL.EscapedPath()
+			body, _ = io.ReadAll(req.Body)
+		}))
+	request := basePutRequest
+	request.Source.S3Endpoint = ts.URL
+	request.Source.S3Region = "eu-west-1"
+	request.Source.S3Bucket = "the-bucket"
+	request.Source.S3Prefix = "statuses"
+	request.Source.S3AccessKey = "the-access-key"
+	request.Source.S3SecretKey = "the-secret-key"
+	request.Env.BuildJobName = "the-job"
+	assert.NilError(t, request.Source.Validate())
+	sink := cogito.S3Sink{
+		Log:     hclog.NewNullLogger(),
+		GitRef:  "deadbeef",
+		Request: request,
+	}
+
+	err := sink.Send()
+
+	assert.NilError(t, err)
+	ts.Close() // Avoid races before the following asserts.
+	assert.Equal(t, path, "/the-bucket/statuses/the-owner/the-repo/deadbeef/the-job.json")
+	var record cogito.S3StatusRecord
+	assert.NilError(t, json.Unmarshal(body, &record))
+	assert.Equal(t, record.Owner, "the-owner")
+	assert.Equal(t, record.Repo, "the-repo")
+	assert.Equal(t, record.SHA, "deadbeef")
+	assert.Equal(t, record.Context, "the-job")
+	assert.Equal(t, record.State, string(cogito.StateError))
+}
+
+func TestSinkS3SendKeyStaysBelowPrefix(t *testing.T) {
+	type testCase struct {
+		name     string
+		owner    string
+		context  string
+		wantPath string
+	}
+
+	test := func(t *testing.T, tc testCase) {
+		var path string
+		ts := httptest.NewServer(
+			http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				path = req.URL.EscapedPath()
+			}))
+		request := basePutRequest
+		request.Source.Owner = tc.owner
+		request.Source.S3Endpoint = ts.URL
+		request.Source.S3Bucket = "the-bucket"
+		request.Source.S3Prefix = "statuses"
+		request.Params.Context = tc.context
+		sink := cogito.S3Sink{
+			Log:     hclog.NewNullLogger(),
+			GitRef:  "deadbeef",
+			Request: request,
+		}
+
+		err := sink.Send()
+
+		assert.NilError(t, err)
+		ts.Close() // Avoid races before the following asserts.
+		assert.Equal(t, path, tc.wantPath)
+	}
+
+	testCases := []testCase{
+		{
+			name:     "slash in context",
+			owner:    "the-owner",
+			context:  "ci/build",
+			wantPath: "/the-bucket/statuses/the-owner/the-repo/deadbeef/ci%252Fbuild.json",
+		},
+		{
+			name:    "dot-dot in context",
+			owner:   "the-owner",
+			context: "../../../escape",
+			wantPath: "/the-bucket/statuses/the-owner/the-repo/deadbeef/" +
+				"..%252F..%252F..%252Fescape.json",
+		},
+		{
+			name:     "dot-dot owner",
+			owner:    "..",
+			context:  "the-job",
+			wantPath: "/the-bucket/statuses/%252E%252E/the-repo/deadbeef/the-job.json",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) { test(t, tc) })
+	}
+}
+
+func TestSinkS3SendFailure(t *testing.T) {
+	ts := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			w.WriteHeader(http.StatusTeapot)
+		}))
+	defer ts.Close()
+	request := basePutRequest
+	request.Source.S3Endpoint = ts.URL
+	request.Source.S3Bucket = "the-bucket"
+	sink := cogito.S3Sink{
+		Log:     hclog.NewNullLogger(),
+		GitRef:  "deadbeef",
+		Request: request,
+	}
+
+	err := sink.Send()
+
+	assert.ErrorContains(t, err, "S3Sink: S3 PutObject: status: 418 I'm a teapot")
+}
@@ -0,0 +1,47 @@
+package cogito
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// allStates is the list of all the valid build states.
+// NOTE: this list must be kept in sync with the custom JSON methods of [BuildState].
+var allStates = []BuildState{
+	StateAbort, StateError, StateFailure, StatePending, StateSuccess, StateSkipped,
+	StateQueued, StateNeutral,
+}
+
+// SelfTest performs a quick check that the binary works, without touching the network
+// nor the filesystem. It is meant for operators packaging cogito in a custom image.
+func SelfTest() error {
+	source := Source{Owner: "the-owner", Repo: "the-repo", AccessToken: "the-token"}
+	if err := source.Validate(); err != nil {
+		return fmt.Errorf("selftest: validating canned source: %s", err)
+	}
+
+	for _, state := range allStates {
+		data, err := json.Marshal(state)
+		if err != nil {
+			return fmt.Errorf("selftest: marshaling state %s: %s", state, err)
+		}
+		var have BuildState
+		if err := json.Unmarshal(data, &have); err != nil {
+			return fmt.Errorf("selftest: unmarshaling state %s: %s", state, err)
+		}
+		if have != state {
+			return fmt.Errorf("selftest: state round-trip: have: %s; want: %s", have, state)
+		}
+	}
+
+	have, err := renderTemplate("selftest", `{{ .Name | upper | truncate 2 }}`,
+		map[string]string{"Name": "ok!"})
+	if err != nil {
+		return fmt.Errorf("selftest: %s", err)
+	}
+	if have != "OK" {
+		return fmt.Errorf("selftest: template: have: %s; want: OK", have)
+	}
+
+	return nil
+}
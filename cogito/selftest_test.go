@@ -0,0 +1,12 @@
+package cogito_test
+
+import (
+	"testing"
+
+	"github.com/Pix4D/cogito/cogito"
+	"gotest.tools/v3/assert"
+)
+
+func TestSelfTestSuccess(t *testing.T) {
+	assert.NilError(t, cogito.SelfTest())
+}
@@ -0,0 +1,97 @@
+package cogito
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/Pix4D/cogito/aws"
+	"github.com/hashicorp/go-hclog"
+)
+
+// SNSSink is an implementation of [Sinker] for the Cogito resource.
+// It publishes a status record to an AWS SNS topic.
+type SNSSink struct {
+	Log     hclog.Logger
+	GitRef  string
+	Request PutRequest
+	// Skips, if not nil, records why the message is not sent.
+	Skips SkipReport
+	// Transport sends the HTTP requests; nil means [http.DefaultTransport].
+	Transport http.RoundTripper
+	// Ctx is the context of the put step, see source.put_timeout. Nil means
+	// [context.Background].
+	Ctx context.Context
+}
+
+// Send publishes to the configured topic the same JSON status record written by
+// [S3Sink], with message attributes owner, repo, context and state, to allow SNS
+// subscription filter policies. Like the chat, it honors source.chat_notify_on_states.
+func (sink SNSSink) Send() error {
+	sink.Log.Debug("send: started")
+	defer sink.Log.Debug("send: finished")
+
+	src := sink.Request.Source
+	state := sink.Request.Params.State
+	if !stateIn(state, src.ChatNotifyOnStates) {
+		sink.Log.Debug("not sending",
+			"reason", "state not in chat_notify_on_states", "state", state)
+		sink.Skips.Add(sinkSNS, "state not in chat_notify_on_states")
+		return nil
+	}
+
+	context := ghMakeContext(sink.Request)
+	record := S3StatusRecord{
+		Owner:    src.Owner,
+		Repo:     src.Repo,
+		SHA:      sink.GitRef,
+		Context:  context,
+		State:    string(state),
+		BuildURL: concourseBuildURL(sink.Request.Env),
+		Time:     time.Now().UTC(),
+	}
+	message, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("SNSSink: %s", err)
+	}
+	attributes := map[string]string{
+		"owner":   record.Owner,
+		"repo":    record.Repo,
+		"context": record.Context,
+		"state":   record.State,
+	}
+
+	endpoint := src.SNSEndpoint
+	if endpoint == "" {
+		endpoint = aws.SNSEndpoint(src.AWSRegion)
+	}
+	topic := aws.SNSTopic{
+		Endpoint: endpoint,
+		Region:   src.AWSRegion,
+		ARN:      src.SNSTopicARN,
+	}
+	creds := aws.Credentials{AccessKey: src.SNSAccessKey, SecretKey: src.SNSSecretKey}
+
+	ctx, cancel := awsContext(sink.Ctx)
+	defer cancel()
+	if err := aws.Publish(ctx, sink.Transport, creds, topic, string(message),
+		attributes); err != nil {
+		return fmt.Errorf("SNSSink: %s", err)
+	}
+
+	sink.Log.Info("status published successfully to SNS",
+		"state", record.State, "topic", topic.ARN)
+	return nil
+}
+
+// stateIn returns true if state is in states.
+func stateIn(state BuildState, states []BuildState) bool {
+	for _, x := range states {
+		if state == x {
+			return true
+		}
+	}
+	return false
+}
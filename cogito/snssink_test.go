@@ -0,0 +1,101 @@
+package cogito_test
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+
+	"github.com/Pix4D/cogito/cogito"
+	"github.com/hashicorp/go-hclog"
+	"gotest.tools/v3/assert"
+)
+
+func TestSinkSNSSendSuccess(t *testing.T) {
+	var form url.Values
+	ts := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			body, _ := io.ReadAll(req.Body)
+			form, _ = url.ParseQuery(string(body))
+		}))
+	request := basePutRequest
+	request.Source.SNSTopicARN = "arn:aws:sns:eu-west-1:123456789012:the-topic"
+	request.Source.SNSEndpoint = ts.URL
+	request.Source.AWSRegion = "eu-west-1"
+	request.Source.SNSAccessKey = "the-access-key"
+	request.Source.SNSSecretKey = "the-secret-key"
+	request.Env.BuildJobName = "the-job"
+	assert.NilError(t, request.Source.Validate())
+	sink := cogito.SNSSink{
+		Log:     hclog.NewNullLogger(),
+		GitRef:  "deadbeef",
+		Request: request,
+	}
+
+	err := sink.Send()
+
+	assert.NilError(t, err)
+	ts.Close() // Avoid races before the following asserts.
+	assert.Equal(t, form.Get("TopicArn"), "arn:aws:sns:eu-west-1:123456789012:the-topic")
+	var record cogito.S3StatusRecord
+	assert.NilError(t, json.Unmarshal([]byte(form.Get("Message")), &record))
+	assert.Equal(t, record.SHA, "deadbeef")
+	assert.Equal(t, record.State, string(cogito.StateError))
+	attributes := map[string]string{}
+	for i := 1; i <= 4; i++ {
+		prefix := "MessageAttributes.entry." + strconv.Itoa(i)
+		attributes[form.Get(prefix+".Name")] = form.Get(prefix + ".Value.StringValue")
+	}
+	assert.DeepEqual(t, attributes, map[string]string{
+		"context": "the-job",
+		"owner":   "the-owner",
+		"repo":    "the-repo",
+		"state":   "error",
+	})
+}
+
+func TestSinkSNSSendSkipsStateNotInNotifyStates(t *testing.T) {
+	ts := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			t.Error("unexpected request")
+		}))
+	defer ts.Close()
+	request := basePutRequest
+	request.Params.State = cogito.StatePending
+	request.Source.SNSTopicARN = "the-topic-arn"
+	request.Source.SNSEndpoint = ts.URL
+	request.Source.ChatNotifyOnStates = []cogito.BuildState{cogito.StateFailure}
+	sink := cogito.SNSSink{
+		Log:     hclog.NewNullLogger(),
+		GitRef:  "deadbeef",
+		Request: request,
+	}
+
+	err := sink.Send()
+
+	assert.NilError(t, err)
+}
+
+func TestSinkSNSSendFailure(t *testing.T) {
+	ts := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			w.WriteHeader(http.StatusForbidden)
+		}))
+	defer ts.Close()
+	request := basePutRequest
+	request.Source.SNSTopicARN = "the-topic-arn"
+	request.Source.SNSEndpoint = ts.URL
+	request.Source.ChatNotifyOnStates = []cogito.BuildState{cogito.StateError}
+	sink := cogito.SNSSink{
+		Log:     hclog.NewNullLogger(),
+		GitRef:  "deadbeef",
+		Request: request,
+	}
+
+	err := sink.Send()
+
+	assert.ErrorContains(t, err, "SNSSink: SNS Publish: status: 403 Forbidden")
+}
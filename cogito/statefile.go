@@ -0,0 +1,28 @@
+package cogito
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// readStateFile returns the contents of state file name in dir. If the file doesn't
+// exist, the returned error wraps [fs.ErrNotExist].
+func readStateFile(dir, name string) ([]byte, error) {
+	data, err := os.ReadFile(filepath.Join(dir, name))
+	if err != nil {
+		return nil, fmt.Errorf("reading state file: %w", err)
+	}
+	return data, nil
+}
+
+// writeStateFile writes data to state file name in dir, creating dir if needed.
+func writeStateFile(dir, name string, data []byte) error {
+	if err := os.MkdirAll(dir, 0o770); err != nil {
+		return fmt.Errorf("writing state file: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, name), data, 0o660); err != nil {
+		return fmt.Errorf("writing state file: %w", err)
+	}
+	return nil
+}
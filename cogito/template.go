@@ -0,0 +1,76 @@
+package cogito
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// templateFuncs are the functions available to all the templates compiled by Cogito.
+// NOTE: this list must be kept in sync with the README.
+var templateFuncs = template.FuncMap{
+	"upper":            strings.ToUpper,
+	"truncate":         truncate,
+	"humanizeDuration": humanizeDuration,
+}
+
+// newTemplate returns a template with the Cogito template functions registered.
+// All the templates compiled by Cogito must be created via newTemplate.
+func newTemplate(name string) *template.Template {
+	return template.New(name).Funcs(templateFuncs).Option("missingkey=error")
+}
+
+// renderTemplate compiles text as a template and executes it with data.
+func renderTemplate(name, text string, data any) (string, error) {
+	tmpl, err := newTemplate(name).Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("parsing template %s: %s", name, err)
+	}
+	var bld strings.Builder
+	if err := tmpl.Execute(&bld, data); err != nil {
+		return "", fmt.Errorf("executing template %s: %s", name, err)
+	}
+	return bld.String(), nil
+}
+
+// truncate returns the first n characters of s. The argument order allows to use it
+// in a pipeline: {{ .Foo | truncate 10 }}.
+func truncate(n int, s string) string {
+	runes := []rune(s)
+	if n < 0 || len(runes) <= n {
+		return s
+	}
+	return string(runes[:n])
+}
+
+// humanizeDuration returns a short, human-readable representation of d, keeping only
+// the two most significant units, for example "1h 2m", "2m 5s", "45s".
+// Parameter d can be a [time.Duration] or a string parseable by [time.ParseDuration].
+func humanizeDuration(d any) (string, error) {
+	var dur time.Duration
+	switch v := d.(type) {
+	case time.Duration:
+		dur = v
+	case string:
+		var err error
+		if dur, err = time.ParseDuration(v); err != nil {
+			return "", fmt.Errorf("humanizeDuration: %s", err)
+		}
+	default:
+		return "", fmt.Errorf("humanizeDuration: unsupported type %T", d)
+	}
+
+	dur = dur.Round(time.Second)
+	hours := int(dur.Hours())
+	minutes := int(dur.Minutes()) % 60
+	seconds := int(dur.Seconds()) % 60
+	switch {
+	case hours > 0:
+		return fmt.Sprintf("%dh %dm", hours, minutes), nil
+	case minutes > 0:
+		return fmt.Sprintf("%dm %ds", minutes, seconds), nil
+	default:
+		return fmt.Sprintf("%ds", seconds), nil
+	}
+}
@@ -0,0 +1,83 @@
+package cogito
+
+import (
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestRenderTemplateSuccess(t *testing.T) {
+	data := map[string]any{
+		"Name":     "a-very-long-pipeline-name",
+		"Duration": 3*time.Minute + 25*time.Second,
+	}
+	text := `{{ .Name | truncate 6 | upper }} took {{ humanizeDuration .Duration }}`
+
+	have, err := renderTemplate("test", text, data)
+
+	assert.NilError(t, err)
+	assert.Equal(t, have, "A-VERY took 3m 25s")
+}
+
+func TestRenderTemplateFailure(t *testing.T) {
+	type testCase struct {
+		name    string
+		text    string
+		wantErr string
+	}
+
+	test := func(t *testing.T, tc testCase) {
+		_, err := renderTemplate("test", tc.text, map[string]any{"Name": "x"})
+
+		assert.ErrorContains(t, err, tc.wantErr)
+	}
+
+	testCases := []testCase{
+		{
+			name:    "parse error",
+			text:    "{{ .Name ",
+			wantErr: "parsing template test: ",
+		},
+		{
+			name:    "missing key",
+			text:    "{{ .Pizza }}",
+			wantErr: "executing template test: ",
+		},
+		{
+			name:    "humanizeDuration unsupported type",
+			text:    "{{ humanizeDuration 42 }}",
+			wantErr: "humanizeDuration: unsupported type int",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) { test(t, tc) })
+	}
+}
+
+func TestHumanizeDuration(t *testing.T) {
+	type testCase struct {
+		in   any
+		want string
+	}
+
+	test := func(t *testing.T, tc testCase) {
+		have, err := humanizeDuration(tc.in)
+
+		assert.NilError(t, err)
+		assert.Equal(t, have, tc.want)
+	}
+
+	testCases := []testCase{
+		{in: 45 * time.Second, want: "45s"},
+		{in: 2*time.Minute + 5*time.Second, want: "2m 5s"},
+		{in: time.Hour + 2*time.Minute + 3*time.Second, want: "1h 2m"},
+		{in: "90s", want: "1m 30s"},
+		{in: 1400 * time.Millisecond, want: "1s"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.want, func(t *testing.T) { test(t, tc) })
+	}
+}
@@ -0,0 +1,48 @@
+package cogito
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// tokenCommandTimeout bounds the execution of source.token_command.
+const tokenCommandTimeout = 30 * time.Second
+
+// runTokenCommand runs command with the shell and returns its stdout, trimmed, as the
+// access token (see source.token_command). The token never appears in the returned
+// errors, also if the command echoes it on stderr. The command is killed when parent
+// is done (see source.put_timeout) or after timeout, whichever comes first.
+func runTokenCommand(parent context.Context, command string, timeout time.Duration,
+) (string, error) {
+	ctx, cancel := context.WithTimeout(parent, timeout)
+	defer cancel()
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "/bin/sh", "-c", command)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	err := cmd.Run()
+	token := strings.TrimSpace(stdout.String())
+	if errors.Is(parent.Err(), context.DeadlineExceeded) {
+		return "", fmt.Errorf("token_command: put timed out (put_timeout)")
+	}
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return "", fmt.Errorf("token_command: timed out after %s", timeout)
+	}
+	if err != nil {
+		msg := strings.TrimSpace(stderr.String())
+		if token != "" {
+			msg = strings.ReplaceAll(msg, token, redact(token))
+		}
+		return "", fmt.Errorf("token_command: %s (stderr: %q)", err, msg)
+	}
+	if token == "" {
+		return "", fmt.Errorf("token_command: empty output, want the access token")
+	}
+	return token, nil
+}
@@ -0,0 +1,15 @@
+package cogito
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestRunTokenCommandTimeout(t *testing.T) {
+	_, err := runTokenCommand(context.Background(), "exec sleep 5", 50*time.Millisecond)
+
+	assert.Error(t, err, "token_command: timed out after 50ms")
+}
@@ -0,0 +1,16 @@
+package cogito
+
+import "net/http"
+
+// withoutKeepAlives returns a copy of rt with the HTTP keep-alives disabled, so that
+// each request uses a new connection. See source.disable_keep_alives.
+// If rt is not an [http.Transport], it is returned unchanged.
+func withoutKeepAlives(rt http.RoundTripper) http.RoundTripper {
+	tr, ok := rt.(*http.Transport)
+	if !ok {
+		return rt
+	}
+	tr = tr.Clone()
+	tr.DisableKeepAlives = true
+	return tr
+}
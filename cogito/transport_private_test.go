@@ -0,0 +1,27 @@
+package cogito
+
+import (
+	"net/http"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestWithoutKeepAlives(t *testing.T) {
+	orig := &http.Transport{}
+
+	rt := withoutKeepAlives(orig)
+
+	tr, ok := rt.(*http.Transport)
+	assert.Assert(t, ok, "have: %T", rt)
+	assert.Assert(t, tr.DisableKeepAlives)
+	assert.Assert(t, !orig.DisableKeepAlives, "original transport modified")
+}
+
+func TestWithoutKeepAlivesNotATransport(t *testing.T) {
+	orig := dumpTransport{}
+
+	rt := withoutKeepAlives(orig)
+
+	assert.Equal(t, rt, http.RoundTripper(orig))
+}
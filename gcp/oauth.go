@@ -0,0 +1,158 @@
+// Package gcp contains the minimal support to publish to Google Cloud Pub/Sub, without
+// depending on the Google Cloud SDK.
+package gcp
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// PubSubScope is the OAuth 2.0 scope needed to publish to Pub/Sub.
+const PubSubScope = "https://www.googleapis.com/auth/pubsub"
+
+// ServiceAccount is the subset of the fields of a service account JSON key that we use.
+type ServiceAccount struct {
+	ClientEmail string `json:"client_email"`
+	PrivateKey  string `json:"private_key"` // SENSITIVE
+	TokenURI    string `json:"token_uri"`
+}
+
+// ParseServiceAccount parses the JSON key of a service account, as downloaded from
+// the Google Cloud console.
+func ParseServiceAccount(data []byte) (ServiceAccount, error) {
+	var sa ServiceAccount
+	if err := json.Unmarshal(data, &sa); err != nil {
+		return ServiceAccount{}, fmt.Errorf("service account: %s", err)
+	}
+	var missing []string
+	if sa.ClientEmail == "" {
+		missing = append(missing, "client_email")
+	}
+	if sa.PrivateKey == "" {
+		missing = append(missing, "private_key")
+	}
+	if sa.TokenURI == "" {
+		missing = append(missing, "token_uri")
+	}
+	if len(missing) > 0 {
+		return ServiceAccount{}, fmt.Errorf("service account: missing keys: %s",
+			strings.Join(missing, ", "))
+	}
+	if _, err := parsePrivateKey(sa.PrivateKey); err != nil {
+		return ServiceAccount{}, fmt.Errorf("service account: %s", err)
+	}
+	return sa, nil
+}
+
+// AccessToken returns an OAuth 2.0 access token for scope, obtained from the token
+// endpoint of sa with a JWT signed with the private key of sa (the "JWT bearer" flow).
+// Parameter now is the time of issue of the JWT. Parameter transport sends the request;
+// nil means [http.DefaultTransport].
+//
+// See https://developers.google.com/identity/protocols/oauth2/service-account#httprest
+func AccessToken(ctx context.Context, transport http.RoundTripper, sa ServiceAccount,
+	scope string, now time.Time,
+) (string, error) {
+	assertion, err := signJWT(sa, scope, now)
+	if err != nil {
+		return "", fmt.Errorf("access token: %s", err)
+	}
+	form := url.Values{}
+	form.Set("grant_type", "urn:ietf:params:oauth:grant-type:jwt-bearer")
+	form.Set("assertion", assertion)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, sa.TokenURI,
+		strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", fmt.Errorf("access token: new request: %s", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	// By default, there is no timeout, so the call could hang forever.
+	client := &http.Client{Timeout: 30 * time.Second, Transport: transport}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("access token: send: %s", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("access token: status: %s; body: %s",
+			resp.Status, strings.TrimSpace(string(respBody)))
+	}
+	var reply struct {
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.Unmarshal(respBody, &reply); err != nil {
+		return "", fmt.Errorf("access token: JSON decode: %s", err)
+	}
+	if reply.AccessToken == "" {
+		return "", fmt.Errorf("access token: empty access_token in reply")
+	}
+	return reply.AccessToken, nil
+}
+
+// signJWT returns a JWT for scope, signed with RS256 with the private key of sa.
+func signJWT(sa ServiceAccount, scope string, now time.Time) (string, error) {
+	key, err := parsePrivateKey(sa.PrivateKey)
+	if err != nil {
+		return "", err
+	}
+	header, err := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT"})
+	if err != nil {
+		return "", err
+	}
+	claims, err := json.Marshal(map[string]any{
+		"iss":   sa.ClientEmail,
+		"scope": scope,
+		"aud":   sa.TokenURI,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+	})
+	if err != nil {
+		return "", err
+	}
+	enc := base64.RawURLEncoding
+	unsigned := enc.EncodeToString(header) + "." + enc.EncodeToString(claims)
+	digest := sha256.Sum256([]byte(unsigned))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", fmt.Errorf("signing JWT: %s", err)
+	}
+	return unsigned + "." + enc.EncodeToString(signature), nil
+}
+
+// parsePrivateKey parses a PEM-encoded RSA private key, in PKCS #8 (the format of the
+// service account keys) or PKCS #1 form.
+func parsePrivateKey(data string) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode([]byte(data))
+	if block == nil {
+		return nil, fmt.Errorf("private_key: no PEM data found")
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("private_key: %s", err)
+	}
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("private_key: want RSA key, have %T", parsed)
+	}
+	return key, nil
+}
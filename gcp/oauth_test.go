@@ -0,0 +1,114 @@
+package gcp_test
+
+import (
+	"context"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Pix4D/cogito/gcp"
+	"github.com/Pix4D/cogito/testhelp"
+	"gotest.tools/v3/assert"
+)
+
+func TestAccessTokenSuccess(t *testing.T) {
+	var form url.Values
+	ts := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			body, _ := io.ReadAll(req.Body)
+			form, _ = url.ParseQuery(string(body))
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"access_token": "the-token", "expires_in": 3599}`))
+		}))
+	saJSON, pubKey := testhelp.FakeServiceAccount(t, ts.URL+"/token")
+	sa, err := gcp.ParseServiceAccount([]byte(saJSON))
+	assert.NilError(t, err)
+	now := time.Date(2022, 9, 15, 10, 11, 12, 0, time.UTC)
+
+	token, err := gcp.AccessToken(context.Background(), nil, sa, gcp.PubSubScope, now)
+
+	assert.NilError(t, err)
+	ts.Close() // Avoid races before the following asserts.
+	assert.Equal(t, token, "the-token")
+	assert.Equal(t, form.Get("grant_type"), "urn:ietf:params:oauth:grant-type:jwt-bearer")
+
+	parts := strings.Split(form.Get("assertion"), ".")
+	assert.Equal(t, len(parts), 3)
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	assert.NilError(t, err)
+	assert.NilError(t, rsa.VerifyPKCS1v15(pubKey, crypto.SHA256, digest[:], signature))
+	claimsJSON, err := base64.RawURLEncoding.DecodeString(parts[1])
+	assert.NilError(t, err)
+	var claims map[string]any
+	assert.NilError(t, json.Unmarshal(claimsJSON, &claims))
+	assert.DeepEqual(t, claims, map[string]any{
+		"iss":   "cogito@the-project.iam.gserviceaccount.com",
+		"scope": gcp.PubSubScope,
+		"aud":   ts.URL + "/token",
+		"iat":   float64(now.Unix()),
+		"exp":   float64(now.Add(time.Hour).Unix()),
+	})
+}
+
+func TestAccessTokenFailure(t *testing.T) {
+	ts := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error": "invalid_grant"}`))
+		}))
+	defer ts.Close()
+	saJSON, _ := testhelp.FakeServiceAccount(t, ts.URL)
+	sa, err := gcp.ParseServiceAccount([]byte(saJSON))
+	assert.NilError(t, err)
+
+	_, err = gcp.AccessToken(context.Background(), nil, sa, gcp.PubSubScope, time.Now())
+
+	assert.Error(t, err,
+		`access token: status: 400 Bad Request; body: {"error": "invalid_grant"}`)
+}
+
+func TestParseServiceAccountFailure(t *testing.T) {
+	type testCase struct {
+		name    string
+		data    string
+		wantErr string
+	}
+
+	test := func(t *testing.T, tc testCase) {
+		_, err := gcp.ParseServiceAccount([]byte(tc.data))
+
+		assert.ErrorContains(t, err, tc.wantErr)
+	}
+
+	testCases := []testCase{
+		{
+			name:    "not JSON",
+			data:    "banana",
+			wantErr: "service account: invalid character 'b'",
+		},
+		{
+			name:    "missing keys",
+			data:    `{"client_email": "a@b"}`,
+			wantErr: "service account: missing keys: private_key, token_uri",
+		},
+		{
+			name:    "invalid private key",
+			data:    `{"client_email": "a@b", "private_key": "banana", "token_uri": "c"}`,
+			wantErr: "service account: private_key: no PEM data found",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) { test(t, tc) })
+	}
+}
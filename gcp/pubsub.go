@@ -0,0 +1,75 @@
+package gcp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// PubSubEndpoint is the default endpoint of the Pub/Sub REST API.
+const PubSubEndpoint = "https://pubsub.googleapis.com"
+
+// PubSubTopic identifies a Pub/Sub topic.
+type PubSubTopic struct {
+	Endpoint string // For example https://pubsub.googleapis.com
+	Project  string
+	Topic    string
+}
+
+// PublishRequest is the body of the Pub/Sub publish request.
+type PublishRequest struct {
+	Messages []PubSubMessage `json:"messages"`
+}
+
+// PubSubMessage is a Pub/Sub message. Data is encoded in base64 by the JSON encoder.
+type PubSubMessage struct {
+	Data       []byte            `json:"data"`
+	Attributes map[string]string `json:"attributes,omitempty"`
+}
+
+// Publish publishes a message with data and attributes to topic, authenticating with
+// the OAuth 2.0 access token (see [AccessToken]). It uses the REST API.
+// As for [AccessToken], a nil transport means [http.DefaultTransport].
+//
+// See https://cloud.google.com/pubsub/docs/reference/rest/v1/projects.topics/publish
+func Publish(ctx context.Context, transport http.RoundTripper, token string,
+	topic PubSubTopic, data []byte, attributes map[string]string,
+) error {
+	body, err := json.Marshal(PublishRequest{
+		Messages: []PubSubMessage{{Data: data, Attributes: attributes}},
+	})
+	if err != nil {
+		return fmt.Errorf("Pub/Sub publish: JSON encode: %s", err)
+	}
+
+	path := fmt.Sprintf("/v1/projects/%s/topics/%s:publish",
+		url.PathEscape(topic.Project), url.PathEscape(topic.Topic))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, topic.Endpoint+path,
+		bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("Pub/Sub publish: new request: %s", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	// By default, there is no timeout, so the call could hang forever.
+	client := &http.Client{Timeout: 30 * time.Second, Transport: transport}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("Pub/Sub publish: send: %s", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		respBody, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("Pub/Sub publish: status: %s; topic: %s; body: %s",
+			resp.Status, topic.Topic, strings.TrimSpace(string(respBody)))
+	}
+	return nil
+}
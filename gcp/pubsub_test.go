@@ -0,0 +1,53 @@
+package gcp_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Pix4D/cogito/gcp"
+	"gotest.tools/v3/assert"
+)
+
+func TestPublishSuccess(t *testing.T) {
+	var method, auth, path string
+	var body gcp.PublishRequest
+	ts := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			method = req.Method
+			auth = req.Header.Get("Authorization")
+			path = req.URL.Path
+			json.NewDecoder(req.Body).Decode(&body)
+			w.Write([]byte(`{"messageIds": ["1"]}`))
+		}))
+	topic := gcp.PubSubTopic{Endpoint: ts.URL, Project: "the-project", Topic: "the-topic"}
+
+	err := gcp.Publish(context.Background(), nil, "the-token", topic, []byte("the-data"),
+		map[string]string{"state": "success"})
+
+	assert.NilError(t, err)
+	ts.Close() // Avoid races before the following asserts.
+	assert.Equal(t, method, http.MethodPost)
+	assert.Equal(t, auth, "Bearer the-token")
+	assert.Equal(t, path, "/v1/projects/the-project/topics/the-topic:publish")
+	assert.Equal(t, len(body.Messages), 1)
+	assert.Equal(t, string(body.Messages[0].Data), "the-data")
+	assert.DeepEqual(t, body.Messages[0].Attributes, map[string]string{"state": "success"})
+}
+
+func TestPublishFailure(t *testing.T) {
+	ts := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte("Resource not found"))
+		}))
+	defer ts.Close()
+	topic := gcp.PubSubTopic{Endpoint: ts.URL, Project: "the-project", Topic: "the-topic"}
+
+	err := gcp.Publish(context.Background(), nil, "the-token", topic, []byte("the-data"), nil)
+
+	assert.Error(t, err,
+		"Pub/Sub publish: status: 404 Not Found; topic: the-topic; body: Resource not found")
+}
@@ -0,0 +1,58 @@
+package github
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"strings"
+)
+
+// CommitExists returns nil if commit sha exists in owner/repo. It returns an error if
+// the commit doesn't exist, for example because it has never been pushed.
+//
+// See also: https://docs.github.com/en/rest/commits/commits#get-a-commit
+func CommitExists(server, token, owner, repo, sha string, opts Options) error {
+	// API: GET /repos/{owner}/{repo}/commits/{ref}
+	url := server + path.Join("/repos", owner, repo, "commits", sha)
+
+	req, err := http.NewRequestWithContext(opts.context(), http.MethodGet, url, nil)
+	if err != nil {
+		return fmt.Errorf("create http request: %w", err)
+	}
+	req.Header.Set("Authorization", "token "+token)
+	req.Header.Set("Accept", "application/vnd.github.v3+json")
+
+	client := opts.client()
+	opts.Pacer.Wait()
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("http client Do: %w", err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return nil
+	// GitHub replies 404 if the repo is not found (or not visible to the token) and 422
+	// ("No commit found for SHA") if the repo is found but the commit is not.
+	case http.StatusNotFound, http.StatusUnprocessableEntity:
+		return &StatusError{
+			What: fmt.Sprintf("commit SHA %s not found in repo https://github.com/%s",
+				sha, path.Join(owner, repo)),
+			StatusCode: resp.StatusCode,
+			Details: fmt.Sprintf(`Hint: the commit might exist only locally (never pushed)
+or the git resource might be tracking another repository.
+Action: %s %s`, req.Method, url),
+		}
+	default:
+		respBody, _ := io.ReadAll(resp.Body)
+		return &StatusError{
+			What: fmt.Sprintf("failed to get commit %s: %d %s",
+				sha, resp.StatusCode, http.StatusText(resp.StatusCode)),
+			StatusCode: resp.StatusCode,
+			Details: fmt.Sprintf("Body: %s\nAction: %s %s",
+				strings.TrimSpace(string(respBody)), req.Method, url),
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package github_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Pix4D/cogito/github"
+	"github.com/Pix4D/cogito/testhelp"
+	"gotest.tools/v3/assert"
+)
+
+func TestCommitExistsSuccessMockAPI(t *testing.T) {
+	cfg := testhelp.FakeTestCfg
+	var path string
+	ts := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			path = r.URL.Path
+			fmt.Fprintln(w, `{"sha": "deadbeef"}`)
+		}))
+
+	err := github.CommitExists(ts.URL, cfg.Token, cfg.Owner, cfg.Repo, "deadbeef",
+		github.Options{})
+
+	assert.NilError(t, err)
+	ts.Close() // Avoid races before the following asserts.
+	assert.Equal(t, path, "/repos/fakeOwner/fakeRepo/commits/deadbeef")
+}
+
+func TestCommitExistsTimeoutMockAPI(t *testing.T) {
+	cfg := testhelp.FakeTestCfg
+	ts := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			time.Sleep(200 * time.Millisecond)
+		}))
+	defer ts.Close()
+
+	err := github.CommitExists(ts.URL, cfg.Token, cfg.Owner, cfg.Repo, "deadbeef",
+		github.Options{Timeout: 10 * time.Millisecond})
+
+	assert.ErrorContains(t, err, "Client.Timeout exceeded")
+}
+
+func TestCommitExistsFailureMockAPI(t *testing.T) {
+	type testCase struct {
+		name    string
+		status  int
+		body    string
+		wantErr string
+	}
+
+	cfg := testhelp.FakeTestCfg
+
+	test := func(t *testing.T, tc testCase) {
+		ts := httptest.NewServer(
+			http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tc.status)
+				fmt.Fprintln(w, tc.body)
+			}))
+		defer ts.Close()
+
+		err := github.CommitExists(ts.URL, cfg.Token, cfg.Owner, cfg.Repo, "deadbeef",
+			github.Options{})
+
+		assert.ErrorContains(t, err, tc.wantErr)
+	}
+
+	testCases := []testCase{
+		{
+			name:    "repo not found",
+			status:  http.StatusNotFound,
+			body:    `{"message": "Not Found"}`,
+			wantErr: "commit SHA deadbeef not found in repo https://github.com/fakeOwner/fakeRepo",
+		},
+		{
+			name:    "commit not found",
+			status:  http.StatusUnprocessableEntity,
+			body:    `{"message": "No commit found for SHA: deadbeef"}`,
+			wantErr: "commit SHA deadbeef not found in repo https://github.com/fakeOwner/fakeRepo",
+		},
+		{
+			name:    "any other error",
+			status:  http.StatusTeapot,
+			body:    "fake body",
+			wantErr: "failed to get commit deadbeef: 418 I'm a teapot\nBody: fake body",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) { test(t, tc) })
+	}
+}
@@ -6,7 +6,9 @@ package github
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -20,21 +22,75 @@ type StatusError struct {
 	What       string
 	StatusCode int
 	Details    string
+	// Err, if not nil, is one of the sentinel errors of this package.
+	Err error
 }
 
 func (e *StatusError) Error() string {
 	return fmt.Sprintf("%s\n%s", e.What, e.Details)
 }
 
+func (e *StatusError) Unwrap() error {
+	return e.Err
+}
+
+// ErrMaxStatuses is wrapped by the [StatusError] returned when the commit has reached
+// the maximum number of statuses allowed by GitHub.
+var ErrMaxStatuses = errors.New("maximum number of statuses reached")
+
+// maxStatusesMsg is part of the body of the 422 reply of GitHub when the maximum number
+// of statuses has been reached.
+const maxStatusesMsg = "has reached the maximum number of statuses"
+
 // API is the GitHub API endpoint.
 const API = "https://api.github.com"
 
+// DefaultTimeout is the default timeout of each HTTP request to the GitHub API.
+const DefaultTimeout = 30 * time.Second
+
+// Options are the optional settings of the calls to the GitHub API (a [CommitStatus]
+// and the functions of this package). The zero value is ready to use.
+type Options struct {
+	// Timeout is the timeout of each HTTP request. Zero means [DefaultTimeout].
+	Timeout time.Duration
+	// Pacer, if not nil, paces the HTTP requests. It can be shared among multiple
+	// CommitStatus and calls.
+	Pacer *Pacer
+	// Transport, if not nil, sends the HTTP requests. Nil means
+	// [http.DefaultTransport].
+	Transport http.RoundTripper
+	// Context, if not nil, bounds all the HTTP requests, on top of Timeout. Nil means
+	// [context.Background].
+	Context context.Context
+}
+
+func (opts Options) timeout() time.Duration {
+	if opts.Timeout == 0 {
+		return DefaultTimeout
+	}
+	return opts.Timeout
+}
+
+func (opts Options) context() context.Context {
+	if opts.Context == nil {
+		return context.Background()
+	}
+	return opts.Context
+}
+
+// client returns the HTTP client configured by opts.
+func (opts Options) client() *http.Client {
+	// By default, there is no timeout, so the call could hang forever.
+	return &http.Client{Timeout: opts.timeout(), Transport: opts.Transport}
+}
+
 type CommitStatus struct {
 	server  string
 	token   string
 	owner   string
 	repo    string
 	context string
+	opts    Options
 }
 
 // NewCommitStatus returns a CommitStatus object associated to a specific GitHub owner and repo.
@@ -43,11 +99,13 @@ type CommitStatus struct {
 // Parameter context is what created the status, for example "JOBNAME", or "PIPELINENAME/JOBNAME".
 // Be careful when using PIPELINENAME: if that name is ephemeral, it will make it impossible to
 // use GitHub repository branch protection rules.
+// Parameter opts contains the optional settings; its zero value gives the default behavior.
 //
 // See also:
 // https://docs.github.com/en/rest/commits/statuses#about-the-commit-statuses-api
-func NewCommitStatus(server, token, owner, repo, context string) CommitStatus {
-	return CommitStatus{server, token, owner, repo, context}
+func NewCommitStatus(server, token, owner, repo, context string, opts Options,
+) CommitStatus {
+	return CommitStatus{server, token, owner, repo, context, opts}
 }
 
 // AddRequest is the JSON object sent to the API.
@@ -58,6 +116,17 @@ type AddRequest struct {
 	Context     string `json:"context"`
 }
 
+// Status is the subset of a commit status, as returned by the API (for example by
+// [CommitStatus.AddWithResponse]), that we use.
+type Status struct {
+	ID        int64  `json:"id"`
+	URL       string `json:"url"`
+	State     string `json:"state"`
+	Context   string `json:"context"`
+	TargetURL string `json:"target_url"`
+	CreatedAt string `json:"created_at"`
+}
+
 // Add adds a commit state to the given sha, decorating it with targetURL and optional description.
 // Parameter sha is the 40 hexadecimal digit sha associated to the commit to decorate.
 // Parameter state is one of error, failure, pending, success.
@@ -68,6 +137,27 @@ type AddRequest struct {
 //
 // See also: https://docs.github.com/en/rest/commits/statuses#create-a-commit-status
 func (s CommitStatus) Add(sha, state, targetURL, description string) error {
+	_, err := s.add(sha, state, targetURL, description)
+	return err
+}
+
+// AddWithResponse is like [CommitStatus.Add], but it also returns the status as
+// created by the API.
+func (s CommitStatus) AddWithResponse(sha, state, targetURL, description string,
+) (Status, error) {
+	respBody, err := s.add(sha, state, targetURL, description)
+	if err != nil {
+		return Status{}, err
+	}
+	var status Status
+	if err := json.Unmarshal(respBody, &status); err != nil {
+		return Status{}, fmt.Errorf("JSON decode: %w", err)
+	}
+	return status, nil
+}
+
+// add is the implementation of [CommitStatus.Add]. It returns the body of the reply.
+func (s CommitStatus) add(sha, state, targetURL, description string) ([]byte, error) {
 	// API: POST /repos/{owner}/{repo}/statuses/{sha}
 	url := s.server + path.Join("/repos", s.owner, s.repo, "statuses", sha)
 
@@ -80,22 +170,23 @@ func (s CommitStatus) Add(sha, state, targetURL, description string) error {
 
 	reqBodyJSON, err := json.Marshal(reqBody)
 	if err != nil {
-		return fmt.Errorf("JSON encode: %w", err)
+		return nil, fmt.Errorf("JSON encode: %w", err)
 	}
 
-	req, err := http.NewRequest(http.MethodPost, url, bytes.NewBuffer(reqBodyJSON))
+	req, err := http.NewRequestWithContext(s.opts.context(), http.MethodPost, url,
+		bytes.NewBuffer(reqBodyJSON))
 	if err != nil {
-		return fmt.Errorf("create http request: %w", err)
+		return nil, fmt.Errorf("create http request: %w", err)
 	}
 	req.Header.Set("Authorization", "token "+s.token)
 	req.Header.Set("Accept", "application/vnd.github.v3+json")
 	req.Header.Set("Content-Type", "application/json")
 
-	// By default, there is no timeout, so the call could hang forever.
-	client := &http.Client{Timeout: time.Second * 30}
+	client := s.opts.client()
+	s.opts.Pacer.Wait()
 	resp, err := client.Do(req)
 	if err != nil {
-		return fmt.Errorf("http client Do: %w", err)
+		return nil, fmt.Errorf("http client Do: %w", err)
 	}
 	defer resp.Body.Close()
 
@@ -129,11 +220,12 @@ func (s CommitStatus) Add(sha, state, targetURL, description string) error {
 
 	respBody, _ := io.ReadAll(resp.Body)
 	var hint string
+	var sentinel error
 
 	switch resp.StatusCode {
 	case http.StatusCreated:
 		// Happy path
-		return nil
+		return respBody, nil
 	case http.StatusNotFound:
 		hint = fmt.Sprintf(`one of the following happened:
     1. The repo https://github.com/%s doesn't exist
@@ -144,14 +236,26 @@ func (s CommitStatus) Add(sha, state, targetURL, description string) error {
 		hint = "Github API is down"
 	case http.StatusUnauthorized:
 		hint = "Either wrong credentials or PAT expired (check your email for expiration notice)"
+	case http.StatusUnprocessableEntity:
+		if !strings.Contains(string(respBody), maxStatusesMsg) {
+			hint = "none"
+			break
+		}
+		sentinel = ErrMaxStatuses
+		hint = `GitHub allows at most 1000 statuses per commit and context.
+    Statuses accumulate: each put step adds a new one, also if the state didn't change.
+    Distinct contexts accumulate separately, so the limit is usually hit by reusing
+    the same context many times on the same commit (for example, re-triggered builds).
+    Either push a new commit or use a different context`
 	default:
 		// Any other error
 		hint = "none"
 	}
-	return &StatusError{
+	return nil, &StatusError{
 		What: fmt.Sprintf("failed to add state %q for commit %s: %d %s",
 			state, sha[0:min(len(sha), 7)], resp.StatusCode, http.StatusText(resp.StatusCode)),
 		StatusCode: resp.StatusCode,
+		Err:        sentinel,
 		Details: fmt.Sprintf(`Body: %s
 Hint: %s
 Action: %s %s
@@ -164,6 +268,93 @@ OAuth: %s`,
 	}
 }
 
+// combinedStatus is the subset of the reply of the combined status API that we use.
+type combinedStatus struct {
+	Statuses []Status `json:"statuses"`
+}
+
+// LatestState returns the latest state of the commit status with the context of s for
+// the given sha, or the empty string if there is no such status.
+//
+// See also: https://docs.github.com/en/rest/commits/statuses#get-the-combined-status-for-a-specific-reference
+func (s CommitStatus) LatestState(sha string) (string, error) {
+	status, err := s.LatestStatus(sha)
+	return status.State, err
+}
+
+// LatestStatus is like [CommitStatus.LatestState], but it returns the whole status. If
+// there is no such status, it returns the zero Status.
+func (s CommitStatus) LatestStatus(sha string) (Status, error) {
+	// API: GET /repos/{owner}/{repo}/commits/{ref}/status
+	url := s.server + path.Join("/repos", s.owner, s.repo, "commits", sha, "status")
+
+	var combined combinedStatus
+	if err := s.get(url, "failed to get state for commit "+sha[0:min(len(sha), 7)],
+		&combined); err != nil {
+		return Status{}, err
+	}
+	// The combined status contains only the latest status for each context.
+	for _, status := range combined.Statuses {
+		if status.Context == s.context {
+			return status, nil
+		}
+	}
+	return Status{}, nil
+}
+
+// Statuses returns the most recent statuses (up to 100) of all the contexts for the
+// given sha, most recent first. Unlike [CommitStatus.LatestStatus], it returns also the
+// statuses that have been replaced by a more recent one with the same context.
+//
+// See also: https://docs.github.com/en/rest/commits/statuses#list-commit-statuses-for-a-reference
+func (s CommitStatus) Statuses(sha string) ([]Status, error) {
+	// API: GET /repos/{owner}/{repo}/commits/{ref}/statuses
+	url := s.server + path.Join("/repos", s.owner, s.repo, "commits", sha, "statuses") +
+		"?per_page=100"
+
+	var statuses []Status
+	if err := s.get(url, "failed to get statuses for commit "+sha[0:min(len(sha), 7)],
+		&statuses); err != nil {
+		return nil, err
+	}
+	return statuses, nil
+}
+
+// get sends a GET request to url and decodes the JSON reply into v. Parameter what
+// describes the request in the returned [StatusError].
+func (s CommitStatus) get(url, what string, v any) error {
+	req, err := http.NewRequestWithContext(s.opts.context(), http.MethodGet, url, nil)
+	if err != nil {
+		return fmt.Errorf("create http request: %w", err)
+	}
+	req.Header.Set("Authorization", "token "+s.token)
+	req.Header.Set("Accept", "application/vnd.github.v3+json")
+
+	client := s.opts.client()
+	s.opts.Pacer.Wait()
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("http client Do: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		respBody, _ := io.ReadAll(resp.Body)
+		return &StatusError{
+			What: fmt.Sprintf("%s: %d %s",
+				what, resp.StatusCode, http.StatusText(resp.StatusCode)),
+			StatusCode: resp.StatusCode,
+			Details: fmt.Sprintf("Body: %s\nAction: %s %s",
+				strings.TrimSpace(string(respBody)), req.Method, url),
+		}
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("JSON decode: %w", err)
+	}
+	return nil
+}
+
 func min(a, b int) int {
 	if a < b {
 		return a
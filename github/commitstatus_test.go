@@ -5,12 +5,14 @@ import (
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"testing"
 	"time"
 
 	"github.com/Pix4D/cogito/github"
 	"github.com/Pix4D/cogito/testhelp"
 	"github.com/google/go-cmp/cmp"
+	"gotest.tools/v3/assert"
 )
 
 func TestGitHubStatusSuccessMockAPI(t *testing.T) {
@@ -41,7 +43,8 @@ func TestGitHubStatusSuccessMockAPI(t *testing.T) {
 		defer ts.Close()
 
 		t.Run(tc.name, func(t *testing.T) {
-			ghStatus := github.NewCommitStatus(ts.URL, cfg.Token, cfg.Owner, cfg.Repo, context)
+			ghStatus := github.NewCommitStatus(ts.URL, cfg.Token, cfg.Owner, cfg.Repo, context,
+				github.Options{})
 			err := ghStatus.Add(cfg.SHA, state, targetURL, desc)
 			if err != nil {
 				t.Fatalf("\nhave: %s\nwant: <no error>", err)
@@ -86,6 +89,20 @@ Action: POST %s/repos/fakeOwner/fakeRepo/statuses/012345678901234567890123456789
 OAuth: X-Accepted-Oauth-Scopes: [], X-Oauth-Scopes: []`,
 			wantStatus: http.StatusInternalServerError,
 		},
+		{
+			name: "422 Unprocessable Entity: maximum number of statuses",
+			body: `{"message":"Validation Failed","errors":[{"resource":"Status","code":"custom","message":"This SHA and context has reached the maximum number of statuses."}]}`,
+			wantErr: `failed to add state "success" for commit 0123456: 422 Unprocessable Entity
+Body: {"message":"Validation Failed","errors":[{"resource":"Status","code":"custom","message":"This SHA and context has reached the maximum number of statuses."}]}
+Hint: GitHub allows at most 1000 statuses per commit and context.
+    Statuses accumulate: each put step adds a new one, also if the state didn't change.
+    Distinct contexts accumulate separately, so the limit is usually hit by reusing
+    the same context many times on the same commit (for example, re-triggered builds).
+    Either push a new commit or use a different context
+Action: POST %s/repos/fakeOwner/fakeRepo/statuses/0123456789012345678901234567890123456789
+OAuth: X-Accepted-Oauth-Scopes: [], X-Oauth-Scopes: []`,
+			wantStatus: http.StatusUnprocessableEntity,
+		},
 		{
 			name: "Any other error",
 			body: "fake body",
@@ -108,7 +125,8 @@ OAuth: X-Accepted-Oauth-Scopes: [], X-Oauth-Scopes: []`,
 
 		t.Run(tc.name, func(t *testing.T) {
 			wantErr := fmt.Sprintf(tc.wantErr, ts.URL)
-			ghStatus := github.NewCommitStatus(ts.URL, cfg.Token, cfg.Owner, cfg.Repo, context)
+			ghStatus := github.NewCommitStatus(ts.URL, cfg.Token, cfg.Owner, cfg.Repo, context,
+				github.Options{})
 			err := ghStatus.Add(cfg.SHA, state, targetURL, desc)
 
 			if err == nil {
@@ -129,6 +147,133 @@ OAuth: X-Accepted-Oauth-Scopes: [], X-Oauth-Scopes: []`,
 	}
 }
 
+func TestGitHubStatusAddWithResponseMockAPI(t *testing.T) {
+	cfg := testhelp.FakeTestCfg
+	var body map[string]any
+	var URL *url.URL
+	reply := github.Status{ID: 42, URL: "https://example.com/42", State: "success"}
+	ts := testhelp.SpyHttpServer(&body, reply, &URL, http.StatusCreated)
+	defer ts.Close()
+	ghStatus := github.NewCommitStatus(ts.URL, cfg.Token, cfg.Owner, cfg.Repo,
+		"cogito/test", github.Options{})
+
+	status, err := ghStatus.AddWithResponse(cfg.SHA, "success", "", "")
+
+	assert.NilError(t, err)
+	assert.DeepEqual(t, status, reply)
+}
+
+func TestGitHubLatestStateMockAPI(t *testing.T) {
+	type testCase struct {
+		name    string
+		context string
+		want    string
+	}
+
+	cfg := testhelp.FakeTestCfg
+	var URL *url.URL
+	ts := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			URL = r.URL
+			fmt.Fprintln(w, `
+{
+  "state": "failure",
+  "statuses": [
+    {"state": "pending", "context": "ci/a"},
+    {"state": "failure", "context": "ci/b"}
+  ]
+}`)
+		}))
+	defer ts.Close()
+
+	test := func(t *testing.T, tc testCase) {
+		ghStatus := github.NewCommitStatus(ts.URL, cfg.Token, cfg.Owner, cfg.Repo,
+			tc.context, github.Options{})
+
+		have, err := ghStatus.LatestState(cfg.SHA)
+
+		assert.NilError(t, err)
+		assert.Equal(t, have, tc.want)
+		assert.Equal(t, URL.Path,
+			"/repos/fakeOwner/fakeRepo/commits/"+cfg.SHA+"/status")
+	}
+
+	testCases := []testCase{
+		{name: "context present", context: "ci/b", want: "failure"},
+		{name: "context absent", context: "ci/c", want: ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) { test(t, tc) })
+	}
+}
+
+func TestGitHubLatestStatusMockAPI(t *testing.T) {
+	cfg := testhelp.FakeTestCfg
+	ts := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprintln(w, `
+{
+  "state": "pending",
+  "statuses": [
+    {"id": 42, "state": "pending", "context": "ci/a",
+     "target_url": "https://other-ci.example.com/builds/1"}
+  ]
+}`)
+		}))
+	defer ts.Close()
+	ghStatus := github.NewCommitStatus(ts.URL, cfg.Token, cfg.Owner, cfg.Repo,
+		"ci/a", github.Options{})
+
+	have, err := ghStatus.LatestStatus(cfg.SHA)
+
+	assert.NilError(t, err)
+	assert.Equal(t, have, github.Status{ID: 42, State: "pending", Context: "ci/a",
+		TargetURL: "https://other-ci.example.com/builds/1"})
+}
+
+func TestGitHubStatusesMockAPI(t *testing.T) {
+	cfg := testhelp.FakeTestCfg
+	var URL *url.URL
+	ts := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			URL = r.URL
+			fmt.Fprintln(w, `
+[
+  {"id": 2, "state": "pending", "context": "ci/a"},
+  {"id": 1, "state": "failure", "context": "ci/a"}
+]`)
+		}))
+	ghStatus := github.NewCommitStatus(ts.URL, cfg.Token, cfg.Owner, cfg.Repo,
+		"ci/a", github.Options{})
+
+	have, err := ghStatus.Statuses(cfg.SHA)
+
+	assert.NilError(t, err)
+	ts.Close() // Avoid races before the following asserts.
+	assert.DeepEqual(t, have, []github.Status{
+		{ID: 2, State: "pending", Context: "ci/a"},
+		{ID: 1, State: "failure", Context: "ci/a"},
+	})
+	assert.Equal(t, URL.Path, "/repos/fakeOwner/fakeRepo/commits/"+cfg.SHA+"/statuses")
+	assert.Equal(t, URL.RawQuery, "per_page=100")
+}
+
+func TestGitHubLatestStateFailureMockAPI(t *testing.T) {
+	cfg := testhelp.FakeTestCfg
+	ts := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNotFound)
+		}))
+	defer ts.Close()
+	ghStatus := github.NewCommitStatus(ts.URL, cfg.Token, cfg.Owner, cfg.Repo,
+		"ci/a", github.Options{})
+
+	_, err := ghStatus.LatestState(cfg.SHA)
+
+	assert.ErrorContains(t, err, "failed to get state for commit 0123456: 404 Not Found")
+}
+
 func TestGitHubStatusSuccessIntegration(t *testing.T) {
 	if testing.Short() {
 		t.Skip("Skipping integration test (reason: -short)")
@@ -140,7 +285,8 @@ func TestGitHubStatusSuccessIntegration(t *testing.T) {
 	desc := time.Now().Format("15:04:05")
 	state := "success"
 
-	ghStatus := github.NewCommitStatus(github.API, cfg.Token, cfg.Owner, cfg.Repo, context)
+	ghStatus := github.NewCommitStatus(github.API, cfg.Token, cfg.Owner, cfg.Repo, context,
+		github.Options{})
 	err := ghStatus.Add(cfg.SHA, state, targetURL, desc)
 
 	if err != nil {
@@ -217,7 +363,7 @@ OAuth: X-Accepted-Oauth-Scopes: [], X-Oauth-Scopes: [repo:status]`,
 			}
 
 			ghStatus := github.NewCommitStatus(github.API, tc.token, tc.owner, tc.repo,
-				"dummy-context")
+				"dummy-context", github.Options{})
 			err := ghStatus.Add(tc.sha, state, "dummy-url", "dummy-desc")
 
 			if err == nil {
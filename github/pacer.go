@@ -0,0 +1,45 @@
+package github
+
+import (
+	"sync"
+	"time"
+)
+
+// Pacer is a client-side rate limiter of the requests to the GitHub API: a token bucket
+// with a burst of one, that spaces the requests evenly. It is safe for concurrent use.
+// A nil Pacer doesn't pace.
+//
+// It helps to stay below the GitHub secondary rate limits when a single put step makes
+// multiple requests (for example, multiple commits). It cannot coordinate with other
+// processes.
+type Pacer struct {
+	mu       sync.Mutex
+	interval time.Duration
+	next     time.Time
+}
+
+// NewPacer returns a Pacer allowing at most rps requests per second. If rps is not
+// positive, it returns nil, that is, no pacing.
+func NewPacer(rps float64) *Pacer {
+	if rps <= 0 {
+		return nil
+	}
+	return &Pacer{interval: time.Duration(float64(time.Second) / rps)}
+}
+
+// Wait blocks until the next request is allowed.
+func (p *Pacer) Wait() {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := time.Now()
+	if wait := p.next.Sub(now); wait > 0 {
+		time.Sleep(wait)
+		// The sleep can last longer than asked: count from the real time, so that the
+		// next request is never closer than interval to this one.
+		now = time.Now()
+	}
+	p.next = now.Add(p.interval)
+}
@@ -0,0 +1,40 @@
+package github_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Pix4D/cogito/github"
+	"gotest.tools/v3/assert"
+)
+
+func TestPacerSpacesRequests(t *testing.T) {
+	pacer := github.NewPacer(20) // One request every 50ms.
+	var times []time.Time
+	start := time.Now()
+
+	for i := 0; i < 4; i++ {
+		pacer.Wait()
+		times = append(times, time.Now())
+	}
+
+	for i := 1; i < len(times); i++ {
+		gap := times[i].Sub(times[i-1])
+		assert.Assert(t, gap >= 45*time.Millisecond, "request %d: gap: %s", i, gap)
+	}
+	// The first request is not delayed, the following three are.
+	elapsed := time.Since(start)
+	assert.Assert(t, elapsed >= 150*time.Millisecond, "elapsed: %s", elapsed)
+}
+
+func TestPacerNilDoesNotPace(t *testing.T) {
+	pacer := github.NewPacer(0)
+	assert.Assert(t, pacer == nil)
+	start := time.Now()
+
+	for i := 0; i < 100; i++ {
+		pacer.Wait()
+	}
+
+	assert.Assert(t, time.Since(start) < 10*time.Millisecond)
+}
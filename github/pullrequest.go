@@ -0,0 +1,75 @@
+package github
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// pullRequest is the subset of the reply of the pull requests API that we use.
+type pullRequest struct {
+	State string `json:"state"`
+	Head  struct {
+		SHA string `json:"sha"`
+	} `json:"head"`
+}
+
+// PullRequestHead returns the SHA of the head commit of the open pull request number
+// of owner/repo. It returns an error if the pull request doesn't exist or is closed.
+//
+// See also: https://docs.github.com/en/rest/pulls/pulls#get-a-pull-request
+func PullRequestHead(server, token, owner, repo string, number int, opts Options,
+) (string, error) {
+	// API: GET /repos/{owner}/{repo}/pulls/{pull_number}
+	url := server + path.Join("/repos", owner, repo, "pulls", strconv.Itoa(number))
+
+	req, err := http.NewRequestWithContext(opts.context(), http.MethodGet, url, nil)
+	if err != nil {
+		return "", fmt.Errorf("create http request: %w", err)
+	}
+	req.Header.Set("Authorization", "token "+token)
+	req.Header.Set("Accept", "application/vnd.github.v3+json")
+
+	client := opts.client()
+	opts.Pacer.Wait()
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("http client Do: %w", err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		// Happy path, continue below.
+	case http.StatusNotFound:
+		return "", &StatusError{
+			What: fmt.Sprintf("pull request #%d not found in https://github.com/%s",
+				number, path.Join(owner, repo)),
+			StatusCode: resp.StatusCode,
+			Details:    fmt.Sprintf("Action: %s %s", req.Method, url),
+		}
+	default:
+		respBody, _ := io.ReadAll(resp.Body)
+		return "", &StatusError{
+			What: fmt.Sprintf("failed to get pull request #%d: %d %s",
+				number, resp.StatusCode, http.StatusText(resp.StatusCode)),
+			StatusCode: resp.StatusCode,
+			Details: fmt.Sprintf("Body: %s\nAction: %s %s",
+				strings.TrimSpace(string(respBody)), req.Method, url),
+		}
+	}
+
+	var pr pullRequest
+	if err := json.NewDecoder(resp.Body).Decode(&pr); err != nil {
+		return "", fmt.Errorf("JSON decode: %w", err)
+	}
+	if pr.State != "open" {
+		return "", fmt.Errorf("pull request #%d of https://github.com/%s is %s",
+			number, path.Join(owner, repo), pr.State)
+	}
+	return pr.Head.SHA, nil
+}
@@ -0,0 +1,80 @@
+package github_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Pix4D/cogito/github"
+	"github.com/Pix4D/cogito/testhelp"
+	"gotest.tools/v3/assert"
+)
+
+func TestPullRequestHeadSuccessMockAPI(t *testing.T) {
+	cfg := testhelp.FakeTestCfg
+	var path string
+	ts := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			path = r.URL.Path
+			fmt.Fprintln(w, `{"state": "open", "head": {"sha": "deadbeef"}}`)
+		}))
+
+	sha, err := github.PullRequestHead(ts.URL, cfg.Token, cfg.Owner, cfg.Repo, 42,
+		github.Options{})
+
+	assert.NilError(t, err)
+	ts.Close() // Avoid races before the following asserts.
+	assert.Equal(t, sha, "deadbeef")
+	assert.Equal(t, path, "/repos/fakeOwner/fakeRepo/pulls/42")
+}
+
+func TestPullRequestHeadFailureMockAPI(t *testing.T) {
+	type testCase struct {
+		name    string
+		status  int
+		body    string
+		wantErr string
+	}
+
+	cfg := testhelp.FakeTestCfg
+
+	test := func(t *testing.T, tc testCase) {
+		ts := httptest.NewServer(
+			http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tc.status)
+				fmt.Fprintln(w, tc.body)
+			}))
+		defer ts.Close()
+
+		_, err := github.PullRequestHead(ts.URL, cfg.Token, cfg.Owner, cfg.Repo, 42,
+			github.Options{})
+
+		assert.ErrorContains(t, err, tc.wantErr)
+	}
+
+	testCases := []testCase{
+		{
+			name:    "closed",
+			status:  http.StatusOK,
+			body:    `{"state": "closed", "head": {"sha": "deadbeef"}}`,
+			wantErr: "pull request #42 of https://github.com/fakeOwner/fakeRepo is closed",
+		},
+		{
+			name:    "non existing",
+			status:  http.StatusNotFound,
+			body:    `{"message": "Not Found"}`,
+			wantErr: "pull request #42 not found in https://github.com/fakeOwner/fakeRepo",
+		},
+		{
+			name:    "any other error",
+			status:  http.StatusTeapot,
+			body:    "fake body",
+			wantErr: "failed to get pull request #42: 418 I'm a teapot\nBody: fake body",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) { test(t, tc) })
+	}
+}
@@ -0,0 +1,74 @@
+package github
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// RateLimit is the rate limit status of a quota of the GitHub API.
+type RateLimit struct {
+	Limit     int
+	Remaining int
+	Reset     time.Time
+}
+
+// rateLimitReply is the subset of the reply of the rate limit API that we use.
+type rateLimitReply struct {
+	Resources struct {
+		Core struct {
+			Limit     int   `json:"limit"`
+			Remaining int   `json:"remaining"`
+			Reset     int64 `json:"reset"` // Unix epoch seconds.
+		} `json:"core"`
+	} `json:"resources"`
+}
+
+// CoreRateLimit returns the rate limit status of the core quota (the one used by the
+// commit status API) of token. Querying it does not count against the quota.
+//
+// See also: https://docs.github.com/en/rest/rate-limit#get-rate-limit-status-for-the-authenticated-user
+func CoreRateLimit(server, token string, opts Options) (RateLimit, error) {
+	// API: GET /rate_limit
+	url := server + "/rate_limit"
+
+	req, err := http.NewRequestWithContext(opts.context(), http.MethodGet, url, nil)
+	if err != nil {
+		return RateLimit{}, fmt.Errorf("create http request: %w", err)
+	}
+	req.Header.Set("Authorization", "token "+token)
+	req.Header.Set("Accept", "application/vnd.github.v3+json")
+
+	client := opts.client()
+	opts.Pacer.Wait()
+	resp, err := client.Do(req)
+	if err != nil {
+		return RateLimit{}, fmt.Errorf("http client Do: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		respBody, _ := io.ReadAll(resp.Body)
+		return RateLimit{}, &StatusError{
+			What: fmt.Sprintf("failed to get rate limit: %d %s",
+				resp.StatusCode, http.StatusText(resp.StatusCode)),
+			StatusCode: resp.StatusCode,
+			Details: fmt.Sprintf("Body: %s\nAction: %s %s",
+				strings.TrimSpace(string(respBody)), req.Method, url),
+		}
+	}
+
+	var reply rateLimitReply
+	if err := json.NewDecoder(resp.Body).Decode(&reply); err != nil {
+		return RateLimit{}, fmt.Errorf("JSON decode: %w", err)
+	}
+	core := reply.Resources.Core
+	return RateLimit{
+		Limit:     core.Limit,
+		Remaining: core.Remaining,
+		Reset:     time.Unix(core.Reset, 0).UTC(),
+	}, nil
+}
@@ -0,0 +1,49 @@
+package github_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Pix4D/cogito/github"
+	"github.com/Pix4D/cogito/testhelp"
+	"gotest.tools/v3/assert"
+)
+
+func TestCoreRateLimitSuccessMockAPI(t *testing.T) {
+	cfg := testhelp.FakeTestCfg
+	var path string
+	ts := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			path = r.URL.Path
+			fmt.Fprintln(w,
+				`{"resources": {"core": {"limit": 5000, "remaining": 4321, "reset": 1663236672}}}`)
+		}))
+
+	have, err := github.CoreRateLimit(ts.URL, cfg.Token, github.Options{})
+
+	assert.NilError(t, err)
+	ts.Close() // Avoid races before the following asserts.
+	assert.Equal(t, path, "/rate_limit")
+	assert.DeepEqual(t, have, github.RateLimit{
+		Limit:     5000,
+		Remaining: 4321,
+		Reset:     time.Date(2022, 9, 15, 10, 11, 12, 0, time.UTC),
+	})
+}
+
+func TestCoreRateLimitFailureMockAPI(t *testing.T) {
+	cfg := testhelp.FakeTestCfg
+	ts := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusUnauthorized)
+			fmt.Fprintln(w, `{"message": "Bad credentials"}`)
+		}))
+	defer ts.Close()
+
+	_, err := github.CoreRateLimit(ts.URL, cfg.Token, github.Options{})
+
+	assert.ErrorContains(t, err, "failed to get rate limit: 401 Unauthorized")
+}
@@ -0,0 +1,88 @@
+package github
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"strings"
+)
+
+// Repository is the subset of the reply of the repositories API that we use.
+type Repository struct {
+	// Name is the name of the repo, with the canonical casing.
+	Name string `json:"name"`
+	// FullName is owner/repo, with the canonical casing.
+	FullName string `json:"full_name"`
+	Owner    struct {
+		// Login is the name of the owner, with the canonical casing.
+		Login string `json:"login"`
+	} `json:"owner"`
+	DefaultBranch string `json:"default_branch"`
+}
+
+// DefaultBranch returns the name of the default branch of owner/repo.
+//
+// See also: https://docs.github.com/en/rest/repos/repos#get-a-repository
+func DefaultBranch(server, token, owner, repo string, opts Options) (string, error) {
+	r, err := GetRepository(server, token, owner, repo, opts)
+	if err != nil {
+		return "", err
+	}
+	return r.DefaultBranch, nil
+}
+
+// GetRepository returns the information about owner/repo. Since GitHub owner and repo
+// are case-insensitive, the reply has the canonical casing, whatever the casing of
+// owner and repo.
+//
+// See also: https://docs.github.com/en/rest/repos/repos#get-a-repository
+func GetRepository(server, token, owner, repo string, opts Options,
+) (Repository, error) {
+	// API: GET /repos/{owner}/{repo}
+	url := server + path.Join("/repos", owner, repo)
+
+	req, err := http.NewRequestWithContext(opts.context(), http.MethodGet, url, nil)
+	if err != nil {
+		return Repository{}, fmt.Errorf("create http request: %w", err)
+	}
+	req.Header.Set("Authorization", "token "+token)
+	req.Header.Set("Accept", "application/vnd.github.v3+json")
+
+	client := opts.client()
+	opts.Pacer.Wait()
+	resp, err := client.Do(req)
+	if err != nil {
+		return Repository{}, fmt.Errorf("http client Do: %w", err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		// Happy path, continue below.
+	case http.StatusNotFound:
+		return Repository{}, &StatusError{
+			What: fmt.Sprintf("repo https://github.com/%s not found",
+				path.Join(owner, repo)),
+			StatusCode: resp.StatusCode,
+			Details: fmt.Sprintf("Hint: check source.owner and source.repo\nAction: %s %s",
+				req.Method, url),
+		}
+	default:
+		respBody, _ := io.ReadAll(resp.Body)
+		return Repository{}, &StatusError{
+			What: fmt.Sprintf("failed to get repo %s: %d %s",
+				path.Join(owner, repo), resp.StatusCode, http.StatusText(resp.StatusCode)),
+			StatusCode: resp.StatusCode,
+			Details: fmt.Sprintf("Body: %s\nAction: %s %s",
+				strings.TrimSpace(string(respBody)), req.Method, url),
+		}
+	}
+
+	var r Repository
+	if err := json.NewDecoder(resp.Body).Decode(&r); err != nil {
+		return Repository{}, fmt.Errorf("JSON decode: %w", err)
+	}
+	return r, nil
+}
@@ -0,0 +1,91 @@
+package github_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Pix4D/cogito/github"
+	"github.com/Pix4D/cogito/testhelp"
+	"gotest.tools/v3/assert"
+)
+
+func TestDefaultBranchSuccessMockAPI(t *testing.T) {
+	cfg := testhelp.FakeTestCfg
+	var path string
+	ts := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			path = r.URL.Path
+			fmt.Fprintln(w, `{"name": "fakeRepo", "default_branch": "main"}`)
+		}))
+
+	branch, err := github.DefaultBranch(ts.URL, cfg.Token, cfg.Owner, cfg.Repo,
+		github.Options{})
+
+	assert.NilError(t, err)
+	ts.Close() // Avoid races before the following asserts.
+	assert.Equal(t, branch, "main")
+	assert.Equal(t, path, "/repos/fakeOwner/fakeRepo")
+}
+
+func TestGetRepositoryCanonicalCasingMockAPI(t *testing.T) {
+	ts := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprintln(w, `{"name": "Cogito", "full_name": "Pix4D/Cogito",
+"owner": {"login": "Pix4D"}, "default_branch": "main"}`)
+		}))
+
+	repo, err := github.GetRepository(ts.URL, "dummy-token", "pix4d", "cogito",
+		github.Options{})
+
+	assert.NilError(t, err)
+	ts.Close() // Avoid races before the following asserts.
+	assert.Equal(t, repo.Owner.Login, "Pix4D")
+	assert.Equal(t, repo.Name, "Cogito")
+	assert.Equal(t, repo.FullName, "Pix4D/Cogito")
+	assert.Equal(t, repo.DefaultBranch, "main")
+}
+
+func TestDefaultBranchFailureMockAPI(t *testing.T) {
+	type testCase struct {
+		name    string
+		status  int
+		body    string
+		wantErr string
+	}
+
+	cfg := testhelp.FakeTestCfg
+
+	test := func(t *testing.T, tc testCase) {
+		ts := httptest.NewServer(
+			http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tc.status)
+				fmt.Fprintln(w, tc.body)
+			}))
+		defer ts.Close()
+
+		_, err := github.DefaultBranch(ts.URL, cfg.Token, cfg.Owner, cfg.Repo, github.Options{})
+
+		assert.ErrorContains(t, err, tc.wantErr)
+	}
+
+	testCases := []testCase{
+		{
+			name:    "repo not found",
+			status:  http.StatusNotFound,
+			body:    `{"message": "Not Found"}`,
+			wantErr: "repo https://github.com/fakeOwner/fakeRepo not found",
+		},
+		{
+			name:    "any other error",
+			status:  http.StatusTeapot,
+			body:    "fake body",
+			wantErr: "failed to get repo fakeOwner/fakeRepo: 418 I'm a teapot\nBody: fake body",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) { test(t, tc) })
+	}
+}
@@ -17,6 +17,10 @@ import (
 	"time"
 )
 
+// MaxTextLen is the maximum length, in characters, of the text of a message accepted by
+// the Google Chat API.
+const MaxTextLen = 4096
+
 // BasicMessage is the request for a Google Chat basic message.
 type BasicMessage struct {
 	Text string `json:"text"`
@@ -61,6 +65,8 @@ type MessageSpace struct {
 //
 // Note that the Google Chat API encodes the secret in the webhook itself.
 //
+// Parameter transport sends the request; nil means [http.DefaultTransport].
+//
 // Implementation note: if instead we need to send multiple messages, we should reuse the
 // http.Client, so we should add another API function to do so.
 //
@@ -70,7 +76,9 @@ type MessageSpace struct {
 // webhooks: https://developers.google.com/chat/how-tos/webhooks
 // payload: https://developers.google.com/chat/api/guides/message-formats/basic
 // threadKey: https://developers.google.com/chat/reference/rest/v1/spaces.messages/create
-func TextMessage(ctx context.Context, theURL, threadKey, text string) (MessageReply, error) {
+func TextMessage(ctx context.Context, transport http.RoundTripper, theURL, threadKey,
+	text string,
+) (MessageReply, error) {
 	body, err := json.Marshal(BasicMessage{Text: text})
 	if err != nil {
 		return MessageReply{}, fmt.Errorf("TextMessage: %s", err)
@@ -91,7 +99,7 @@ func TextMessage(ctx context.Context, theURL, threadKey, text string) (MessageRe
 		req.URL.RawQuery = values.Encode()
 	}
 
-	client := &http.Client{}
+	client := &http.Client{Transport: transport}
 	resp, err := client.Do(req)
 	if err != nil {
 		return MessageReply{}, fmt.Errorf("TextMessage: send: %s", RedactErrorURL(err))
@@ -115,6 +123,27 @@ func TextMessage(ctx context.Context, theURL, threadKey, text string) (MessageRe
 	return reply, nil
 }
 
+// Preflight probes the webhook theURL with a HEAD request, returning an error only if
+// the endpoint is unreachable (DNS, connection or TLS errors, timeout). Since not all
+// servers support HEAD, any HTTP response, whatever the status code, counts as
+// reachable. The HEAD request doesn't post any message. As for [TextMessage], a nil
+// transport means [http.DefaultTransport].
+func Preflight(ctx context.Context, transport http.RoundTripper, theURL string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, theURL, nil)
+	if err != nil {
+		return fmt.Errorf("Preflight: new request: %w", RedactErrorURL(err))
+	}
+
+	client := &http.Client{Transport: transport}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("Preflight: webhook unreachable: %s", RedactErrorURL(err))
+	}
+	resp.Body.Close()
+
+	return nil
+}
+
 // RedactURL returns a _best effort_ redacted copy of theURL.
 //
 // Use this workaround only when you are forced to use an API that encodes
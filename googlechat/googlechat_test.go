@@ -29,7 +29,7 @@ func TestTextMessageIntegration(t *testing.T) {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	reply, err := googlechat.TextMessage(ctx, gchatUrl, threadKey, text)
+	reply, err := googlechat.TextMessage(ctx, nil, gchatUrl, threadKey, text)
 
 	assert.NilError(t, err)
 	assert.Assert(t, cmp.Contains(reply.Text, text))
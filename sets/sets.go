@@ -41,6 +41,11 @@ func (s *Set[T]) Size() int {
 	return len(s.items)
 }
 
+// IsEmpty returns true if s has no elements.
+func (s *Set[T]) IsEmpty() bool {
+	return len(s.items) == 0
+}
+
 // OrderedList returns a slice of the elements of s, ordered.
 // TODO This can probably be replaced in Go 1.20 when a generics slice packages reaches
 // the stdlib.
@@ -81,6 +86,21 @@ func (s *Set[T]) Difference(x *Set[T]) *Set[T] {
 	return result
 }
 
+// IsDisjoint returns true if s and x have no elements in common.
+func (s *Set[T]) IsDisjoint(x *Set[T]) bool {
+	// Iterate over the smaller set.
+	small, big := s, x
+	if small.Size() > big.Size() {
+		small, big = big, small
+	}
+	for i := range small.items {
+		if big.Contains(i) {
+			return false
+		}
+	}
+	return true
+}
+
 func max(a, b int) int {
 	if a > b {
 		return a
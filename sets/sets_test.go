@@ -141,6 +141,93 @@ func TestDifference(t *testing.T) {
 	}
 }
 
+func TestIsEmpty(t *testing.T) {
+	type testCase struct {
+		name  string
+		items []int
+		want  bool
+	}
+
+	test := func(t *testing.T, tc testCase) {
+		s := sets.From(tc.items...)
+
+		assert.Equal(t, s.IsEmpty(), tc.want)
+	}
+
+	testCases := []testCase{
+		{
+			name:  "nil",
+			items: nil,
+			want:  true,
+		},
+		{
+			name:  "empty",
+			items: []int{},
+			want:  true,
+		},
+		{
+			name:  "non empty",
+			items: []int{1},
+			want:  false,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) { test(t, tc) })
+	}
+}
+
+func TestIsDisjoint(t *testing.T) {
+	type testCase struct {
+		name string
+		s    *sets.Set[int]
+		x    *sets.Set[int]
+		want bool
+	}
+
+	test := func(t *testing.T, tc testCase) {
+		assert.Equal(t, tc.s.IsDisjoint(tc.x), tc.want)
+		assert.Equal(t, tc.x.IsDisjoint(tc.s), tc.want, "must be symmetric")
+	}
+
+	testCases := []testCase{
+		{
+			name: "both empty",
+			s:    sets.From[int](),
+			x:    sets.From[int](),
+			want: true,
+		},
+		{
+			name: "one empty",
+			s:    sets.From(1, 2, 3),
+			x:    sets.From[int](),
+			want: true,
+		},
+		{
+			name: "nothing in common",
+			s:    sets.From(1, 2, 3),
+			x:    sets.From(4, 5),
+			want: true,
+		},
+		{
+			name: "one in common",
+			s:    sets.From(1, 2, 3),
+			x:    sets.From(4, 2),
+			want: false,
+		},
+		{
+			name: "all in common",
+			s:    sets.From(1, 2, 3),
+			x:    sets.From(1, 2, 3),
+			want: false,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) { test(t, tc) })
+	}
+}
+
 func TestRemoveFound(t *testing.T) {
 	type testCase struct {
 		name     string
@@ -0,0 +1,30 @@
+package testhelp
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+// FakeServiceAccount returns the JSON key of a Google Cloud service account with a
+// newly generated private key and token endpoint tokenURI, together with the
+// corresponding public key, to verify the signature of the JWT.
+func FakeServiceAccount(t *testing.T, tokenURI string) (string, *rsa.PublicKey) {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NilError(t, err)
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	assert.NilError(t, err)
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+	data := ToJSON(t, map[string]string{
+		"type":         "service_account",
+		"client_email": "cogito@the-project.iam.gserviceaccount.com",
+		"private_key":  string(keyPEM),
+		"token_uri":    tokenURI,
+	})
+	return string(data), &key.PublicKey
+}